@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// adaptiveStart is how many readers an Adaptive run begins with.
+	adaptiveStart = 4
+	// defaultAdaptiveInterval is how often an Adaptive run measures
+	// throughput when AdaptiveInterval is unset.
+	defaultAdaptiveInterval = 250 * time.Millisecond
+	// adaptiveGain is the rise in throughput over the last interval that
+	// counts as an improvement.
+	adaptiveGain = 1.05
+)
+
+// gate caps how many readers may hold a file at once, under a limit that can
+// change while they run. Readers above the limit are parked. A nil *gate
+// never blocks.
+type gate struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  int
+	active int
+}
+
+// newGate returns nil unless cfg.Adaptive is set.
+func (cfg PipelineCfg) newGate() *gate {
+	if !cfg.Adaptive {
+		return nil
+	}
+	g := &gate{limit: min(adaptiveStart, max(cfg.SFTPReaders, 1))}
+	g.cond = sync.NewCond(&g.mu)
+	return g
+}
+
+// acquire waits for a free slot. It returns false if ctx is done first.
+func (g *gate) acquire(ctx context.Context) bool {
+	if g == nil {
+		return true
+	}
+	stop := context.AfterFunc(ctx, func() {
+		g.mu.Lock()
+		g.cond.Broadcast()
+		g.mu.Unlock()
+	})
+	defer stop()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for g.active >= g.limit {
+		if ctx.Err() != nil {
+			return false
+		}
+		g.cond.Wait()
+	}
+	g.active++
+	return true
+}
+
+func (g *gate) release() {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	g.active--
+	g.cond.Signal()
+	g.mu.Unlock()
+}
+
+func (g *gate) setLimit(n int) {
+	g.mu.Lock()
+	g.limit = n
+	g.cond.Broadcast()
+	g.mu.Unlock()
+}
+
+func (g *gate) current() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.limit
+}
+
+// adapt runs the Adaptive controller until ctx is done, returning a function
+// that stops it and waits for it to exit.
+func (r *run) adapt(ctx context.Context) (stop func()) {
+	if r.gate == nil {
+		return func() {}
+	}
+	interval := r.cfg.AdaptiveInterval
+	if interval <= 0 {
+		interval = defaultAdaptiveInterval
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var prev sample
+		var prevRate float64
+		dir := 1
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+			cur := r.sample()
+			rate := float64(cur.bytes - prev.bytes)
+			ok, failed := cur.ok-prev.ok, cur.failed-prev.failed
+			var limit int
+			limit, dir = nextLimit(r.gate.current(), r.cfg.SFTPReaders, dir, prevRate, rate, ok, failed)
+			r.gate.setLimit(limit)
+			prev = cur
+			if ok > 0 || failed > 0 {
+				prevRate = rate
+			}
+		}
+	})
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+// sample is a snapshot of a run's counters.
+type sample struct {
+	bytes      int64
+	ok, failed int32
+}
+
+func (r *run) sample() sample {
+	return sample{
+		bytes:  r.bytes.Load(),
+		ok:     r.transferred.Load() + r.skipped.Load(),
+		failed: r.failed.Load(),
+	}
+}
+
+// nextLimit is one controller step. It halves the limit when more jobs failed
+// than succeeded over the last interval, and otherwise hill-climbs one reader
+// at a time: keep going in direction dir while throughput rises, turn back
+// when it falls, and shed readers while it is flat. An interval in which
+// nothing finished gives no signal.
+func nextLimit(limit, maxLimit, dir int, prevRate, rate float64, ok, failed int32) (int, int) {
+	switch {
+	case failed > ok:
+		limit, dir = limit/2, 1
+	case ok == 0 && failed == 0:
+	case rate > prevRate*adaptiveGain:
+		limit += dir
+	case rate*adaptiveGain < prevRate:
+		dir = -dir
+		limit += dir
+	default:
+		limit, dir = limit-1, -1
+	}
+	return min(max(limit, 1), max(maxLimit, 1)), dir
+}
+
+// concurrency is the reader concurrency a run ended with.
+func (r *run) concurrency() int {
+	if r.gate == nil {
+		return r.cfg.SFTPReaders
+	}
+	return r.gate.current()
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+// linkClient models a link that serves at most slots opens at a time, each
+// taking latency, so throughput grows with concurrency up to slots and is
+// flat beyond it.
+type linkClient struct {
+	*sftptest.FakeClient
+	slots   chan struct{}
+	latency time.Duration
+	active  atomic.Int32
+	peak    atomic.Int32
+}
+
+func (c *linkClient) Open(path string) (io.ReadCloser, error) {
+	n := c.active.Add(1)
+	defer c.active.Add(-1)
+	for p := c.peak.Load(); n > p && !c.peak.CompareAndSwap(p, n); p = c.peak.Load() {
+	}
+	c.slots <- struct{}{}
+	time.Sleep(c.latency)
+	<-c.slots
+	return c.FakeClient.Open(path)
+}
+
+func TestAdaptiveGrowsConcurrency(t *testing.T) {
+	client := &linkClient{
+		FakeClient: sftptest.NewFakeClient(),
+		slots:      make(chan struct{}, 12),
+		latency:    2 * time.Millisecond,
+	}
+	jobs := fileJobs(client.FakeClient, 2000, sftptest.File{Data: make([]byte, 1024)})
+
+	cfg := PipelineCfg{SFTPReaders: 32, Workers: 4, BufferSize: 8, Adaptive: true, AdaptiveInterval: 20 * time.Millisecond}
+	stats, err := cfg.TransferFilesStats(context.Background(), client, jobs, func(FileResult) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Transferred != int32(len(jobs)) {
+		t.Errorf("expected %d transfers, got %d", len(jobs), stats.Transferred)
+	}
+	if peak := client.peak.Load(); peak <= adaptiveStart {
+		t.Errorf("concurrency never grew past %d, peak %d", adaptiveStart, peak)
+	}
+	if stats.Concurrency < 1 || stats.Concurrency > cfg.SFTPReaders {
+		t.Errorf("Concurrency = %d, want 1..%d", stats.Concurrency, cfg.SFTPReaders)
+	}
+}
+
+func TestConcurrencyWithoutAdaptive(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	jobs := fileJobs(client, 10, slowFile)
+	stats, _ := PipelineCfg{SFTPReaders: 6, Workers: 2, BufferSize: 2}.TransferFilesStats(context.Background(), client, jobs, func(FileResult) error { return nil })
+	if stats.Concurrency != 6 {
+		t.Errorf("Concurrency = %d, want SFTPReaders", stats.Concurrency)
+	}
+}
+
+func TestNextLimit(t *testing.T) {
+	tests := []struct {
+		name           string
+		limit, dir     int
+		prevRate, rate float64
+		ok, failed     int32
+		want, wantDir  int
+	}{
+		{"rising keeps climbing", 4, 1, 100, 200, 10, 0, 5, 1},
+		{"rising keeps shedding", 8, -1, 100, 200, 10, 0, 7, -1},
+		{"falling turns back", 8, 1, 200, 100, 10, 0, 7, -1},
+		{"plateau sheds", 8, 1, 100, 101, 10, 0, 7, -1},
+		{"errors halve", 8, 1, 100, 200, 2, 5, 4, 1},
+		{"no signal holds", 8, 1, 100, 0, 0, 0, 8, 1},
+		{"capped at max", 16, 1, 100, 200, 10, 0, 16, 1},
+		{"floor of one", 1, -1, 200, 100, 1, 3, 1, 1},
+	}
+	for _, tt := range tests {
+		got, dir := nextLimit(tt.limit, 16, tt.dir, tt.prevRate, tt.rate, tt.ok, tt.failed)
+		if got != tt.want || dir != tt.wantDir {
+			t.Errorf("%s: got (%d, %d), want (%d, %d)", tt.name, got, dir, tt.want, tt.wantDir)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import "context"
+
+// archive runs a transfer whose files are written one at a time by add, as
+// an entry named by the file's cleaned ID, then finishes the archive with
+// close. IDs that SafeJoin would reject fail their file. A failed add leaves
+// the archive unusable, so it fails every file from then on and is returned
+// without calling close; otherwise the run's error, or close's, is returned.
+// ProcessTimeout, CompressResults and SpillThreshold are ignored.
+func (cfg PipelineCfg) archive(ctx context.Context, sftpClient SFTPClient, jobs []FileJob, add func(name string, data []byte) error, close func() error) (TransferStats, error) {
+	// The one worker is all that keeps adds from overlapping, so none may
+	// be abandoned to a ProcessTimeout while still writing
+	cfg.Workers, cfg.ProcessTimeout = 1, 0
+	// Entries are the files' own bytes, added from memory
+	cfg.CompressResults, cfg.SpillThreshold = false, 0
+	// Only the one worker touches writeErr until the run returns
+	var writeErr error
+	stats, err := cfg.transfer(ctx, []SFTPClient{sftpClient}, fromSlice(jobs), func(r FileResult) error {
+		if writeErr != nil {
+			return writeErr
+		}
+		name, err := safeName(r.ID)
+		if err != nil {
+			return err
+		}
+		writeErr = add(name, r.Data)
+		return writeErr
+	}, hooks{})
+	if writeErr != nil {
+		return stats, writeErr
+	}
+	if closeErr := close(); err == nil {
+		err = closeErr
+	}
+	return stats, err
+}
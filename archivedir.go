@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+)
+
+// maxArchiveSuffix bounds the numbered names tried for a file whose base
+// name is already taken in ArchiveDir.
+const maxArchiveSuffix = 1000
+
+// renamer is implemented by clients that can move remote files, which
+// ArchiveDir needs. *sftp.Client satisfies it.
+type renamer interface {
+	Rename(oldname, newname string) error
+}
+
+// renameRemote moves oldname to newname through client, failing with
+// errors.ErrUnsupported if the client can't.
+func renameRemote(client SFTPClient, oldname, newname string) error {
+	mv, ok := client.(renamer)
+	if !ok {
+		return fmt.Errorf("%T has no Rename method: %w", client, errors.ErrUnsupported)
+	}
+	return mv.Rename(oldname, newname)
+}
+
+// dirMaker is implemented by clients that can create remote directories.
+// *sftp.Client satisfies it.
+type dirMaker interface {
+	MkdirAll(path string) error
+}
+
+// archiveDir creates ArchiveDir once per run, on the first file moved into it.
+type archiveDir struct {
+	once sync.Once
+	err  error
+}
+
+func (d *archiveDir) ensure(client SFTPClient, dir string) error {
+	d.once.Do(func() {
+		mk, ok := client.(dirMaker)
+		if !ok {
+			return
+		}
+		if d.err = mk.MkdirAll(dir); d.err != nil {
+			d.err = fmt.Errorf("create %s: %w", dir, d.err)
+		}
+	})
+	return d.err
+}
+
+// archiveSource renames the remote file of a job that succeeded into
+// ArchiveDir under its base name. A failure leaves the job a success; it is
+// logged and counted in TransferStats.ArchiveFailed instead. A file already
+// gone, such as one a duplicate job archived first, counts as archived.
+func (r *run) archiveSource(read fileRead) {
+	if err := r.archive(read.client, read.job.RemotePath); err != nil {
+		r.archiveFailed.Add(1)
+		r.cfg.logger().Printf("Failed to archive %s after transfer: %v\n", describe(read.job), err)
+	}
+}
+
+// archive moves remotePath into ArchiveDir. A base name already taken there
+// gets a numeric suffix before its extension: report.1.csv, report.2.csv and
+// so on.
+func (r *run) archive(client SFTPClient, remotePath string) error {
+	dir := r.cfg.ArchiveDir
+	if err := r.archiveDir.ensure(client, dir); err != nil {
+		return err
+	}
+	base := path.Base(remotePath)
+	ext := path.Ext(base)
+	for n := 0; n < maxArchiveSuffix; n++ {
+		dest := path.Join(dir, base)
+		if n > 0 {
+			dest = path.Join(dir, fmt.Sprintf("%s.%d%s", strings.TrimSuffix(base, ext), n, ext))
+		}
+		if _, err := statRemote(client, dest); err == nil {
+			continue
+		}
+		err := renameRemote(client, remotePath, dest)
+		if err == nil {
+			return nil
+		}
+		// Another file may have taken dest since it was checked
+		if _, serr := statRemote(client, dest); serr != nil {
+			if _, serr := statRemote(client, remotePath); IsNotFound(serr) {
+				return nil
+			}
+			return err
+		}
+	}
+	return fmt.Errorf("no free name for %s in %s", base, dir)
+}
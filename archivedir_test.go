@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	pathpkg "path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+// movableClient is a remote tree whose files can be renamed and whose
+// directories can be created, safe for concurrent use.
+type movableClient struct {
+	mu    sync.Mutex
+	files map[string][]byte
+	dirs  map[string]bool
+}
+
+func (c *movableClient) Open(path string) (io.ReadCloser, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, ok := c.files[path]
+	if !ok {
+		return nil, fmt.Errorf("open %s: %w", path, os.ErrNotExist)
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (c *movableClient) Stat(path string) (os.FileInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, ok := c.files[path]
+	if !ok {
+		return nil, fmt.Errorf("stat %s: %w", path, os.ErrNotExist)
+	}
+	return movedFileInfo{name: pathpkg.Base(path), size: int64(len(data))}, nil
+}
+
+// movedFileInfo is the os.FileInfo of a movableClient file.
+type movedFileInfo struct {
+	name string
+	size int64
+}
+
+func (fi movedFileInfo) Name() string       { return fi.name }
+func (fi movedFileInfo) Size() int64        { return fi.size }
+func (fi movedFileInfo) Mode() os.FileMode  { return 0o644 }
+func (fi movedFileInfo) ModTime() time.Time { return time.Time{} }
+func (fi movedFileInfo) IsDir() bool        { return false }
+func (fi movedFileInfo) Sys() any           { return nil }
+
+func (c *movableClient) Rename(oldname, newname string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirs[pathpkg.Dir(newname)] {
+		return fmt.Errorf("rename %s: %w", newname, os.ErrNotExist)
+	}
+	if _, ok := c.files[oldname]; !ok {
+		return fmt.Errorf("rename %s: %w", oldname, os.ErrNotExist)
+	}
+	if _, ok := c.files[newname]; ok {
+		return fmt.Errorf("rename %s: %w", newname, os.ErrExist)
+	}
+	c.files[newname] = c.files[oldname]
+	delete(c.files, oldname)
+	return nil
+}
+
+func (c *movableClient) MkdirAll(path string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dirs[path] = true
+	return nil
+}
+
+func TestArchiveDir(t *testing.T) {
+	client := &movableClient{
+		files: map[string][]byte{
+			"/in/a.csv":         []byte("a"),
+			"/in/b.csv":         []byte("b"),
+			"/in/bad.csv":       []byte("bad"),
+			"/in/sub/a.csv":     []byte("a2"),
+			"/in/.done/b.csv":   []byte("old b"),
+			"/in/.done/b.1.csv": []byte("older b"),
+		},
+		dirs: map[string]bool{},
+	}
+	jobs := []FileJob{
+		{RemotePath: "/in/a.csv", ID: "a"},
+		{RemotePath: "/in/b.csv", ID: "b"},
+		{RemotePath: "/in/bad.csv", ID: "bad"},
+		{RemotePath: "/in/sub/a.csv", ID: "sub/a"},
+		{RemotePath: "/in/missing.csv", ID: "missing"},
+	}
+	// One worker and reader so a.csv is archived before sub/a.csv
+	cfg := PipelineCfg{SFTPReaders: 1, Workers: 1, BufferSize: 1, ArchiveDir: "/in/.done", DeleteAfterTransfer: true}
+	stats, err := cfg.TransferFilesStats(context.Background(), client, jobs, func(res FileResult) error {
+		if res.ID == "bad" {
+			return errors.New("rejected")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Transferred != 3 || stats.Failed != 2 || stats.ArchiveFailed != 0 {
+		t.Fatalf("expected 3 transferred and 2 failed, got %+v", stats)
+	}
+	if !client.dirs["/in/.done"] {
+		t.Error("expected ArchiveDir to be created")
+	}
+	want := map[string]string{
+		"/in/bad.csv":       "bad",
+		"/in/.done/a.csv":   "a",
+		"/in/.done/a.1.csv": "a2",
+		"/in/.done/b.csv":   "old b",
+		"/in/.done/b.1.csv": "older b",
+		"/in/.done/b.2.csv": "b",
+	}
+	if len(client.files) != len(want) {
+		t.Errorf("got files %v, want %v", client.files, want)
+	}
+	for path, data := range want {
+		if got := string(client.files[path]); got != data {
+			t.Errorf("%s = %q, want %q", path, got, data)
+		}
+	}
+}
+
+func TestArchiveDirFails(t *testing.T) {
+	files := sftptest.NewFakeClient()
+	jobs := fileJobs(files, 3, dataFile)
+	log := &recordingLogger{}
+	// A FakeClient can't rename, so every move fails but the jobs succeed
+	cfg := PipelineCfg{SFTPReaders: 2, Workers: 2, ArchiveDir: "/done", Logger: log}
+	stats, err := cfg.TransferFilesStats(context.Background(), files, jobs, func(FileResult) error { return nil })
+	if err != nil || stats.Transferred != 3 || stats.ArchiveFailed != 3 {
+		t.Fatalf("expected 3 transfers and 3 failed moves, got %+v, %v", stats, err)
+	}
+	for _, job := range jobs {
+		if _, err := files.Stat(job.RemotePath); err != nil {
+			t.Errorf("expected %s left in place, got %v", job.RemotePath, err)
+		}
+	}
+	if !strings.Contains(strings.Join(log.lines, ""), "Failed to archive") {
+		t.Errorf("expected warnings, got %q", log.lines)
+	}
+}
+
+func TestArchiveDirFanOut(t *testing.T) {
+	client := &movableClient{files: map[string][]byte{"/in/a.csv": []byte("a")}, dirs: map[string]bool{}}
+	jobs := []FileJob{
+		{RemotePath: "/in/a.csv", ID: "first"},
+		{RemotePath: "/in/a.csv", ID: "second"},
+	}
+	cfg := PipelineCfg{SFTPReaders: 1, Workers: 1, BufferSize: 1, ArchiveDir: "/in/.done", Dedupe: DedupeFanOut}
+	stats, err := cfg.TransferFilesStats(context.Background(), client, jobs, func(FileResult) error { return nil })
+	if err != nil || stats.Transferred != 2 || stats.ArchiveFailed != 0 {
+		t.Fatalf("expected 2 transfers archived once, got %+v, %v", stats, err)
+	}
+	if len(client.files) != 1 || string(client.files["/in/.done/a.csv"]) != "a" {
+		t.Errorf("expected only /in/.done/a.csv, got %v", client.files)
+	}
+}
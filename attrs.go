@@ -0,0 +1,30 @@
+package main
+
+import "os"
+
+// chtimes sets a downloaded file's times for PreserveAttrs. Tests replace it
+// to make it fail.
+var chtimes = os.Chtimes
+
+// preserveAttrs gives the local file path the permission bits and
+// modification time of remotePath under PreserveAttrs. It runs on the
+// temporary file before the rename, so a file only appears under its name
+// with its attributes. A failed Stat leaves path as written and is logged; a
+// failure applying them fails the file.
+func (cfg PipelineCfg) preserveAttrs(client SFTPClient, remotePath, path string) error {
+	if !cfg.PreserveAttrs {
+		return nil
+	}
+	info, err := statRemote(client, remotePath)
+	if err != nil {
+		cfg.logger().Printf("Keeping default attributes for %s: %v\n", remotePath, err)
+		return nil
+	}
+	if err := os.Chmod(path, info.Mode().Perm()); err != nil {
+		return err
+	}
+	if mtime := info.ModTime(); !mtime.IsZero() {
+		return chtimes(path, mtime, mtime)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// BatchProcessFunc processes a batch of results at once, for sinks such as
+// bulk inserts that are cheaper per file in bulk. Its error is the outcome of
+// every file in the batch.
+type BatchProcessFunc func(results []FileResult) error
+
+// defaultBatchSize is the batch size used when BatchSize is unset.
+const defaultBatchSize = 100
+
+// TransferFilesBatch is TransferFilesStats passing results to batchFunc
+// BatchSize at a time, in the order they finish reading. Only the last batch
+// may be smaller. A batch that fails, after any retries of ErrRetryProcess,
+// fails every file in it.
+func (cfg PipelineCfg) TransferFilesBatch(ctx context.Context, sftpClient SFTPClient, jobs []FileJob, batchFunc BatchProcessFunc) (TransferStats, error) {
+	return cfg.transfer(ctx, []SFTPClient{sftpClient}, fromSlice(jobs), nil, hooks{batch: batchFunc})
+}
+
+// batcher accumulates the reads of a batch run until a batch is full. A nil
+// *batcher is a run without batching.
+type batcher struct {
+	mu      sync.Mutex
+	size    int
+	process BatchProcessFunc
+	pending []fileRead
+}
+
+// newBatcher returns nil unless process is set.
+func (cfg PipelineCfg) newBatcher(process BatchProcessFunc) *batcher {
+	if process == nil {
+		return nil
+	}
+	size := cfg.BatchSize
+	if size <= 0 {
+		size = defaultBatchSize
+	}
+	return &batcher{size: size, process: process}
+}
+
+// add queues read and returns the batch it completes, if any.
+func (b *batcher) add(read fileRead) []fileRead {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending = append(b.pending, read)
+	if len(b.pending) < b.size {
+		return nil
+	}
+	full := b.pending
+	b.pending = nil
+	return full
+}
+
+// rest returns the final, partial batch.
+func (b *batcher) rest() []fileRead {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	rest := b.pending
+	b.pending = nil
+	return rest
+}
+
+// flush processes a batch of reads and records the outcome of each job.
+func (r *run) flush(ctx context.Context, reads []fileRead, h hooks) {
+	if len(reads) == 0 {
+		return
+	}
+	results := make([]FileResult, len(reads))
+	for i, read := range reads {
+		results[i] = read.result
+	}
+	_, span := r.tracer.Start(ctx, "sftp.process_batch")
+	span.SetAttributes(attrFiles.Int(len(reads)))
+	what := fmt.Sprintf("a batch of %d files from %s", len(reads), describe(reads[0].job))
+	err := r.cfg.retryIf(ctx, isRetryProcess, func() error {
+		return r.bounded(func() error {
+			return r.protect(what, func() error { return r.batch.process(results) })
+		})
+	})
+	endSpan(span, err)
+	for _, read := range reads {
+		r.settle(read, StageProcess, err, h)
+	}
+}
+
+// flushRest processes the final batch once the workers are done, unless the
+// run was cancelled, in which case its jobs didn't complete.
+func (r *run) flushRest(ctx context.Context, h hooks) {
+	if r.batch == nil {
+		return
+	}
+	rest := r.batch.rest()
+	if ctx.Err() != nil {
+		for _, read := range rest {
+			read.span.End()
+		}
+		return
+	}
+	r.flush(ctx, rest, h)
+}
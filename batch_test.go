@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+func TestTransferFilesBatch(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	jobs := fileJobs(client, 103, dataFile)
+	cfg := PipelineCfg{SFTPReaders: 8, Workers: 4, BufferSize: 8, BatchSize: 10}
+
+	var mu sync.Mutex
+	var sizes []int
+	seen := map[string]bool{}
+	stats, err := cfg.TransferFilesBatch(context.Background(), client, jobs, func(results []FileResult) error {
+		mu.Lock()
+		defer mu.Unlock()
+		sizes = append(sizes, len(results))
+		for _, res := range results {
+			seen[res.ID] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Transferred != 103 || len(seen) != 103 {
+		t.Fatalf("expected all 103 files in batches, got %d transferred, %d seen", stats.Transferred, len(seen))
+	}
+	if len(sizes) != 11 || sizes[10] != 3 {
+		t.Fatalf("expected ten full batches and a final one of 3, got %v", sizes)
+	}
+	for _, n := range sizes[:10] {
+		if n != 10 {
+			t.Errorf("expected full batches of 10, got %v", sizes)
+			break
+		}
+	}
+}
+
+func TestTransferFilesBatchError(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	jobs := fileJobs(client, 20, dataFile)
+	client.Delete(jobs[0].RemotePath)
+	boom := errors.New("bulk insert failed")
+	cfg := PipelineCfg{SFTPReaders: 1, Workers: 1, BufferSize: 1, BatchSize: 5}
+
+	var batches int
+	var errs errorList
+	stats, err := cfg.transfer(context.Background(), []SFTPClient{client}, fromSlice(jobs), nil, hooks{
+		onError: errs.add,
+		batch: func([]FileResult) error {
+			if batches++; batches == 2 {
+				return boom
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The missing file fails on its own; the second batch fails all five
+	if stats.Transferred != 14 || stats.Failed != 6 {
+		t.Fatalf("expected 14 transferred and 6 failed, got %+v", stats)
+	}
+	var batchFailures int
+	for _, e := range errs.errs {
+		if errors.Is(e, boom) {
+			batchFailures++
+			if e.Stage != StageProcess {
+				t.Errorf("expected a process failure, got %v", e)
+			}
+		}
+	}
+	if batchFailures != 5 {
+		t.Errorf("expected 5 files failed by the batch, got %d", batchFailures)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// checkpointSyncEvery is how many IDs are appended to the checkpoint file
+// between syncs. A crash loses at most this many, which are then transferred
+// again on restart.
+const checkpointSyncEvery = 64
+
+// errCheckpointed skips a job that an earlier run with the same
+// CheckpointPath completed.
+var errCheckpointed = fmt.Errorf("%w: completed in an earlier run", ErrSkip)
+
+// checkpoint records the IDs of completed jobs, one per line, in the file at
+// CheckpointPath. A nil *checkpoint records nothing and skips nothing.
+type checkpoint struct {
+	done map[string]bool
+
+	mu       sync.Mutex
+	f        *os.File
+	w        *bufio.Writer
+	unsynced int
+}
+
+// newCheckpoint opens cfg.CheckpointPath, creating it if needed, and loads
+// the IDs it holds. A partial last line, left by a crash mid-write, is
+// dropped.
+func (cfg PipelineCfg) newCheckpoint() (*checkpoint, error) {
+	if cfg.CheckpointPath == "" {
+		return nil, nil
+	}
+	f, err := os.OpenFile(cfg.CheckpointPath, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("checkpoint: %w", err)
+	}
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("checkpoint: %w", err)
+	}
+	data := buf.Bytes()
+	end := bytes.LastIndexByte(data, '\n') + 1
+	done := make(map[string]bool)
+	for _, id := range strings.Split(string(data[:end]), "\n") {
+		if id != "" {
+			done[id] = true
+		}
+	}
+	if end < len(data) {
+		if err := f.Truncate(int64(end)); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("checkpoint: %w", err)
+		}
+	}
+	if _, err := f.Seek(int64(end), 0); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("checkpoint: %w", err)
+	}
+	return &checkpoint{done: done, f: f, w: bufio.NewWriter(f)}, nil
+}
+
+// skip returns errCheckpointed if job completed in an earlier run.
+func (c *checkpoint) skip(job FileJob) error {
+	if c != nil && c.done[job.ID] {
+		return errCheckpointed
+	}
+	return nil
+}
+
+// record appends id, syncing the file every checkpointSyncEvery IDs.
+func (c *checkpoint) record(id string) error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.w.WriteString(id + "\n"); err != nil {
+		return err
+	}
+	if c.unsynced++; c.unsynced < checkpointSyncEvery {
+		return nil
+	}
+	return c.sync()
+}
+
+// sync flushes buffered IDs to the file and the file to disk. c.mu must be
+// held.
+func (c *checkpoint) sync() error {
+	c.unsynced = 0
+	if err := c.w.Flush(); err != nil {
+		return err
+	}
+	return c.f.Sync()
+}
+
+// close syncs and closes the checkpoint file.
+func (c *checkpoint) close() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err := c.sync()
+	if cerr := c.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// checkpointed records a job that completed successfully. Write errors are
+// logged, not returned: the job itself succeeded.
+func (r *run) checkpointed(job FileJob) {
+	if err := r.checkpoint.record(job.ID); err != nil {
+		r.cfg.logger().Printf("Failed to checkpoint %s: %v\n", describe(job), err)
+	}
+}
+
+// closeCheckpoint syncs and closes the run's checkpoint at the end of the
+// run.
+func (r *run) closeCheckpoint() {
+	if err := r.checkpoint.close(); err != nil {
+		r.cfg.logger().Printf("Failed to close checkpoint %s: %v\n", r.cfg.CheckpointPath, err)
+	}
+}
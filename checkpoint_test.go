@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+func TestCheckpoint(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	jobs := fileJobs(client, 10, dataFile)
+	cfg := DefaultCfg()
+	cfg.CheckpointPath = filepath.Join(t.TempDir(), "checkpoint")
+
+	// The first run is "interrupted": the second half of its jobs fail.
+	stats, err := cfg.TransferFilesStats(context.Background(), client, jobs, func(r FileResult) error {
+		var i int
+		fmt.Sscanf(r.ID, "id_%d", &i)
+		if i >= 5 {
+			return errors.New("interrupted")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Transferred != 5 || stats.Failed != 5 {
+		t.Fatalf("first run: %+v", stats)
+	}
+
+	before := opened(client, jobs)
+	var mu sync.Mutex
+	var ids []string
+	stats, err = cfg.TransferFilesStats(context.Background(), client, jobs, func(r FileResult) error {
+		mu.Lock()
+		defer mu.Unlock()
+		ids = append(ids, r.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Transferred != 5 || stats.Skipped != 5 || stats.Failed != 0 {
+		t.Errorf("restart: %+v", stats)
+	}
+	sort.Strings(ids)
+	if fmt.Sprint(ids) != "[id_5 id_6 id_7 id_8 id_9]" {
+		t.Errorf("restart processed %v, want only the remainder", ids)
+	}
+	if n := opened(client, jobs) - before; n != 5 {
+		t.Errorf("checkpointed files should not be opened, got %d opens", n)
+	}
+
+	data, err := os.ReadFile(cfg.CheckpointPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(data); n != 10*len("id_0\n") {
+		t.Errorf("expected every ID once in the checkpoint, got %q", data)
+	}
+}
+
+func TestCheckpointPartialLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint")
+	if err := os.WriteFile(path, []byte("a\nb\nc"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultCfg()
+	cfg.CheckpointPath = path
+	client := newFakeClient(map[string][]byte{"/remote/c.bin": []byte("c")})
+	stats, err := cfg.TransferFilesStats(context.Background(), client, []FileJob{
+		{RemotePath: "/remote/c.bin", ID: "b"},
+		{RemotePath: "/remote/c.bin", ID: "c"},
+	}, func(FileResult) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Transferred != 1 || stats.Skipped != 1 {
+		t.Errorf("a partial last line should not count as done: %+v", stats)
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != "a\nb\nc\n" {
+		t.Errorf("expected the partial line replaced, got %q", data)
+	}
+}
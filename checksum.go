@@ -0,0 +1,109 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"strings"
+)
+
+// ChecksumAlgo selects the hash behind FileResult.Checksum and
+// FileJob.ExpectedChecksum.
+type ChecksumAlgo int
+
+const (
+	ChecksumSHA256 ChecksumAlgo = iota
+	ChecksumMD5
+	ChecksumSHA1
+	// ChecksumCRC32 is the IEEE CRC-32, as 8 hex digits.
+	ChecksumCRC32
+)
+
+func (a ChecksumAlgo) String() string {
+	switch a {
+	case ChecksumSHA256:
+		return "sha256"
+	case ChecksumMD5:
+		return "md5"
+	case ChecksumSHA1:
+		return "sha1"
+	case ChecksumCRC32:
+		return "crc32"
+	}
+	return fmt.Sprintf("ChecksumAlgo(%d)", int(a))
+}
+
+func (a ChecksumAlgo) new() hash.Hash {
+	switch a {
+	case ChecksumMD5:
+		return md5.New()
+	case ChecksumSHA1:
+		return sha1.New()
+	case ChecksumCRC32:
+		return crc32.NewIEEE()
+	}
+	return sha256.New()
+}
+
+// hasher hashes a file while it is read, for FileResult.Checksum and to check
+// FileJob.ExpectedChecksum and ExpectedSHA256. A nil *hasher does nothing, so
+// files pay for hashing only when it is asked for.
+type hasher struct {
+	h    hash.Hash
+	algo ChecksumAlgo
+	want string
+	// next checks ExpectedSHA256 when it can't share the hash above.
+	next *hasher
+}
+
+func newHasher(job FileJob, algo ChecksumAlgo, compute bool) *hasher {
+	want, sha := job.ExpectedChecksum, job.ExpectedSHA256
+	if algo == ChecksumSHA256 && want == "" {
+		want, sha = sha, ""
+	}
+	var h *hasher
+	if compute || want != "" {
+		h = &hasher{h: algo.new(), algo: algo, want: want}
+	}
+	if sha == "" {
+		return h
+	}
+	next := &hasher{h: sha256.New(), algo: ChecksumSHA256, want: sha}
+	if h == nil {
+		return next
+	}
+	h.next = next
+	return h
+}
+
+// wrap returns r with everything read from it also fed to the hash.
+func (h *hasher) wrap(r io.Reader) io.Reader {
+	if h == nil {
+		return r
+	}
+	return h.next.wrap(io.TeeReader(r, h.h))
+}
+
+// sum is the hex digest of everything read so far, or "" if not hashing.
+func (h *hasher) sum() string {
+	if h == nil {
+		return ""
+	}
+	return hex.EncodeToString(h.h.Sum(nil))
+}
+
+// check compares the digests with the expected values, if there are any.
+func (h *hasher) check() error {
+	if h == nil {
+		return nil
+	}
+	if got := h.sum(); h.want != "" && !strings.EqualFold(got, h.want) {
+		return fmt.Errorf("%w: %s %s, want %s", ErrChecksumMismatch, h.algo, got, h.want)
+	}
+	return h.next.check()
+}
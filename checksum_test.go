@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestExpectedSHA256(t *testing.T) {
+	data := []byte("integrity matters")
+	sum := sha256.Sum256(data)
+	good := hex.EncodeToString(sum[:])
+
+	client := newFakeClient(map[string][]byte{"/remote/a.bin": data})
+	jobs := []FileJob{
+		{RemotePath: "/remote/a.bin", ID: "good", ExpectedSHA256: good},
+		{RemotePath: "/remote/a.bin", ID: "upper", ExpectedSHA256: strings.ToUpper(good)},
+		{RemotePath: "/remote/a.bin", ID: "bad", ExpectedSHA256: strings.Repeat("0", 64)},
+		{RemotePath: "/remote/a.bin", ID: "unchecked"},
+	}
+
+	transferred, errs := DefaultCfg().TransferFilesWithErrors(client, jobs, func(FileResult) error { return nil })
+	if transferred != 3 {
+		t.Errorf("expected 3 transfers, got %d", transferred)
+	}
+	if len(errs) != 1 || errs[0].ID != "bad" {
+		t.Fatalf("expected only bad to fail, got %v", errs)
+	}
+	if !errors.Is(errs[0], ErrChecksumMismatch) || errs[0].Stage != StageRead {
+		t.Errorf("expected a read-stage ErrChecksumMismatch, got %v", errs[0])
+	}
+}
+
+func TestComputeChecksum(t *testing.T) {
+	client := newFakeClient(map[string][]byte{
+		"/remote/a.bin": []byte("alpha"),
+		"/remote/b.bin": []byte("beta"),
+		"/remote/c.bin": {},
+	})
+	jobs := []FileJob{
+		{RemotePath: "/remote/a.bin", ID: "a"},
+		{RemotePath: "/remote/b.bin", ID: "b"},
+		{RemotePath: "/remote/c.bin", ID: "c"},
+	}
+
+	check := func(cfg PipelineCfg, want func(data []byte) string) {
+		t.Helper()
+		var mu sync.Mutex
+		got := map[string]FileResult{}
+		cfg.TransferFiles(client, jobs, func(r FileResult) error {
+			mu.Lock()
+			got[r.ID] = r
+			mu.Unlock()
+			return nil
+		})
+		for _, r := range got {
+			if w := want(r.Data); r.Checksum != w {
+				t.Errorf("%s: Checksum = %q, want %q", r.ID, r.Checksum, w)
+			}
+		}
+		if len(got) != len(jobs) {
+			t.Errorf("expected %d results, got %d", len(jobs), len(got))
+		}
+	}
+
+	cfg := DefaultCfg()
+	check(cfg, func([]byte) string { return "" })
+	cfg.ComputeChecksum = true
+	check(cfg, func(data []byte) string {
+		sum := sha256.Sum256(data)
+		return hex.EncodeToString(sum[:])
+	})
+}
+
+func TestChecksumAlgo(t *testing.T) {
+	vectors := []struct {
+		algo        ChecksumAlgo
+		abc, digits string
+	}{
+		{ChecksumSHA256, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", "15e2b0d3c33891ebb0f1ef609ec419420c20e320ce94c65fbc8c3312448eb225"},
+		{ChecksumMD5, "900150983cd24fb0d6963f7d28e17f72", "25f9e794323b453885f5181f1b624d0b"},
+		{ChecksumSHA1, "a9993e364706816aba3e25717850c26c9cd0d89d", "f7c3bc1d808e04732adf679965ccc34ca7ae3441"},
+		{ChecksumCRC32, "352441c2", "cbf43926"},
+	}
+	client := newFakeClient(map[string][]byte{
+		"/remote/abc.txt":    []byte("abc"),
+		"/remote/digits.txt": []byte("123456789"),
+	})
+	for _, v := range vectors {
+		t.Run(v.algo.String(), func(t *testing.T) {
+			jobs := []FileJob{
+				{RemotePath: "/remote/abc.txt", ID: "abc", ExpectedChecksum: v.abc},
+				{RemotePath: "/remote/digits.txt", ID: "digits", ExpectedChecksum: strings.ToUpper(v.digits)},
+				{RemotePath: "/remote/abc.txt", ID: "wrong", ExpectedChecksum: v.digits},
+			}
+			cfg := DefaultCfg()
+			cfg.ChecksumAlgo = v.algo
+			cfg.ComputeChecksum = true
+			results, errs := cfg.CollectFiles(client, jobs)
+			if len(errs) != 1 || errs[0].ID != "wrong" || !errors.Is(errs[0], ErrChecksumMismatch) {
+				t.Fatalf("expected only wrong to fail with ErrChecksumMismatch, got %v", errs)
+			}
+			want := map[string]string{"abc": v.abc, "digits": v.digits}
+			for _, r := range results {
+				if r.Checksum != want[r.ID] {
+					t.Errorf("%s: Checksum = %s, want %s", r.ID, r.Checksum, want[r.ID])
+				}
+			}
+		})
+	}
+}
+
+func TestChecksumAlgoWithExpectedSHA256(t *testing.T) {
+	client := newFakeClient(map[string][]byte{"/remote/abc.txt": []byte("abc")})
+	sha := "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	jobs := []FileJob{
+		{RemotePath: "/remote/abc.txt", ID: "both", ExpectedChecksum: "900150983cd24fb0d6963f7d28e17f72", ExpectedSHA256: sha},
+		{RemotePath: "/remote/abc.txt", ID: "badsha", ExpectedChecksum: "900150983cd24fb0d6963f7d28e17f72", ExpectedSHA256: strings.Repeat("0", 64)},
+	}
+	cfg := DefaultCfg()
+	cfg.ChecksumAlgo = ChecksumMD5
+	_, errs := cfg.CollectFiles(client, jobs)
+	if len(errs) != 1 || errs[0].ID != "badsha" || !errors.Is(errs[0], ErrChecksumMismatch) {
+		t.Fatalf("expected ExpectedSHA256 to still be checked, got %v", errs)
+	}
+}
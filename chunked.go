@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// defaultChunkParallelism is the number of chunks of one file read at once
+// when ChunkParallelism is unset.
+const defaultChunkParallelism = 4
+
+// chunkSize returns the size of job's file if it should be read in chunks:
+// ChunkSize is set, f supports ReadAt, the job reads the whole file rather
+// than a part of it, the file isn't one Decompress will gunzip or one that
+// will spill, and it is larger than one chunk. HeadBytes caps the size read.
+func (r *run) chunkSize(client SFTPClient, job FileJob, f io.Reader) (int64, bool) {
+	if r.cfg.ChunkSize <= 0 {
+		return 0, false
+	}
+	if _, ok := f.(io.ReaderAt); !ok || job.Offset > 0 || job.Length > 0 {
+		return 0, false
+	}
+	if r.cfg.Decompress && strings.HasSuffix(job.RemotePath, ".gz") {
+		return 0, false
+	}
+	info, err := statRemote(client, job.RemotePath)
+	if err != nil {
+		return 0, false
+	}
+	size := info.Size()
+	if r.cfg.HeadBytes > 0 {
+		size = min(size, r.cfg.HeadBytes)
+	}
+	if threshold := r.spillThreshold(); threshold > 0 && size > threshold {
+		return 0, false
+	}
+	return size, size > r.cfg.ChunkSize
+}
+
+// readChunks reads the first size bytes of f as ChunkSize pieces, up to
+// ChunkParallelism of them at once, each into its place in the result.
+func (r *run) readChunks(ctx context.Context, f io.ReaderAt, size int64, h *hasher) ([]byte, error) {
+	data := make([]byte, size)
+	parallelism := r.cfg.ChunkParallelism
+	if parallelism <= 0 {
+		parallelism = defaultChunkParallelism
+	}
+	offsets := make(chan int64)
+	var mu sync.Mutex
+	var firstErr error
+	var wg sync.WaitGroup
+	for range parallelism {
+		wg.Go(func() {
+			for off := range offsets {
+				chunk := data[off:min(off+r.cfg.ChunkSize, size)]
+				n, err := f.ReadAt(chunk, off)
+				if n == len(chunk) {
+					continue
+				}
+				if err == nil || errors.Is(err, io.EOF) {
+					err = io.ErrUnexpectedEOF
+				}
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = fmt.Errorf("chunk at %d: %w", off, err)
+				}
+				mu.Unlock()
+			}
+		})
+	}
+feed:
+	for off := int64(0); off < size; off += r.cfg.ChunkSize {
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed {
+			break
+		}
+		select {
+		case offsets <- off:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(offsets)
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if h != nil {
+		io.Copy(io.Discard, h.wrap(bytes.NewReader(data)))
+	}
+	return data, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+// readAtFile is a remote file that supports ReadAt, counting the calls and
+// the most that ran at once.
+type readAtFile struct {
+	io.ReadCloser
+	at     io.ReaderAt
+	client *readAtClient
+}
+
+func (f readAtFile) ReadAt(p []byte, off int64) (int, error) {
+	c := f.client
+	c.readAts.Add(1)
+	n := c.running.Add(1)
+	defer c.running.Add(-1)
+	c.mu.Lock()
+	c.peak = max(c.peak, n)
+	c.mu.Unlock()
+	return f.at.ReadAt(p, off)
+}
+
+type readAtClient struct {
+	*sftptest.FakeClient
+	readAts atomic.Int32
+	running atomic.Int32
+	mu      sync.Mutex
+	peak    int32
+}
+
+func (c *readAtClient) Open(path string) (io.ReadCloser, error) {
+	f, err := c.FakeClient.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return readAtFile{f, f.(io.ReaderAt), c}, nil
+}
+
+func TestChunkedRead(t *testing.T) {
+	big := make([]byte, 1<<20+123)
+	r := rand.New(rand.NewPCG(1, 2))
+	for i := range big {
+		big[i] = byte(r.Uint32())
+	}
+	client := &readAtClient{FakeClient: sftptest.NewFakeClient()}
+	client.Add("/remote/big.bin", sftptest.File{Data: big, Seekable: true})
+	client.Add("/remote/small.bin", sftptest.File{Data: []byte("small"), Seekable: true})
+	jobs := []FileJob{{RemotePath: "/remote/big.bin", ID: "big"}, {RemotePath: "/remote/small.bin", ID: "small"}}
+
+	results := func(cfg PipelineCfg) map[string]FileResult {
+		got := map[string]FileResult{}
+		var mu sync.Mutex
+		stats, err := cfg.TransferFilesStats(context.Background(), client, jobs, func(res FileResult) error {
+			mu.Lock()
+			defer mu.Unlock()
+			got[res.ID] = res
+			return nil
+		})
+		if err != nil || stats.Transferred != 2 {
+			t.Fatalf("expected both files, got %+v, %v", stats, err)
+		}
+		return got
+	}
+
+	cfg := PipelineCfg{SFTPReaders: 2, Workers: 2, BufferSize: 2, ComputeChecksum: true}
+	sequential := results(cfg)
+	if client.readAts.Load() != 0 {
+		t.Fatalf("expected no ReadAt without ChunkSize")
+	}
+
+	cfg.ChunkSize, cfg.ChunkParallelism = 64<<10, 4
+	chunked := results(cfg)
+	for _, id := range []string{"big", "small"} {
+		if !bytes.Equal(chunked[id].Data, sequential[id].Data) || chunked[id].Checksum != sequential[id].Checksum {
+			t.Errorf("%s: chunked read differs from the sequential one", id)
+		}
+	}
+	if !bytes.Equal(chunked["big"].Data, big) {
+		t.Error("big: content mismatch")
+	}
+	// 17 chunks of the big file; the small one is read in one pass
+	if n := client.readAts.Load(); n != 17 {
+		t.Errorf("expected 17 ReadAts, got %d", n)
+	}
+	if client.peak > 4 {
+		t.Errorf("expected at most 4 chunks at once, got %d", client.peak)
+	}
+
+	cfg.HeadBytes = 100 << 10
+	if got := results(cfg)["big"].Data; !bytes.Equal(got, big[:100<<10]) {
+		t.Errorf("expected the first %d bytes under HeadBytes, got %d", 100<<10, len(got))
+	}
+}
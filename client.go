@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pkg/sftp"
+)
+
+// SFTPClient is what the pipeline needs from an SFTP connection. Use
+// WrapSFTPClient for a *sftp.Client, or supply your own implementation to
+// mock or instrument the connection.
+type SFTPClient interface {
+	Open(path string) (io.ReadCloser, error)
+}
+
+// statter is implemented by clients that can stat remote files, which some
+// options need.
+type statter interface {
+	Stat(path string) (os.FileInfo, error)
+}
+
+// statRemote stats path through client, failing with errors.ErrUnsupported
+// if the client can't.
+func statRemote(client SFTPClient, path string) (os.FileInfo, error) {
+	s, ok := client.(statter)
+	if !ok {
+		return nil, fmt.Errorf("%T has no Stat method: %w", client, errors.ErrUnsupported)
+	}
+	return s.Stat(path)
+}
+
+// WrapSFTPClient adapts c to SFTPClient. *sftp.Client can't satisfy it
+// directly because its Open returns *sftp.File rather than io.ReadCloser.
+func WrapSFTPClient(c *sftp.Client) SFTPClient {
+	return sftpAdapter{c}
+}
+
+// sftpAdapter adapts *sftp.Client, whose methods return *sftp.File, to the
+// package's io-based interfaces. The embedded client supplies the rest.
+type sftpAdapter struct{ *sftp.Client }
+
+func (a sftpAdapter) Open(path string) (io.ReadCloser, error) {
+	return a.Client.Open(path)
+}
+
+func (a sftpAdapter) Create(path string) (io.WriteCloser, error) {
+	return a.Client.Create(path)
+}
@@ -0,0 +1,32 @@
+package main
+
+import "context"
+
+// CollectFiles reads every job into memory and returns the results of the
+// files transferred, in input order, along with a TransferError for each
+// failure. It suits batches small enough to hold at once.
+func (cfg PipelineCfg) CollectFiles(sftpClient SFTPClient, jobs []FileJob) ([]FileResult, []TransferError) {
+	// Results outlive the run, and spill files don't
+	cfg.SpillThreshold = 0
+	var list errorList
+	// Every job finishes at most once, so each slot has a single writer
+	results := make([]FileResult, len(jobs))
+	done := make([]bool, len(jobs))
+	cfg.transfer(context.Background(), []SFTPClient{sftpClient}, fromSlice(jobs), func(FileResult) error { return nil }, hooks{
+		onError: list.add,
+		onDone: func(read fileRead, err error) {
+			if err == nil {
+				results[read.index] = read.result
+				done[read.index] = true
+			}
+		},
+	})
+
+	collected := results[:0]
+	for i, r := range results {
+		if done[i] {
+			collected = append(collected, r)
+		}
+	}
+	return collected, list.errs
+}
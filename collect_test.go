@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+func TestCollectFiles(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	jobs := fileJobs(client, 50, dataFile)
+	client.Delete(jobs[17].RemotePath)
+
+	cfg := DefaultCfg()
+	// Ignored, as spill files are removed before CollectFiles returns
+	cfg.SpillThreshold = 4
+	results, errs := cfg.CollectFiles(client, jobs)
+	if len(errs) != 1 || errs[0].ID != "id_17" {
+		t.Fatalf("expected only id_17 to fail, got %v", errs)
+	}
+	if len(results) != 49 {
+		t.Fatalf("expected 49 results, got %d", len(results))
+	}
+	i := 0
+	for _, job := range jobs {
+		if job.ID == "id_17" {
+			continue
+		}
+		r := results[i]
+		if r.ID != job.ID || string(r.Data) != "data" {
+			t.Errorf("result %d: expected %s with its data, got %s %q", i, job.ID, r.ID, r.Data)
+		}
+		i++
+	}
+}
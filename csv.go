@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// csvHeader is the header row ResultsToCSV writes, named like the JSON keys
+// of ManifestEntry.
+var csvHeader = []string{"id", "remote_path", "bytes", "checksum", "status", "error"}
+
+// JobsFromCSV reads jobs from CSV, taking each job's RemotePath from column
+// pathCol and its ID from column idCol, both counted from 0. A negative
+// idCol uses the path as the ID. The first row is a header and is skipped.
+// Rows may have any number of columns, but a row without pathCol or idCol,
+// or with an empty path, fails with an error naming its line.
+func JobsFromCSV(r io.Reader, pathCol, idCol int) ([]FileJob, error) {
+	if pathCol < 0 {
+		return nil, fmt.Errorf("path column %d out of range", pathCol)
+	}
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	if _, err := cr.Read(); err == io.EOF {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var jobs []FileJob
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return jobs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		if pathCol >= len(record) || idCol >= len(record) {
+			return nil, fmt.Errorf("line %d: %d columns, need %d", line, len(record), max(pathCol, idCol)+1)
+		}
+		job := FileJob{RemotePath: record[pathCol], ID: record[pathCol]}
+		if idCol >= 0 {
+			job.ID = record[idCol]
+		}
+		if job.RemotePath == "" {
+			return nil, fmt.Errorf("line %d: empty path", line)
+		}
+		jobs = append(jobs, job)
+	}
+}
+
+// ResultsToCSV writes entries as CSV under a header row of id, remote_path,
+// bytes, checksum, status and error. The path is column 1 and the ID column
+// 0, so JobsFromCSV(r, 1, 0) reads the jobs back, for example to retry
+// the failed ones.
+func ResultsToCSV(w io.Writer, entries []ManifestEntry) error {
+	cw := csv.NewWriter(w)
+	cw.Write(csvHeader)
+	for _, e := range entries {
+		cw.Write([]string{e.ID, e.RemotePath, strconv.FormatInt(e.Bytes, 10), e.Checksum, e.Status, e.Error})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJobsFromCSV(t *testing.T) {
+	in := "name,size,remote\n" +
+		"a,1,/exports/a.csv\n" +
+		"\"b, the second\",2,\"/exports/b \"\"quoted\"\".csv\"\n" +
+		"c,3,/exports/c.csv,extra\n"
+	jobs, err := JobsFromCSV(strings.NewReader(in), 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FileJob{
+		{RemotePath: "/exports/a.csv", ID: "a"},
+		{RemotePath: `/exports/b "quoted".csv`, ID: "b, the second"},
+		{RemotePath: "/exports/c.csv", ID: "c"},
+	}
+	if !reflect.DeepEqual(jobs, want) {
+		t.Errorf("JobsFromCSV:\n got %v\nwant %v", jobs, want)
+	}
+
+	// Without an ID column the path is the ID
+	jobs, err = JobsFromCSV(strings.NewReader("path\n/x.csv\n"), 0, -1)
+	if err != nil || len(jobs) != 1 || jobs[0].ID != "/x.csv" {
+		t.Errorf("expected the path as ID, got %v, %v", jobs, err)
+	}
+	for _, bad := range []string{"h\n/a\n", "h,h\n,a\n"} {
+		if _, err := JobsFromCSV(strings.NewReader(bad), 0, 1); err == nil || !strings.Contains(err.Error(), "line 2") {
+			t.Errorf("expected %q to fail on line 2, got %v", bad, err)
+		}
+	}
+}
+
+func TestResultsToCSV(t *testing.T) {
+	client := newFakeClient(map[string][]byte{"/remote/a.bin": []byte("alpha")})
+	jobs := []FileJob{
+		{RemotePath: "/remote/a.bin", ID: "a"},
+		{RemotePath: "/remote/missing.bin", ID: "missing, really"},
+		{RemotePath: "/remote/a.bin", ID: "skipped"},
+	}
+	entries, err := DefaultCfg().TransferFilesManifest(context.Background(), client, jobs, func(r FileResult) error {
+		if r.ID == "skipped" {
+			return ErrSkip
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := ResultsToCSV(&buf, entries); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 || lines[0] != "id,remote_path,bytes,checksum,status,error" {
+		t.Fatalf("unexpected CSV:\n%s", buf.String())
+	}
+	if !strings.HasPrefix(lines[1], "a,/remote/a.bin,5,") || !strings.HasSuffix(lines[1], ",transferred,") {
+		t.Errorf("unexpected row for a: %s", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], `"missing, really",/remote/missing.bin,0,,failed,`) {
+		t.Errorf("unexpected row for missing: %s", lines[2])
+	}
+	if !strings.Contains(lines[3], ",skipped,") {
+		t.Errorf("unexpected row for skipped: %s", lines[3])
+	}
+
+	// The results read back as the jobs they came from
+	back, err := JobsFromCSV(&buf, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(back, jobs) {
+		t.Errorf("round trip:\n got %v\nwant %v", back, jobs)
+	}
+
+	if err := ResultsToCSV(&failingWriter{}, entries); err == nil {
+		t.Error("expected a write error")
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// DedupeMode controls what happens to jobs that repeat a RemotePath.
+type DedupeMode int
+
+const (
+	// DedupeOff reads every job, duplicates included.
+	DedupeOff DedupeMode = iota
+	// DedupeFirst reads each path once, for whichever of its jobs starts
+	// first, and skips the others.
+	DedupeFirst
+	// DedupeFanOut reads each path once and delivers the result to the
+	// process function for every job with that path, under each job's own
+	// ID, when the first of them is processed. It needs the jobs as a slice,
+	// and the streaming variants treat it as DedupeFirst.
+	DedupeFanOut
+)
+
+var (
+	// errDuplicate fails a job whose path another job is reading.
+	errDuplicate = fmt.Errorf("%w: duplicate remote path", ErrSkip)
+	// errFannedOut marks a duplicate that is delivered with the first job
+	// of its path instead of on its own.
+	errFannedOut = errors.New("delivered with an earlier job of the same path")
+)
+
+// dedupe tracks the paths of a run's jobs. A nil *dedupe never finds a
+// duplicate.
+type dedupe struct {
+	mu   sync.Mutex
+	seen map[string]bool
+	// groups holds, in input order, the jobs of every path that appears
+	// more than once in a DedupeFanOut run.
+	groups map[string][]queued[FileJob]
+	n      atomic.Int32
+}
+
+// newDedupe sets up dedupe for cfg.Dedupe. DedupeFanOut scans every job up
+// front, so jobs must come from a slice unless fanOut is false.
+func (cfg PipelineCfg) newDedupe(ctx context.Context, jobs source[FileJob], fanOut bool) (*dedupe, error) {
+	switch {
+	case cfg.Dedupe == DedupeOff:
+		return nil, nil
+	case cfg.Dedupe == DedupeFirst || !fanOut:
+		return &dedupe{seen: make(map[string]bool)}, nil
+	case jobs.slice == nil:
+		return nil, errors.New("DedupeFanOut needs a slice of jobs")
+	}
+
+	groups := make(map[string][]queued[FileJob])
+	i := 0
+	for job := range jobs.jobs(ctx) {
+		groups[job.RemotePath] = append(groups[job.RemotePath], queued[FileJob]{index: jobs.index(i), job: job})
+		i++
+	}
+	for path, group := range groups {
+		if len(group) == 1 {
+			delete(groups, path)
+		}
+	}
+	return &dedupe{groups: groups}, nil
+}
+
+// duplicate returns errDuplicate or errFannedOut if q shouldn't be read
+// because another job reads its path.
+func (d *dedupe) duplicate(q queued[FileJob]) error {
+	if d == nil {
+		return nil
+	}
+	if d.groups != nil {
+		if group := d.groups[q.job.RemotePath]; len(group) > 0 && group[0].index != q.index {
+			return errFannedOut
+		}
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.seen[q.job.RemotePath] {
+		d.n.Add(1)
+		return errDuplicate
+	}
+	d.seen[q.job.RemotePath] = true
+	return nil
+}
+
+// fanOut returns read followed, in DedupeFanOut mode, by a copy of it for
+// each later job with the same path.
+func (d *dedupe) fanOut(read fileRead) []fileRead {
+	if d == nil || d.groups == nil {
+		return []fileRead{read}
+	}
+	group := d.groups[read.job.RemotePath]
+	if len(group) == 0 {
+		return []fileRead{read}
+	}
+	reads := []fileRead{read}
+	for _, q := range group[1:] {
+		dup := read
+		dup.index, dup.job = q.index, q.job
+		dup.result.ID, dup.result.Meta = q.job.ID, q.job.Meta
+		dup.span = noSpan
+		reads = append(reads, dup)
+	}
+	d.n.Add(int32(len(group) - 1))
+	return reads
+}
+
+// count is the number of jobs that didn't need a read of their own.
+func (d *dedupe) count() int32 {
+	if d == nil {
+		return 0
+	}
+	return d.n.Load()
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"io"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+func dedupeJobs() ([]FileJob, *sftptest.FakeClient) {
+	client := newFakeClient(map[string][]byte{
+		"/remote/a.bin": []byte("alpha"),
+		"/remote/b.bin": []byte("beta"),
+	})
+	jobs := []FileJob{
+		{RemotePath: "/remote/a.bin", ID: "a1"},
+		{RemotePath: "/remote/b.bin", ID: "b1"},
+		{RemotePath: "/remote/a.bin", ID: "a2"},
+		{RemotePath: "/remote/missing.bin", ID: "m1"},
+		{RemotePath: "/remote/a.bin", ID: "a3"},
+		{RemotePath: "/remote/missing.bin", ID: "m2"},
+	}
+	return jobs, client
+}
+
+func TestDedupeFirst(t *testing.T) {
+	jobs, client := dedupeJobs()
+	cfg := DefaultCfg()
+	cfg.Dedupe = DedupeFirst
+	var mu sync.Mutex
+	var paths []string
+	stats, err := cfg.TransferFilesStats(context.Background(), client, jobs, func(r FileResult) error {
+		mu.Lock()
+		paths = append(paths, string(r.Data))
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := opened(client, jobs); n != 3 {
+		t.Errorf("expected one open per path, got %d", n)
+	}
+	slices.Sort(paths)
+	if !slices.Equal(paths, []string{"alpha", "beta"}) {
+		t.Errorf("expected each file processed once, got %q", paths)
+	}
+	if stats.Transferred != 2 || stats.Failed != 1 || stats.Skipped != 3 || stats.Deduped != 3 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	// Downloads to disk skip duplicates the same way
+	before := opened(client, jobs)
+	transferred, failed, skipped := cfg.TransferFilesToDir(client, jobs, t.TempDir())
+	if n := opened(client, jobs) - before; transferred != 2 || failed != 1 || skipped != 3 || n != 3 {
+		t.Errorf("TransferFilesToDir: %d transferred, %d failed, %d skipped, %d opens", transferred, failed, skipped, n)
+	}
+}
+
+func TestDedupeFanOut(t *testing.T) {
+	jobs, client := dedupeJobs()
+	cfg := DefaultCfg()
+	cfg.Dedupe = DedupeFanOut
+	var mu sync.Mutex
+	got := map[string]string{}
+	manifest, err := cfg.TransferFilesManifest(context.Background(), client, jobs, func(r FileResult) error {
+		mu.Lock()
+		got[r.ID] = string(r.Data)
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := opened(client, jobs); n != 3 {
+		t.Errorf("expected one open per path, got %d", n)
+	}
+	want := map[string]string{"a1": "alpha", "a2": "alpha", "a3": "alpha", "b1": "beta"}
+	if len(got) != len(want) {
+		t.Errorf("expected deliveries to %v, got %v", want, got)
+	}
+	for id, data := range want {
+		if got[id] != data {
+			t.Errorf("%s: got %q, want %q", id, got[id], data)
+		}
+	}
+	// Every job gets its own outcome, duplicates of the missing file
+	// included
+	if len(manifest) != len(jobs) {
+		t.Fatalf("expected %d manifest entries, got %d", len(jobs), len(manifest))
+	}
+	for i, e := range manifest {
+		wantStatus := StatusTransferred
+		if jobs[i].RemotePath == "/remote/missing.bin" {
+			wantStatus = StatusFailed
+		}
+		if e.ID != jobs[i].ID || e.Status != wantStatus {
+			t.Errorf("entry %d = %+v, want %s %s", i, e, jobs[i].ID, wantStatus)
+		}
+	}
+}
+
+func TestDedupeFanOutNeedsSlice(t *testing.T) {
+	jobs, client := dedupeJobs()
+	cfg := DefaultCfg()
+	cfg.Dedupe = DedupeFanOut
+	if _, err := cfg.TransferFilesSeq(context.Background(), client, slices.Values(jobs), func(FileResult) error { return nil }); err == nil {
+		t.Error("expected DedupeFanOut to be rejected for an iterator")
+	}
+
+	// The streaming variants fall back to DedupeFirst
+	transferred, failed := cfg.TransferFilesStreaming(client, jobs, func(string, io.Reader) error { return nil })
+	if transferred != 2 || failed != 1 {
+		t.Errorf("streaming: %d transferred, %d failed", transferred, failed)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// JobsFromDiff plans a mirror of remoteRoot into localRoot: it walks the
+// remote tree as JobsFromDir does and returns jobs only for the files that
+// are missing locally, differ in size from their local copy, or were
+// modified remotely after it. A job's local copy is at SafeJoin(localRoot,
+// job.ID), which is where TransferFilesToDir puts it.
+func JobsFromDiff(client DirReader, remoteRoot, localRoot string) ([]FileJob, error) {
+	return WalkOptions{}.JobsFromDiff(client, remoteRoot, localRoot)
+}
+
+// JobsFromDiff is the package-level JobsFromDiff restricted by opts.
+func (opts WalkOptions) JobsFromDiff(client DirReader, remoteRoot, localRoot string) ([]FileJob, error) {
+	return opts.walk(client, remoteRoot, func(job FileJob, remote os.FileInfo) (bool, error) {
+		local, err := SafeJoin(localRoot, job.ID)
+		if err != nil {
+			return false, err
+		}
+		return outdated(local, remote)
+	})
+}
+
+// outdated reports whether the local file needs to be fetched again to
+// match remote.
+func outdated(local string, remote os.FileInfo) (bool, error) {
+	info, err := os.Stat(local)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return true, nil
+	case err != nil:
+		return false, err
+	}
+	return !info.Mode().IsRegular() || info.Size() != remote.Size() || remote.ModTime().After(info.ModTime()), nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestJobsFromDiff(t *testing.T) {
+	synced := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	client := &mapFSClient{fsys: fstest.MapFS{
+		"data/same.csv":        {Data: []byte("same"), ModTime: synced.Add(-time.Hour)},
+		"data/resized.csv":     {Data: []byte("longer now"), ModTime: synced.Add(-time.Hour)},
+		"data/touched.csv":     {Data: []byte("touched"), ModTime: synced.Add(time.Hour)},
+		"data/new.csv":         {Data: []byte("new"), ModTime: synced.Add(-time.Hour)},
+		"data/sub/nested.csv":  {Data: []byte("nested"), ModTime: synced.Add(-time.Hour)},
+		"data/sub/current.csv": {Data: []byte("current"), ModTime: synced.Add(-time.Hour)},
+		"data/dir.csv":         {Data: []byte("dir"), ModTime: synced.Add(-time.Hour)},
+	}}
+
+	local := t.TempDir()
+	write := func(name, data string) {
+		p := filepath.Join(local, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, synced, synced); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("same.csv", "same")
+	write("resized.csv", "short")
+	write("touched.csv", "touched")
+	write("sub/current.csv", "current")
+	if err := os.Mkdir(filepath.Join(local, "dir.csv"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err := JobsFromDiff(client, "/data", local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FileJob{
+		{RemotePath: "/data/dir.csv", ID: "dir.csv"},
+		{RemotePath: "/data/new.csv", ID: "new.csv"},
+		{RemotePath: "/data/resized.csv", ID: "resized.csv"},
+		{RemotePath: "/data/sub/nested.csv", ID: "sub/nested.csv"},
+		{RemotePath: "/data/touched.csv", ID: "touched.csv"},
+	}
+	if !reflect.DeepEqual(jobs, want) {
+		t.Errorf("JobsFromDiff:\n got %v\nwant %v", jobs, want)
+	}
+
+	// Against a local root that doesn't exist yet, everything is new
+	jobs, err = WalkOptions{Include: []string{"*.csv"}}.JobsFromDiff(client, "/data", filepath.Join(local, "missing"))
+	if err != nil || len(jobs) != 7 {
+		t.Errorf("expected every file against an empty mirror, got %v, %v", jobs, err)
+	}
+}
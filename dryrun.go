@@ -0,0 +1,18 @@
+package main
+
+import "errors"
+
+// plan stats job's file for a DryRun and logs it, returning its size. A
+// client without Stat lists the file with a size of 0.
+func (r *run) plan(client SFTPClient, job FileJob) (int64, error) {
+	var size int64
+	fi, err := statRemote(client, job.RemotePath)
+	switch {
+	case err == nil:
+		size = fi.Size()
+	case !errors.Is(err, errors.ErrUnsupported):
+		return 0, err
+	}
+	r.cfg.logger().Printf("Dry run: would transfer %s (%d bytes)\n", job.RemotePath, size)
+	return size, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	client := newFakeClient(map[string][]byte{
+		"/remote/a.bin": make([]byte, 100),
+		"/remote/b.bin": make([]byte, 250),
+	})
+	jobs := []FileJob{
+		{RemotePath: "/remote/a.bin", ID: "a"},
+		{RemotePath: "/remote/b.bin", ID: "b"},
+		{RemotePath: "/remote/missing.bin", ID: "missing"},
+	}
+
+	logger := &recordingLogger{}
+	cfg := DefaultCfg()
+	cfg.DryRun = true
+	cfg.Logger = logger
+	var processed atomic.Int32
+	stats, err := cfg.TransferFilesStats(context.Background(), client, jobs, func(FileResult) error {
+		processed.Add(1)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := opened(client, jobs); n != 0 {
+		t.Errorf("dry run opened %d files", n)
+	}
+	if n := processed.Load(); n != 0 {
+		t.Errorf("dry run processed %d files", n)
+	}
+	if !stats.DryRun || stats.Transferred != 2 || stats.Failed != 1 || stats.TotalBytes != 350 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	log := strings.Join(logger.lines, "\n")
+	for _, want := range []string{"/remote/a.bin (100 bytes)", "/remote/b.bin (250 bytes)"} {
+		if !strings.Contains(log, want) {
+			t.Errorf("log is missing %q:\n%s", want, log)
+		}
+	}
+
+	// Downloads to disk are planned the same way
+	transferred, failed, _ := cfg.TransferFilesToDir(client, jobs, t.TempDir())
+	if n := opened(client, jobs); transferred != 2 || failed != 1 || n != 0 {
+		t.Errorf("TransferFilesToDir dry run: %d transferred, %d failed, %d opens", transferred, failed, n)
+	}
+}
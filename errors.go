@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrFileTimeout is wrapped by the error of a file that exceeded
+// PerFileTimeout.
+var ErrFileTimeout = errors.New("per-file timeout exceeded")
+
+// ErrStopped is returned by a run that was shut down through
+// PipelineCfg.Stop before every job started.
+var ErrStopped = errors.New("transfer stopped before all jobs started")
+
+// errDeadline is the cancellation cause of a run that hit PipelineCfg.Deadline.
+var errDeadline = errors.New("transfer deadline exceeded")
+
+// ErrProcessTimeout is wrapped by the error of a file whose processing
+// exceeded ProcessTimeout.
+var ErrProcessTimeout = errors.New("process timeout exceeded")
+
+// ErrChecksumMismatch is wrapped by the error of a file whose content doesn't
+// match FileJob.ExpectedSHA256 or ExpectedChecksum.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// ErrDecompress is wrapped by the error of a file that Decompress couldn't
+// gunzip.
+var ErrDecompress = errors.New("decompression failed")
+
+// ErrUnsafePath is wrapped by the error of a job whose local destination
+// would fall outside the destination directory.
+var ErrUnsafePath = errors.New("unsafe local path")
+
+// ErrPanic is wrapped by the error of a job whose ProcessFunc or
+// StreamProcessFunc panicked under RecoverPanics.
+var ErrPanic = errors.New("process function panicked")
+
+// ErrRetryProcess may be returned, possibly wrapped, by a ProcessFunc to have
+// it called again with the same FileResult, under the RetryPolicy, instead
+// of failing the file.
+var ErrRetryProcess = errors.New("retry processing")
+
+// ErrCircuitBreakerTripped is wrapped, with the failure that tripped it, by
+// the error of a run stopped by MaxFailures.
+var ErrCircuitBreakerTripped = errors.New("circuit breaker tripped")
+
+// ErrStalled is wrapped by the error of a file whose read throughput fell
+// below MinThroughputBytesPerSec.
+var ErrStalled = errors.New("read throughput too low")
+
+// ErrOffset is wrapped by the error of a job whose FileJob.Offset is past
+// the end of its file.
+var ErrOffset = errors.New("offset past end of file")
+
+// ErrSkip may be returned, possibly wrapped, by a ProcessFunc or
+// StreamProcessFunc to count a file as skipped rather than failed.
+var ErrSkip = errors.New("skipped")
+
+// Stage is the pipeline step at which a job failed.
+type Stage int
+
+const (
+	StageOpen Stage = iota
+	StageRead
+	StageProcess
+	StageStat
+)
+
+func (s Stage) String() string {
+	switch s {
+	case StageOpen:
+		return "open"
+	case StageRead:
+		return "read"
+	case StageProcess:
+		return "process"
+	case StageStat:
+		return "stat"
+	}
+	return fmt.Sprintf("Stage(%d)", int(s))
+}
+
+// TransferError records why a single job failed.
+type TransferError struct {
+	ID         string
+	RemotePath string
+	Stage      Stage
+	// Kind classifies Err; see KindOf.
+	Kind ErrorKind
+	Err  error
+}
+
+func (e TransferError) Error() string {
+	return fmt.Sprintf("%s %s (%s): %v", e.Stage, e.RemotePath, e.ID, e.Err)
+}
+
+func (e TransferError) Unwrap() error { return e.Err }
+
+// errorList collects TransferErrors from many goroutines.
+type errorList struct {
+	mu   sync.Mutex
+	errs []TransferError
+}
+
+func (l *errorList) add(e TransferError) {
+	l.mu.Lock()
+	l.errs = append(l.errs, e)
+	l.mu.Unlock()
+}
+
+// TransferFilesWithErrors is TransferFiles reporting which jobs failed and at
+// which stage instead of only a count.
+func (cfg PipelineCfg) TransferFilesWithErrors(sftpClient SFTPClient, jobs []FileJob, processFunc ProcessFunc) (transferred int32, errs []TransferError) {
+	var list errorList
+	stats, _ := cfg.transfer(context.Background(), []SFTPClient{sftpClient}, fromSlice(jobs), processFunc, hooks{onError: list.add})
+	return stats.Transferred, list.errs
+}
+
+// TransferFilesE runs the whole transfer and returns nil only if every job
+// succeeded or was skipped. Otherwise the error joins the run's own error, if
+// any, and a TransferError per failed job, so errors.Is and errors.As see
+// through to each failure.
+func (cfg PipelineCfg) TransferFilesE(ctx context.Context, sftpClient SFTPClient, jobs []FileJob, processFunc ProcessFunc) error {
+	var list errorList
+	_, err := cfg.transfer(ctx, []SFTPClient{sftpClient}, fromSlice(jobs), processFunc, hooks{onError: list.add})
+	errs := []error{err}
+	for _, e := range list.errs {
+		errs = append(errs, e)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+func TestTransferFilesWithErrorsStages(t *testing.T) {
+	errBroken := errors.New("connection reset")
+	errReject := errors.New("rejected")
+	client := newFakeClient(map[string][]byte{
+		"/remote/ok.bin":     []byte("ok"),
+		"/remote/reject.bin": []byte("bad"),
+	})
+	client.Add("/remote/broken.bin", sftptest.File{Data: []byte("par"), ReadErr: errBroken, FailAfter: 3})
+	jobs := []FileJob{
+		{RemotePath: "/remote/ok.bin", ID: "ok"},
+		{RemotePath: "/remote/missing.bin", ID: "missing"},
+		{RemotePath: "/remote/broken.bin", ID: "broken"},
+		{RemotePath: "/remote/reject.bin", ID: "reject"},
+	}
+	processFunc := func(result FileResult) error {
+		if result.ID == "reject" {
+			return errReject
+		}
+		return nil
+	}
+
+	transferred, errs := DefaultCfg().TransferFilesWithErrors(client, jobs, processFunc)
+	if transferred != 1 {
+		t.Errorf("expected 1 transfer, got %d", transferred)
+	}
+	if len(errs) != 3 {
+		t.Fatalf("expected 3 errors, got %d: %v", len(errs), errs)
+	}
+
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Stage < errs[j].Stage })
+	want := []struct {
+		id    string
+		stage Stage
+	}{
+		{"missing", StageOpen},
+		{"broken", StageRead},
+		{"reject", StageProcess},
+	}
+	for i, w := range want {
+		if errs[i].ID != w.id || errs[i].Stage != w.stage {
+			t.Errorf("errs[%d] = %s/%s, want %s/%s", i, errs[i].ID, errs[i].Stage, w.id, w.stage)
+		}
+	}
+	if !errors.Is(errs[1], errBroken) {
+		t.Errorf("read error does not wrap the underlying error: %v", errs[1])
+	}
+	if !errors.Is(errs[2], errReject) {
+		t.Errorf("process error does not wrap the underlying error: %v", errs[2])
+	}
+}
+
+func TestTransferFilesE(t *testing.T) {
+	errBroken := errors.New("connection reset")
+	errReject := errors.New("rejected")
+	client := newFakeClient(map[string][]byte{
+		"/remote/ok.bin":     []byte("ok"),
+		"/remote/reject.bin": []byte("bad"),
+	})
+	client.Add("/remote/broken.bin", sftptest.File{Data: []byte("par"), ReadErr: errBroken, FailAfter: 3})
+	jobs := []FileJob{
+		{RemotePath: "/remote/ok.bin", ID: "ok"},
+		{RemotePath: "/remote/missing.bin", ID: "missing"},
+		{RemotePath: "/remote/broken.bin", ID: "broken"},
+		{RemotePath: "/remote/reject.bin", ID: "reject"},
+	}
+	processFunc := func(result FileResult) error {
+		if result.ID == "reject" {
+			return errReject
+		}
+		return nil
+	}
+
+	err := DefaultCfg().TransferFilesE(context.Background(), client, jobs, processFunc)
+	if !errors.Is(err, errBroken) || !errors.Is(err, errReject) {
+		t.Errorf("expected the joined error to wrap each failure, got %v", err)
+	}
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok || len(joined.Unwrap()) != 3 {
+		t.Fatalf("expected 3 joined errors, got %v", err)
+	}
+	ids := map[string]bool{}
+	for _, e := range joined.Unwrap() {
+		var terr TransferError
+		if !errors.As(e, &terr) {
+			t.Fatalf("expected a TransferError, got %v", e)
+		}
+		ids[terr.ID] = true
+	}
+	if !ids["missing"] || !ids["broken"] || !ids["reject"] {
+		t.Errorf("expected missing, broken and reject to fail, got %v", ids)
+	}
+
+	if err := DefaultCfg().TransferFilesE(context.Background(), client, jobs[:1], processFunc); err != nil {
+		t.Errorf("expected nil for a clean run, got %v", err)
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// TransferFilesFailedJobs is TransferFilesStats also returning the jobs that
+// failed, after any retries, in the order they failed, so they can be
+// passed straight back to another run or saved with WriteJobs. Skipped jobs
+// and jobs a cancelled run never finished aren't included.
+func (cfg PipelineCfg) TransferFilesFailedJobs(ctx context.Context, sftpClient SFTPClient, jobs []FileJob, processFunc ProcessFunc) (TransferStats, []FileJob, error) {
+	var mu sync.Mutex
+	var failed []FileJob
+	stats, err := cfg.transfer(ctx, []SFTPClient{sftpClient}, fromSlice(jobs), processFunc, hooks{
+		onDone: func(read fileRead, err error) {
+			if err == nil || errors.Is(err, ErrSkip) {
+				return
+			}
+			mu.Lock()
+			failed = append(failed, read.job)
+			mu.Unlock()
+		},
+	})
+	return stats, failed, err
+}
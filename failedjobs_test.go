@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+func TestTransferFilesFailedJobs(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	var jobs []FileJob
+	add := func(name string, f sftptest.File) {
+		path := "/remote/" + name
+		client.Add(path, f)
+		jobs = append(jobs, FileJob{RemotePath: path, ID: name, Meta: map[string]string{"name": name}})
+	}
+	for i := 0; i < 5; i++ {
+		add(fmt.Sprintf("ok%d", i), sftptest.File{Data: []byte("data")})
+	}
+	// Recovers on retry, so it doesn't count as failed
+	add("flaky", sftptest.File{Data: []byte("data"), FailOpens: 1})
+	add("broken", sftptest.File{OpenErr: errors.New("permission denied")})
+	add("rejected", sftptest.File{Data: []byte("bad")})
+	add("skipped", sftptest.File{Data: []byte("skip")})
+	// Never added to the client, so its open fails
+	jobs = append(jobs, FileJob{RemotePath: "/remote/missing", ID: "missing"})
+
+	cfg := DefaultCfg()
+	cfg.RetryPolicy = RetryPolicy{MaxRetries: 2, BackoffBase: time.Millisecond}
+	stats, failed, err := cfg.TransferFilesFailedJobs(t.Context(), client, jobs, func(r FileResult) error {
+		switch string(r.Data) {
+		case "bad":
+			return errors.New("invalid record")
+		case "skip":
+			return ErrSkip
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Transferred != 6 || stats.Failed != 3 || stats.Skipped != 1 {
+		t.Fatalf("expected 6 transferred, 3 failed and 1 skipped, got %+v", stats)
+	}
+	var ids []string
+	for _, job := range failed {
+		ids = append(ids, job.ID)
+		if job.ID != "missing" && job.Meta["name"] != job.ID {
+			t.Errorf("%s: expected the job returned as given, got %+v", job.ID, job)
+		}
+	}
+	slices.Sort(ids)
+	if want := []string{"broken", "missing", "rejected"}; !slices.Equal(ids, want) {
+		t.Errorf("expected failed jobs %v, got %v", want, ids)
+	}
+
+	// The list feeds straight into another run, or through a file
+	var buf bytes.Buffer
+	if err := WriteJobs(&buf, failed); err != nil {
+		t.Fatal(err)
+	}
+	again, err := JobsFromReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again) != len(failed) {
+		t.Fatalf("expected %d jobs read back, got %d", len(failed), len(again))
+	}
+	for i, job := range again {
+		if job.RemotePath != failed[i].RemotePath || job.ID != failed[i].ID {
+			t.Errorf("job %d: wrote %+v, read back %+v", i, failed[i], job)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// failFast stops new jobs from starting once a run has more than limit
+// failures, recording why. A limit of 0 is FailFast; a positive one is the
+// MaxFailures circuit breaker. A nil *failFast does nothing.
+type failFast struct {
+	mu       sync.Mutex
+	limit    int
+	failures int
+	err      error
+	stop     context.CancelFunc
+}
+
+// newFailFast returns nil unless cfg.FailFast or cfg.MaxFailures is set.
+// FailFast takes precedence.
+func (cfg PipelineCfg) newFailFast() *failFast {
+	switch {
+	case cfg.FailFast:
+		return &failFast{}
+	case cfg.MaxFailures > 0:
+		return &failFast{limit: cfg.MaxFailures}
+	}
+	return nil
+}
+
+// wrap returns onError with every failure also reported to f.
+func (f *failFast) wrap(onError func(TransferError)) func(TransferError) {
+	if f == nil {
+		return onError
+	}
+	return func(err TransferError) {
+		f.trip(err)
+		if onError != nil {
+			onError(err)
+		}
+	}
+}
+
+// trip counts the failure err and, if it is the one that goes over the
+// limit, records it and stops the run starting new jobs.
+func (f *failFast) trip(err TransferError) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures++
+	if f.err != nil || f.failures <= f.limit {
+		return
+	}
+	f.err = err
+	if f.limit > 0 {
+		f.err = fmt.Errorf("%w after %d failures: %w", ErrCircuitBreakerTripped, f.failures, err)
+	}
+	if f.stop != nil {
+		f.stop()
+	}
+}
+
+// bind sets the function that stops new jobs from starting.
+func (f *failFast) bind(stop context.CancelFunc) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stop = stop
+	if f.err != nil {
+		stop()
+	}
+}
+
+// cause is the failure that stopped the run, if any.
+func (f *failFast) cause() error {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.err
+}
+
+// runErr is cfg.runErr, except that a run FailFast or MaxFailures stopped
+// returns the failure that stopped it.
+func (r *run) runErr(ctx context.Context, finished bool) error {
+	if err := r.failFast.cause(); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return r.cfg.runErr(ctx, finished)
+}
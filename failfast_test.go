@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+func TestFailFast(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	jobs := fileJobs(client, 500, slowFile)
+	client.Delete(jobs[2].RemotePath)
+
+	cfg := PipelineCfg{SFTPReaders: 8, Workers: 2, BufferSize: 4, FailFast: true}
+	stats, err := cfg.TransferFilesStats(context.Background(), client, jobs, func(FileResult) error { return nil })
+	var terr TransferError
+	if !errors.As(err, &terr) || terr.ID != jobs[2].ID || terr.Stage != StageOpen {
+		t.Fatalf("expected the open failure of %s, got %v", jobs[2].ID, err)
+	}
+	if stats.Failed != 1 {
+		t.Errorf("expected 1 failure, got %d", stats.Failed)
+	}
+	if opens := opened(client, jobs); opens > 50 {
+		t.Errorf("expected the run to stop soon after the failure, %d of %d files were opened", opens, len(jobs))
+	}
+}
+
+func TestFailFastProcessError(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	jobs := fileJobs(client, 500, slowFile)
+	boom := errors.New("boom")
+
+	cfg := PipelineCfg{SFTPReaders: 8, FailFast: true}
+	stats, err := cfg.stream(context.Background(), client, fromSlice(jobs), nil, func(job FileJob, r io.Reader) error {
+		if job.ID == "id_5" {
+			return boom
+		}
+		_, err := io.Copy(io.Discard, r)
+		return err
+	}, nil)
+	if !errors.Is(err, boom) {
+		t.Fatalf("expected the process error, got %v", err)
+	}
+	if done := stats.Transferred + stats.Failed; done > 50 {
+		t.Errorf("expected the run to stop soon after the failure, %d jobs finished", done)
+	}
+}
+
+func TestFailFastWithoutFailures(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	jobs := fileJobs(client, 20, slowFile)
+	cfg := PipelineCfg{SFTPReaders: 4, Workers: 2, BufferSize: 4, FailFast: true}
+	stats, err := cfg.TransferFilesStats(context.Background(), client, jobs, func(FileResult) error { return nil })
+	if err != nil || stats.Transferred != 20 {
+		t.Fatalf("expected a clean run, got %+v, %v", stats, err)
+	}
+}
+
+func TestMaxFailures(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	jobs := fileJobs(client, 500, slowFile)
+	for _, job := range jobs {
+		client.Delete(job.RemotePath)
+	}
+
+	cfg := PipelineCfg{SFTPReaders: 8, Workers: 2, BufferSize: 4, MaxFailures: 5}
+	stats, err := cfg.TransferFilesStats(context.Background(), client, jobs, func(FileResult) error { return nil })
+	if !errors.Is(err, ErrCircuitBreakerTripped) {
+		t.Fatalf("expected the circuit breaker to trip, got %v", err)
+	}
+	var terr TransferError
+	if !errors.As(err, &terr) {
+		t.Errorf("expected the tripping failure to be wrapped, got %v", err)
+	}
+	if !stats.CircuitBreakerTripped {
+		t.Error("expected CircuitBreakerTripped to be set")
+	}
+	if stats.Failed < 6 {
+		t.Errorf("expected at least 6 failures, got %d", stats.Failed)
+	}
+	if opens := opened(client, jobs); opens > 50 {
+		t.Errorf("expected the run to stop soon after the sixth failure, %d of %d files were opened", opens, len(jobs))
+	}
+}
+
+func TestMaxFailuresNotExceeded(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	jobs := fileJobs(client, 50, slowFile)
+	for _, job := range jobs[:5] {
+		client.Delete(job.RemotePath)
+	}
+	cfg := PipelineCfg{SFTPReaders: 4, Workers: 2, BufferSize: 4, MaxFailures: 5}
+	stats, err := cfg.TransferFilesStats(context.Background(), client, jobs, func(FileResult) error { return nil })
+	if err != nil || stats.Transferred != 45 || stats.Failed != 5 || stats.CircuitBreakerTripped {
+		t.Fatalf("expected 5 failures to be tolerated, got %+v, %v", stats, err)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// ErrFanOutClosed is returned by FanOut.Process once Close has been called.
+var ErrFanOutClosed = errors.New("fan-out is closed")
+
+// FanOutPolicy decides when a FanOut file fails.
+type FanOutPolicy int
+
+const (
+	// FailIfAny fails a file if any of its sinks fails.
+	FailIfAny FanOutPolicy = iota
+	// FailIfAll fails a file only if every one of its sinks fails; the
+	// other failures are lost.
+	FailIfAll
+)
+
+// SinkError is the error of a FanOut sink, counted from 0, on one file.
+type SinkError struct {
+	Index int
+	Err   error
+}
+
+func (e *SinkError) Error() string {
+	return fmt.Sprintf("sink %d: %v", e.Index, e.Err)
+}
+
+func (e *SinkError) Unwrap() error { return e.Err }
+
+// FanOutSink is one destination of a FanOut, with its own pool of Workers
+// goroutines calling Process, and a Queue of results waiting for them.
+// Zero Workers means 1.
+type FanOutSink struct {
+	Process ProcessFunc
+	Workers int
+	Queue   int
+}
+
+// FanOut delivers each result to every one of its sinks, so a file read once
+// reaches them all. Each sink runs in its own pool, so a sink's concurrency
+// is its own and doesn't depend on the run's Workers. Process waits for every
+// sink to take its result, so the file can fail under the policy: a slow
+// sink still holds up the workers once its queue is full, delaying the
+// sinks after it, and the run goes no faster than the slowest sink allows.
+type FanOut struct {
+	policy  FanOutPolicy
+	queues  []chan fanOutCall
+	workers sync.WaitGroup
+	// mu guards closed and the queues being closed
+	mu     sync.RWMutex
+	closed bool
+}
+
+// fanOutCall is a result queued for sink i, which records its error in
+// errs[i] and marks done.
+type fanOutCall struct {
+	result FileResult
+	i      int
+	errs   []error
+	done   *sync.WaitGroup
+}
+
+// NewFanOut starts the pools of sinks. Close stops them.
+func NewFanOut(policy FanOutPolicy, sinks ...FanOutSink) *FanOut {
+	f := &FanOut{policy: policy}
+	for i, sink := range sinks {
+		queue := make(chan fanOutCall, max(sink.Queue, 0))
+		f.queues = append(f.queues, queue)
+		for range max(sink.Workers, 1) {
+			f.workers.Go(func() {
+				for call := range queue {
+					if err := callSink(sink.Process, call.result); err != nil {
+						call.errs[i] = &SinkError{Index: i, Err: err}
+					}
+					call.done.Done()
+				}
+			})
+		}
+	}
+	return f
+}
+
+// callSink calls process, turning a panic into an error wrapping ErrPanic,
+// as the pool's goroutines are out of reach of RecoverPanics.
+func callSink(process ProcessFunc, result FileResult) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("%w: %v", ErrPanic, v)
+		}
+	}()
+	return process(result)
+}
+
+// Process is the FanOut's ProcessFunc. It queues result for every sink and
+// returns once all have processed it: nil, or under the policy the sinks'
+// errors, each a *SinkError, joined. The sinks share result.Data and must
+// not modify it. ErrRetryProcess from any sink reruns them all, so such
+// sinks should be idempotent.
+func (f *FanOut) Process(result FileResult) error {
+	errs := make([]error, len(f.queues))
+	var done sync.WaitGroup
+	f.mu.RLock()
+	if f.closed {
+		f.mu.RUnlock()
+		return ErrFanOutClosed
+	}
+	done.Add(len(f.queues))
+	for i, queue := range f.queues {
+		queue <- fanOutCall{result: result, i: i, errs: errs, done: &done}
+	}
+	f.mu.RUnlock()
+	done.Wait()
+	if f.policy == FailIfAll && slices.Contains(errs, nil) {
+		return nil
+	}
+	return errors.Join(errs...)
+}
+
+// Close waits for the sinks to finish the results queued and stops their
+// pools. Process fails with ErrFanOutClosed from then on.
+func (f *FanOut) Close() {
+	f.mu.Lock()
+	if !f.closed {
+		f.closed = true
+		for _, queue := range f.queues {
+			close(queue)
+		}
+	}
+	f.mu.Unlock()
+	f.workers.Wait()
+}
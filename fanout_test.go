@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+func TestFanOut(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	jobs := fileJobs(client, 20, dataFile)
+	// recorder is a sink that records what it got and fails the listed IDs
+	recorder := func(fail ...string) (ProcessFunc, func() []string) {
+		var mu sync.Mutex
+		var ids []string
+		return func(r FileResult) error {
+				mu.Lock()
+				ids = append(ids, r.ID)
+				mu.Unlock()
+				if slices.Contains(fail, r.ID) {
+					return errors.New("sink down")
+				}
+				return nil
+			}, func() []string {
+				mu.Lock()
+				defer mu.Unlock()
+				slices.Sort(ids)
+				return ids
+			}
+	}
+	var all []string
+	for _, job := range jobs {
+		all = append(all, job.ID)
+	}
+	slices.Sort(all)
+
+	archive, archived := recorder("id_3")
+	index, indexed := recorder("id_3", "id_5")
+	fan := NewFanOut(FailIfAny, FanOutSink{Process: archive, Workers: 2}, FanOutSink{Process: index, Queue: 4})
+	transferred, errs := DefaultCfg().TransferFilesWithErrors(client, jobs, fan.Process)
+	fan.Close()
+	if !slices.Equal(archived(), all) || !slices.Equal(indexed(), all) {
+		t.Fatalf("expected both sinks to get all 20 results, got %v and %v", archived(), indexed())
+	}
+	if transferred != 18 || len(errs) != 2 {
+		t.Fatalf("expected 18 transfers and 2 failures under FailIfAny, got %d, %v", transferred, errs)
+	}
+	for _, e := range errs {
+		var se *SinkError
+		if !errors.As(e, &se) || se.Index != 1 && e.ID != "id_3" {
+			t.Errorf("expected %s to fail with a SinkError from the index, got %v", e.ID, e)
+		}
+	}
+
+	archive, _ = recorder("id_3")
+	index, _ = recorder("id_3", "id_5")
+	fan = NewFanOut(FailIfAll, FanOutSink{Process: archive}, FanOutSink{Process: index})
+	defer fan.Close()
+	transferred, errs = DefaultCfg().TransferFilesWithErrors(client, jobs, fan.Process)
+	if transferred != 19 || len(errs) != 1 || errs[0].ID != "id_3" {
+		t.Errorf("expected only id_3 to fail under FailIfAll, got %d, %v", transferred, errs)
+	}
+}
+
+func TestFanOutSinkPools(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	jobs := fileJobs(client, 30, dataFile)
+	// bounded is a sink recording the most calls it had at once
+	bounded := func() (ProcessFunc, *atomic.Int32) {
+		var running, peak atomic.Int32
+		return func(FileResult) error {
+			n := running.Add(1)
+			for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+			}
+			time.Sleep(2 * time.Millisecond)
+			running.Add(-1)
+			return nil
+		}, &peak
+	}
+	slow, slowPeak := bounded()
+	fast, fastPeak := bounded()
+	panics := func(FileResult) error { panic("boom") }
+	fan := NewFanOut(FailIfAll, FanOutSink{Process: slow, Queue: 8}, FanOutSink{Process: fast, Workers: 3}, FanOutSink{Process: panics})
+	cfg := DefaultCfg()
+	cfg.Workers = 8
+	if transferred, errs := cfg.TransferFilesWithErrors(client, jobs, fan.Process); transferred != 30 || len(errs) != 0 {
+		t.Fatalf("expected a panicking sink to be recovered and outvoted, got %d, %v", transferred, errs)
+	}
+	if slowPeak.Load() != 1 || fastPeak.Load() > 3 || fastPeak.Load() < 2 {
+		t.Errorf("expected each sink to keep to its own Workers, got peaks %d and %d", slowPeak.Load(), fastPeak.Load())
+	}
+
+	fan.Close()
+	fan.Close()
+	if err := fan.Process(FileResult{}); !errors.Is(err, ErrFanOutClosed) {
+		t.Errorf("expected ErrFanOutClosed after Close, got %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// syncFile flushes f to stable storage for Fsync. Tests replace it to see
+// that it is called.
+var syncFile = (*os.File).Sync
+
+// closeFile closes a downloaded file, first syncing it under fsync so a
+// crash after the rename that follows can't lose data reported as written.
+func closeFile(f *os.File, fsync bool) error {
+	if fsync {
+		if err := syncFile(f); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// renameFile moves a downloaded file into place, then under fsync syncs the
+// directory holding it so the rename itself survives a crash. Windows can't
+// sync a directory and commits renames to its journal instead, so there the
+// directory is left alone.
+func renameFile(from, to string, fsync bool) error {
+	if err := os.Rename(from, to); err != nil || !fsync || runtime.GOOS == "windows" {
+		return err
+	}
+	dir, err := os.Open(filepath.Dir(to))
+	if err != nil {
+		return err
+	}
+	return closeFile(dir, true)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// checkGroupByDir reports whether GroupByDir can be used with src: it needs
+// the whole job list up front, and its readers take jobs out of order.
+func (cfg PipelineCfg) checkGroupByDir(src source[FileJob]) error {
+	if !cfg.GroupByDir {
+		return nil
+	}
+	if cfg.Ordered {
+		return errors.New("GroupByDir can't be combined with Ordered")
+	}
+	if src.slice == nil {
+		return errors.New("GroupByDir needs a slice of jobs")
+	}
+	return nil
+}
+
+// dirPartitions splits jobs into up to n partitions, one per reader, that
+// keep the files of a directory together. A directory with more than its
+// share of the jobs, len(jobs)/n rounded up, is cut into runs of that size
+// so one large directory doesn't leave a single reader with all the work.
+// Runs go largest first to the partition with the fewest jobs so far, ties
+// to the lowest, and keep their input order.
+func dirPartitions(jobs []FileJob, n int) [][]queued[FileJob] {
+	n = max(n, 1)
+	share := max((len(jobs)+n-1)/n, 1)
+	var dirs []string
+	groups := map[string][]queued[FileJob]{}
+	for i, job := range jobs {
+		dir := path.Dir(job.RemotePath)
+		if _, ok := groups[dir]; !ok {
+			dirs = append(dirs, dir)
+		}
+		groups[dir] = append(groups[dir], queued[FileJob]{index: i, job: job})
+	}
+	var runs [][]queued[FileJob]
+	for _, dir := range dirs {
+		runs = append(runs, slices.Collect(slices.Chunk(groups[dir], share))...)
+	}
+	slices.SortStableFunc(runs, func(a, b []queued[FileJob]) int { return len(b) - len(a) })
+
+	parts := make([][]queued[FileJob], n)
+	for _, run := range runs {
+		least := 0
+		for i := range parts {
+			if len(parts[i]) < len(parts[least]) {
+				least = i
+			}
+		}
+		parts[least] = append(parts[least], run...)
+	}
+	return slices.DeleteFunc(parts, func(part []queued[FileJob]) bool { return len(part) == 0 })
+}
+
+// feedByDir starts a reader for each of jobs' dirPartitions, each fed only
+// its own partition, in place of the shared feed. Jobs keep their input
+// index.
+func (r *run) feedByDir(ctx context.Context, wg *sync.WaitGroup, jobs source[FileJob], read func(SFTPClient, queued[FileJob]) bool) *feed[FileJob] {
+	f := &feed[FileJob]{done: make(chan struct{})}
+	f.sent.Store(-1)
+	var feeders sync.WaitGroup
+	var cut atomic.Bool
+	for i, part := range dirPartitions(jobs.slice, r.cfg.SFTPReaders) {
+		ch := make(chan queued[FileJob])
+		feeders.Go(func() {
+			defer close(ch)
+			for _, q := range part {
+				q.index = jobs.index(q.index)
+				select {
+				case ch <- q:
+				case <-ctx.Done():
+					cut.Store(true)
+					return
+				}
+			}
+		})
+		client := r.readerClient(i)
+		wg.Go(func() {
+			for q := range ch {
+				if !read(client, q) {
+					return
+				}
+			}
+		})
+	}
+	go func() {
+		defer close(f.done)
+		feeders.Wait()
+		if !cut.Load() {
+			f.sent.Store(int64(len(jobs.slice)))
+		}
+	}()
+	return f
+}
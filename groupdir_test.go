@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+func TestDirPartitions(t *testing.T) {
+	var jobs []FileJob
+	add := func(dir string, n int) {
+		for i := 0; i < n; i++ {
+			jobs = append(jobs, FileJob{RemotePath: fmt.Sprintf("/%s/%d", dir, i), ID: fmt.Sprintf("%s%d", dir, i)})
+		}
+	}
+	add("big", 7)
+	add("a", 2)
+	add("b", 3)
+	add("c", 1)
+	// Interleave one more file of a after the rest
+	jobs = append(jobs, FileJob{RemotePath: "/a/late", ID: "alate"})
+
+	ids := func(part []queued[FileJob]) []string {
+		var out []string
+		for _, q := range part {
+			if jobs[q.index].ID != q.job.ID {
+				t.Errorf("job %s carries index %d of %s", q.job.ID, q.index, jobs[q.index].ID)
+			}
+			out = append(out, q.job.ID)
+		}
+		return out
+	}
+	// 14 jobs over 3 readers is a share of 5: big splits into 5 and 2
+	want := [][]string{
+		{"big0", "big1", "big2", "big3", "big4"},
+		{"a0", "a1", "alate", "big5", "big6"},
+		{"b0", "b1", "b2", "c0"},
+	}
+	parts := dirPartitions(jobs, 3)
+	if len(parts) != len(want) {
+		t.Fatalf("expected %d partitions, got %d", len(want), len(parts))
+	}
+	for i, part := range parts {
+		if got := ids(part); !slices.Equal(got, want[i]) {
+			t.Errorf("partition %d: expected %v, got %v", i, want[i], got)
+		}
+	}
+
+	if parts := dirPartitions(jobs[7:10], 8); len(parts) != 3 {
+		t.Errorf("expected one partition per run when readers outnumber them, got %d", len(parts))
+	}
+	if parts := dirPartitions(nil, 4); len(parts) != 0 {
+		t.Errorf("expected no partitions for no jobs, got %d", len(parts))
+	}
+}
+
+func TestGroupByDir(t *testing.T) {
+	var jobs []FileJob
+	for i := 0; i < 8; i++ {
+		// Alternate directories so a shared feed would mix them
+		p := fmt.Sprintf("/%s/%d.bin", []string{"x", "y"}[i%2], i)
+		jobs = append(jobs, FileJob{RemotePath: p, ID: fmt.Sprint(i)})
+	}
+	// Two connections to the same files
+	clients := []*sftptest.FakeClient{sftptest.NewFakeClient(), sftptest.NewFakeClient()}
+	for _, c := range clients {
+		for _, job := range jobs {
+			c.AddData(job.RemotePath, []byte("data"))
+		}
+	}
+	files := clients[0]
+	cfg := PipelineCfg{SFTPReaders: 2, Workers: 2, BufferSize: 1, GroupByDir: true}
+	stats, err := cfg.TransferFilesPool(context.Background(), []SFTPClient{clients[0], clients[1]}, jobs, func(FileResult) error { return nil })
+	if err != nil || stats.Transferred != 8 {
+		t.Fatalf("expected 8 transfers, got %+v, %v", stats, err)
+	}
+	// The first reader has the first directory, /x, and the second /y
+	for i, job := range jobs {
+		if n := clients[i%2].Opens(job.RemotePath); n != 1 {
+			t.Errorf("expected each reader to keep to one directory, %s opened %d times on client %d", job.RemotePath, n, i%2)
+		}
+	}
+
+	cfg.Ordered = true
+	if _, err := cfg.TransferFilesStats(context.Background(), files, jobs, func(FileResult) error { return nil }); err == nil {
+		t.Error("expected GroupByDir with Ordered to fail")
+	}
+	cfg.Ordered = false
+	src := make(chan FileJob)
+	close(src)
+	if _, err := cfg.TransferFilesChan(context.Background(), files, src, func(FileResult) error { return nil }); err == nil {
+		t.Error("expected GroupByDir on a channel of jobs to fail")
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// readAll reads f whole, or the part FileJob.Offset and Length pick out, or
+// its first HeadBytes, through h, gunzipping it first when Decompress is set
+// and job is a .gz file, and spilling it under SpillThreshold. The checksum
+// covers the decompressed data.
+func (r *run) readAll(job FileJob, f io.Reader, h *hasher) (FileResult, error) {
+	f, err := section(job, f)
+	if err != nil {
+		return FileResult{}, err
+	}
+	if !r.cfg.Decompress || !strings.HasSuffix(job.RemotePath, ".gz") {
+		return r.readData(h.wrap(r.head(f)))
+	}
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return FileResult{}, fmt.Errorf("%w: %w", ErrDecompress, err)
+	}
+	defer zr.Close()
+	result, err := r.readData(h.wrap(r.head(zr)))
+	if err != nil {
+		return FileResult{}, fmt.Errorf("%w: %w", ErrDecompress, err)
+	}
+	return result, nil
+}
+
+// compressResult gzips result's Data for CompressResults.
+func compressResult(result FileResult) (FileResult, error) {
+	var buf bytes.Buffer
+	buf.Grow(len(result.Data) / 2)
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(result.Data); err != nil {
+		return result, err
+	}
+	if err := zw.Close(); err != nil {
+		return result, err
+	}
+	result.Data, result.Compressed = buf.Bytes(), true
+	return result, nil
+}
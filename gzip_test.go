@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+)
+
+func gzipped(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecompress(t *testing.T) {
+	plain := []byte("2024-01-01 INFO started\n")
+	packed := gzipped(t, plain)
+	truncated := packed[:len(packed)-6]
+
+	client := newFakeClient(map[string][]byte{
+		"/logs/app.log.gz":      packed,
+		"/logs/raw.log":         plain,
+		"/logs/not-gzip.gz":     plain,
+		"/logs/truncated.gz":    truncated,
+		"/logs/packed-name.gzx": packed,
+	})
+	jobs := []FileJob{
+		{RemotePath: "/logs/app.log.gz", ID: "app"},
+		{RemotePath: "/logs/raw.log", ID: "raw"},
+		{RemotePath: "/logs/not-gzip.gz", ID: "not-gzip"},
+		{RemotePath: "/logs/truncated.gz", ID: "truncated"},
+		{RemotePath: "/logs/packed-name.gzx", ID: "packed-name"},
+	}
+
+	var mu sync.Mutex
+	got := map[string][]byte{}
+	cfg := DefaultCfg()
+	cfg.Decompress = true
+	transferred, errs := cfg.TransferFilesWithErrors(client, jobs, func(r FileResult) error {
+		mu.Lock()
+		got[r.ID] = r.Data
+		mu.Unlock()
+		return nil
+	})
+
+	if transferred != 3 {
+		t.Errorf("expected 3 transfers, got %d", transferred)
+	}
+	if !bytes.Equal(got["app"], plain) {
+		t.Errorf("app: got %q, want decompressed %q", got["app"], plain)
+	}
+	if !bytes.Equal(got["raw"], plain) {
+		t.Errorf("raw: got %q, want it unchanged", got["raw"])
+	}
+	if !bytes.Equal(got["packed-name"], packed) {
+		t.Error("packed-name: only .gz files should be decompressed")
+	}
+	failed := map[string]bool{}
+	for _, e := range errs {
+		failed[e.ID] = true
+		if !errors.Is(e, ErrDecompress) || e.Stage != StageRead {
+			t.Errorf("%s: expected a read-stage ErrDecompress, got %v", e.ID, e)
+		}
+	}
+	if len(errs) != 2 || !failed["not-gzip"] || !failed["truncated"] {
+		t.Errorf("expected not-gzip and truncated to fail, got %v", errs)
+	}
+}
+
+func TestDecompressOff(t *testing.T) {
+	packed := gzipped(t, []byte("hello"))
+	client := newFakeClient(map[string][]byte{"/logs/a.gz": packed})
+
+	var data []byte
+	transferred, _ := DefaultCfg().TransferFiles(client, []FileJob{{RemotePath: "/logs/a.gz", ID: "a"}}, func(r FileResult) error {
+		data = r.Data
+		return nil
+	})
+	if transferred != 1 || !bytes.Equal(data, packed) {
+		t.Errorf("without Decompress the raw bytes should pass through, got %q", data)
+	}
+}
+
+func TestCompressResults(t *testing.T) {
+	plain := bytes.Repeat([]byte("2024-01-01 INFO started\n"), 100)
+	client := newFakeClient(map[string][]byte{"/logs/app.log": plain})
+	cfg := DefaultCfg()
+	cfg.CompressResults = true
+	cfg.ComputeChecksum = true
+	var got FileResult
+	transferred, failed := cfg.TransferFiles(client, []FileJob{{RemotePath: "/logs/app.log", ID: "app"}}, func(r FileResult) error {
+		got = r
+		return nil
+	})
+	if transferred != 1 || failed != 0 {
+		t.Fatalf("expected 1 transfer, got %d transferred, %d failed", transferred, failed)
+	}
+	if !got.Compressed {
+		t.Fatal("expected the result to be marked compressed")
+	}
+	if len(got.Data) >= len(plain) {
+		t.Errorf("expected repetitive data to shrink, got %d of %d bytes", len(got.Data), len(plain))
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(got.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, plain) {
+		t.Error("decompressed result differs from the original")
+	}
+	if sum := sha256.Sum256(plain); got.Checksum != hex.EncodeToString(sum[:]) {
+		t.Errorf("checksum should cover the original data, got %s", got.Checksum)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// head limits f to its first HeadBytes, when set. The file is closed once
+// they have been read, without fetching the rest. A seekable f stays
+// seekable within those bytes.
+func (r *run) head(f io.Reader) io.Reader {
+	if r.cfg.HeadBytes <= 0 {
+		return f
+	}
+	if s, ok := f.(io.ReadSeeker); ok {
+		if pos, err := s.Seek(0, io.SeekCurrent); err == nil {
+			return &window{s: s, base: pos, limit: r.cfg.HeadBytes}
+		}
+	}
+	return io.LimitReader(f, r.cfg.HeadBytes)
+}
+
+// section moves f to job.Offset and limits it to job.Length bytes, when
+// they are set. A seekable f becomes a window onto that part, so seeking it,
+// as Resume does, stays within the part. f is otherwise read up to the
+// offset. An offset past the end of the file fails with ErrOffset.
+func section(job FileJob, f io.Reader) (io.Reader, error) {
+	if job.Offset <= 0 && job.Length <= 0 {
+		return f, nil
+	}
+	if job.Offset > 0 {
+		if err := skipTo(f, job.Offset); err != nil {
+			return nil, err
+		}
+	}
+	limit := job.Length
+	if limit <= 0 {
+		limit = -1
+	}
+	if s, ok := f.(io.ReadSeeker); ok {
+		return &window{s: s, base: job.Offset, limit: limit}, nil
+	}
+	if limit > 0 {
+		return io.LimitReader(f, limit), nil
+	}
+	return f, nil
+}
+
+// window is the part of s that starts at base and is limit bytes long, or
+// runs to the end of s if limit is negative. Offsets passed to Seek are
+// relative to base. s must be positioned at base to begin with.
+type window struct {
+	s     io.ReadSeeker
+	base  int64
+	limit int64
+	pos   int64
+}
+
+func (w *window) Read(p []byte) (int, error) {
+	if w.limit >= 0 {
+		if w.pos >= w.limit {
+			return 0, io.EOF
+		}
+		p = p[:min(int64(len(p)), w.limit-w.pos)]
+	}
+	n, err := w.s.Read(p)
+	w.pos += int64(n)
+	return n, err
+}
+
+func (w *window) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += w.pos
+	case io.SeekEnd:
+		size, err := w.s.Seek(0, io.SeekEnd)
+		if err != nil {
+			return 0, err
+		}
+		end := max(size-w.base, 0)
+		if w.limit >= 0 {
+			end = min(end, w.limit)
+		}
+		offset += end
+	}
+	if offset < 0 {
+		return 0, errors.New("seek before the start of the section")
+	}
+	if _, err := w.s.Seek(w.base+offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	w.pos = offset
+	return offset, nil
+}
+
+// skipTo moves f forward to offset.
+func skipTo(f io.Reader, offset int64) error {
+	if s, ok := f.(io.Seeker); ok {
+		size, err := s.Seek(0, io.SeekEnd)
+		if err == nil {
+			if offset > size {
+				return fmt.Errorf("%w: offset %d of a %d-byte file", ErrOffset, offset, size)
+			}
+			_, err = s.Seek(offset, io.SeekStart)
+			return err
+		}
+	}
+	n, err := io.CopyN(io.Discard, f, offset)
+	if err == io.EOF {
+		return fmt.Errorf("%w: offset %d of a %d-byte file", ErrOffset, offset, n)
+	}
+	return err
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+func TestHeadBytes(t *testing.T) {
+	large := bytes.Repeat([]byte("0123456789"), 1000)
+	client := newFakeClient(map[string][]byte{
+		"/remote/large.bin": large,
+		"/remote/small.bin": []byte("tiny"),
+		"/remote/exact.bin": large[:16],
+	})
+	jobs := []FileJob{
+		{RemotePath: "/remote/large.bin", ID: "large"},
+		{RemotePath: "/remote/small.bin", ID: "small"},
+		{RemotePath: "/remote/exact.bin", ID: "exact"},
+	}
+	want := map[string][]byte{"large": large[:16], "small": []byte("tiny"), "exact": large[:16]}
+
+	cfg := DefaultCfg()
+	cfg.HeadBytes = 16
+	results, errs := cfg.CollectFiles(client, jobs)
+	if len(errs) != 0 || len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d and errors %v", len(results), errs)
+	}
+	for _, r := range results {
+		if !bytes.Equal(r.Data, want[r.ID]) {
+			t.Errorf("%s: expected %q, got %q", r.ID, want[r.ID], r.Data)
+		}
+	}
+
+	streamed := map[string][]byte{}
+	cfg.SFTPReaders = 1
+	cfg.TransferFilesStreaming(client, jobs, func(id string, r io.Reader) error {
+		data, err := io.ReadAll(r)
+		streamed[id] = data
+		return err
+	})
+	for id, data := range streamed {
+		if !bytes.Equal(data, want[id]) {
+			t.Errorf("streamed %s: expected %q, got %q", id, want[id], data)
+		}
+	}
+}
+
+func TestOffsetLength(t *testing.T) {
+	blob := []byte("header|record-one|record-two|trailer")
+	files := map[string][]byte{"/remote/blob.bin": blob}
+	jobs := []FileJob{
+		{RemotePath: "/remote/blob.bin", ID: "middle", Offset: 7, Length: 10},
+		{RemotePath: "/remote/blob.bin", ID: "tail", Offset: 29},
+		{RemotePath: "/remote/blob.bin", ID: "long", Offset: 29, Length: 100},
+		{RemotePath: "/remote/blob.bin", ID: "first", Length: 6},
+		{RemotePath: "/remote/blob.bin", ID: "end", Offset: int64(len(blob))},
+		{RemotePath: "/remote/blob.bin", ID: "past", Offset: int64(len(blob)) + 1},
+	}
+	want := map[string]string{
+		"middle": "record-one",
+		"tail":   "trailer",
+		"long":   "trailer",
+		"first":  "header",
+		"end":    "",
+	}
+
+	plain := newFakeClient(files)
+	seekable := sftptest.NewFakeClient()
+	seekable.Add("/remote/blob.bin", sftptest.File{Data: blob, Seekable: true})
+	for name, client := range map[string]SFTPClient{"plain": plain, "seekable": seekable} {
+		results, errs := DefaultCfg().CollectFiles(client, jobs)
+		if len(results) != len(want) {
+			t.Errorf("%s: expected %d results, got %d", name, len(want), len(results))
+		}
+		for _, r := range results {
+			if string(r.Data) != want[r.ID] {
+				t.Errorf("%s: %s read %q, want %q", name, r.ID, r.Data, want[r.ID])
+			}
+		}
+		if len(errs) != 1 || errs[0].ID != "past" || !errors.Is(errs[0], ErrOffset) {
+			t.Errorf("%s: expected only past to fail with ErrOffset, got %v", name, errs)
+		}
+	}
+	if s, p := seekable.Served("/remote/blob.bin"), plain.Served("/remote/blob.bin"); s >= p {
+		t.Errorf("expected a seekable file to be seeked rather than read through, served %d bytes against %d", s, p)
+	}
+
+	transferred, _ := DefaultCfg().TransferFilesStreaming(newFakeClient(files), jobs[:1], func(id string, r io.Reader) error {
+		data, err := io.ReadAll(r)
+		if string(data) != "record-one" {
+			t.Errorf("streaming read %q", data)
+		}
+		return err
+	})
+	if transferred != 1 {
+		t.Errorf("streaming: %d transferred", transferred)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// readers starts a run's readers on jobs, each passing the jobs it receives
+// to read until jobs is closed or read returns false. Readers are dealt the
+// run's clients round-robin. wg is done once every reader has exited.
+//
+// Without IdleTimeout there are SFTPReaders readers for the whole run. With
+// it readers start on demand instead: a dispatcher hands each job to an idle
+// reader, starting a new one, up to SFTPReaders, when none is waiting, and a
+// reader that waits IdleTimeout for a job exits. A bursty source is then
+// served by as many readers as the current burst needs.
+func (r *run) readers(ctx context.Context, wg *sync.WaitGroup, jobs <-chan queued[FileJob], read func(SFTPClient, queued[FileJob]) bool) {
+	if r.cfg.IdleTimeout <= 0 {
+		for i := 0; i < r.cfg.SFTPReaders; i++ {
+			client := r.readerClient(i)
+			wg.Go(func() {
+				for q := range jobs {
+					if !read(client, q) {
+						return
+					}
+				}
+			})
+		}
+		return
+	}
+
+	idle := r.cfg.IdleTimeout
+	work := make(chan queued[FileJob])
+	// exited wakes a dispatcher waiting on readers that may all be exiting
+	exited := make(chan struct{}, 1)
+	var live atomic.Int32
+	spawned := 0
+	spawn := func() {
+		if int(live.Load()) >= max(r.cfg.SFTPReaders, 1) {
+			return
+		}
+		client := r.readerClient(spawned)
+		spawned++
+		live.Add(1)
+		// The dispatcher is itself in wg, so wg can't reach zero early
+		wg.Go(func() {
+			defer func() {
+				live.Add(-1)
+				select {
+				case exited <- struct{}{}:
+				default:
+				}
+			}()
+			t := time.NewTimer(idle)
+			defer t.Stop()
+			for {
+				select {
+				case q, ok := <-work:
+					if !ok || !read(client, q) {
+						return
+					}
+					t.Reset(idle)
+				case <-t.C:
+					return
+				}
+			}
+		})
+	}
+
+	wg.Go(func() {
+		defer close(work)
+		for q := range jobs {
+			select {
+			case work <- q:
+				continue
+			default:
+			}
+			spawn()
+			for sent := false; !sent; {
+				select {
+				case work <- q:
+					sent = true
+				case <-exited:
+					spawn()
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+func TestIdleTimeout(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	all := fileJobs(client, 120, slowFile)
+	jobs := make(chan FileJob)
+	var processed atomic.Int32
+	var mu sync.Mutex
+	peak := 0
+	cfg := PipelineCfg{SFTPReaders: 20, Workers: 2, BufferSize: 2, IdleTimeout: 20 * time.Millisecond}
+	done := make(chan struct{})
+	var stats TransferStats
+	var err error
+	go func() {
+		defer close(done)
+		stats, err = cfg.TransferFilesChan(context.Background(), client, jobs, func(FileResult) error {
+			mu.Lock()
+			peak = max(peak, runtime.NumGoroutine())
+			mu.Unlock()
+			processed.Add(1)
+			return nil
+		})
+	}()
+
+	// burst sends batch all at once and returns the most goroutines seen while
+	// they were processed
+	burst := func(batch []FileJob) int {
+		mu.Lock()
+		peak = 0
+		mu.Unlock()
+		want := processed.Load() + int32(len(batch))
+		var wg sync.WaitGroup
+		for _, job := range batch {
+			wg.Go(func() { jobs <- job })
+		}
+		wg.Wait()
+		for processed.Load() < want {
+			time.Sleep(time.Millisecond)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return peak
+	}
+	// idleCount waits out the idle readers and counts what is left
+	idleCount := func() int {
+		deadline := time.Now().Add(2 * time.Second)
+		n := runtime.NumGoroutine()
+		for time.Now().Before(deadline) {
+			time.Sleep(50 * time.Millisecond)
+			if m := runtime.NumGoroutine(); m == n {
+				break
+			} else {
+				n = m
+			}
+		}
+		return n
+	}
+
+	before := idleCount()
+	first := burst(all[:60])
+	idle := idleCount()
+	second := burst(all[60:])
+
+	close(jobs)
+	<-done
+	if err != nil || stats.Transferred != 120 {
+		t.Fatalf("expected 120 transfers, got %+v, %v", stats, err)
+	}
+	t.Logf("goroutines: %d before, %d in the first burst, %d idle, %d in the second", before, first, idle, second)
+	if first < idle+10 {
+		t.Errorf("expected the readers to exit when idle: %d in the burst, %d idle", first, idle)
+	}
+	if second < idle+10 {
+		t.Errorf("expected readers to start again under load: %d idle, %d in the second burst", idle, second)
+	}
+}
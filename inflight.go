@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// inflight caps the bytes of file data held between being read and being
+// processed, for MaxInFlightBytes. A nil *inflight never blocks.
+type inflight struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	limit int64
+	used  int64
+	// holds maps each job of an Ordered run that holds bytes to how many,
+	// and next is the job the run must deliver next.
+	holds map[int]int64
+	next  int
+}
+
+// newInflight returns nil unless cfg.MaxInFlightBytes is set.
+func (cfg PipelineCfg) newInflight() *inflight {
+	if cfg.MaxInFlightBytes <= 0 {
+		return nil
+	}
+	b := &inflight{limit: cfg.MaxInFlightBytes}
+	if cfg.Ordered {
+		b.holds = make(map[int]int64)
+	}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// acquire waits until n more bytes fit under the limit and takes them for job
+// index. A job goes ahead regardless when nothing is held, so a file larger
+// than the limit runs on its own. In an Ordered run the job due to be
+// delivered next also goes ahead once every job holding bytes comes after it,
+// since none of those can be delivered before it. It returns false if ctx is
+// done first.
+func (b *inflight) acquire(ctx context.Context, index int, n int64) bool {
+	if b == nil {
+		return true
+	}
+	stop := context.AfterFunc(ctx, func() {
+		b.mu.Lock()
+		b.cond.Broadcast()
+		b.mu.Unlock()
+	})
+	defer stop()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for b.used > 0 && b.used+n > b.limit && !b.due(index) {
+		if ctx.Err() != nil {
+			return false
+		}
+		b.cond.Wait()
+	}
+	b.used += n
+	if b.holds != nil {
+		b.holds[index] = n
+	}
+	return true
+}
+
+// due reports whether job index of an Ordered run is the next to be
+// delivered and comes before every job holding bytes.
+func (b *inflight) due(index int) bool {
+	if b.holds == nil || index != b.next {
+		return false
+	}
+	for i := range b.holds {
+		if i < index {
+			return false
+		}
+	}
+	return true
+}
+
+// resize changes job index's hold of held bytes to size without waiting, once
+// a read shows how much data it really holds, and returns size.
+func (b *inflight) resize(index int, held, size int64) int64 {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	b.used += size - held
+	if b.holds != nil {
+		if size > 0 {
+			b.holds[index] = size
+		} else {
+			delete(b.holds, index)
+		}
+	}
+	b.cond.Broadcast()
+	b.mu.Unlock()
+	return size
+}
+
+func (b *inflight) release(index int, n int64) {
+	b.resize(index, n, 0)
+}
+
+// advance records that an Ordered run has delivered every job before next.
+func (b *inflight) advance(next int) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.next = next
+	b.cond.Broadcast()
+	b.mu.Unlock()
+}
+
+// reserve takes room for job's data before it is read, sized by a Stat when
+// the client can. Without one the hold starts at zero and is corrected by
+// resize after the read.
+func (r *run) reserve(ctx context.Context, client SFTPClient, q queued[FileJob]) (int64, error) {
+	if r.inflight == nil {
+		return 0, nil
+	}
+	var n int64
+	if fi, err := statRemote(client, q.job.RemotePath); err == nil {
+		n = fi.Size()
+	}
+	if !r.inflight.acquire(ctx, q.index, n) {
+		return 0, ctx.Err()
+	}
+	return n, nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+// servedClient tracks how much file data has been read from it but not yet
+// processed, and the peak of that.
+type servedClient struct {
+	*sftptest.FakeClient
+	held, peak atomic.Int64
+}
+
+type servedFile struct {
+	io.ReadCloser
+	c *servedClient
+}
+
+func (f servedFile) Read(p []byte) (int, error) {
+	n, err := f.ReadCloser.Read(p)
+	held := f.c.held.Add(int64(n))
+	for peak := f.c.peak.Load(); held > peak && !f.c.peak.CompareAndSwap(peak, held); peak = f.c.peak.Load() {
+	}
+	return n, err
+}
+
+func (c *servedClient) Open(path string) (io.ReadCloser, error) {
+	r, err := c.FakeClient.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return servedFile{ReadCloser: r, c: c}, nil
+}
+
+// processed marks a result's data as no longer held.
+func (c *servedClient) processed(r FileResult) {
+	c.held.Add(-int64(len(r.Data)))
+}
+
+func largeJobs(n, size int) ([]FileJob, *servedClient) {
+	client := &servedClient{FakeClient: sftptest.NewFakeClient()}
+	var jobs []FileJob
+	for i := 0; i < n; i++ {
+		path := fmt.Sprintf("/remote/large_%d.bin", i)
+		client.AddData(path, bytes.Repeat([]byte{byte(i)}, size))
+		jobs = append(jobs, FileJob{RemotePath: path, ID: fmt.Sprintf("large_%d", i)})
+	}
+	return jobs, client
+}
+
+func TestMaxInFlightBytes(t *testing.T) {
+	const size = 1 << 20
+	jobs, client := largeJobs(30, size)
+	cfg := PipelineCfg{SFTPReaders: 10, Workers: 2, BufferSize: 100, MaxInFlightBytes: 3 * size}
+
+	transferred, failed := cfg.TransferFiles(client, jobs, func(r FileResult) error {
+		time.Sleep(2 * time.Millisecond)
+		client.processed(r)
+		return nil
+	})
+	if transferred != 30 || failed != 0 {
+		t.Fatalf("expected 30 transferred, got %d transferred and %d failed", transferred, failed)
+	}
+	if peak := client.peak.Load(); peak > cfg.MaxInFlightBytes {
+		t.Errorf("peak in-flight data %d exceeds MaxInFlightBytes %d", peak, cfg.MaxInFlightBytes)
+	}
+}
+
+func TestMaxInFlightBytesLargerFile(t *testing.T) {
+	jobs, client := largeJobs(4, 1<<20)
+	cfg := PipelineCfg{SFTPReaders: 4, Workers: 1, BufferSize: 4, MaxInFlightBytes: 1 << 10}
+
+	transferred, _ := cfg.TransferFiles(client, jobs, func(r FileResult) error {
+		client.processed(r)
+		return nil
+	})
+	if transferred != 4 {
+		t.Fatalf("expected files larger than the limit to run one at a time, got %d transferred", transferred)
+	}
+	if peak := client.peak.Load(); peak > 1<<20 {
+		t.Errorf("expected one file in flight at a time, peak was %d bytes", peak)
+	}
+}
+
+func TestMaxInFlightBytesOrdered(t *testing.T) {
+	const size = 64 << 10
+	jobs, client := largeJobs(40, size)
+	cfg := PipelineCfg{SFTPReaders: 8, Workers: 1, BufferSize: 8, Ordered: true, MaxInFlightBytes: 2 * size}
+
+	var order []string
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cfg.TransferFiles(client, jobs, func(r FileResult) error {
+			order = append(order, r.ID)
+			client.processed(r)
+			return nil
+		})
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("ordered run with MaxInFlightBytes deadlocked")
+	}
+	if len(order) != len(jobs) {
+		t.Fatalf("expected %d results, got %d", len(jobs), len(order))
+	}
+	for i, id := range order {
+		if id != jobs[i].ID {
+			t.Fatalf("result %d is %s, want %s", i, id, jobs[i].ID)
+		}
+	}
+	// The job due next may go over the limit by one file
+	if peak := client.peak.Load(); peak > cfg.MaxInFlightBytes+size {
+		t.Errorf("peak in-flight data %d exceeds the limit", peak)
+	}
+}
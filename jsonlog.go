@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// fileOutcome is the JSONLog line of one finished job.
+type fileOutcome struct {
+	ID         string  `json:"id"`
+	Path       string  `json:"path"`
+	Bytes      int64   `json:"bytes"`
+	DurationMS float64 `json:"duration_ms"`
+	Status     string  `json:"status"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// jsonLog writes a JSON line per finished job to JSONLog. A nil *jsonLog
+// writes nothing.
+type jsonLog struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func newJSONLog(w io.Writer) *jsonLog {
+	if w == nil {
+		return nil
+	}
+	return &jsonLog{enc: json.NewEncoder(w)}
+}
+
+// write logs the outcome of read, which ended with err. Write errors are
+// dropped: the log must not fail the transfer.
+func (l *jsonLog) write(read fileRead, err error) {
+	if l == nil {
+		return
+	}
+	line := fileOutcome{
+		ID:         read.job.ID,
+		Path:       read.job.RemotePath,
+		Bytes:      read.size,
+		DurationMS: float64(time.Since(read.start)) / float64(time.Millisecond),
+		Status:     "ok",
+	}
+	switch {
+	case errors.Is(err, ErrSkip):
+		line.Status = "skipped"
+	case err != nil:
+		line.Status, line.Error = "failed", err.Error()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.enc.Encode(line)
+}
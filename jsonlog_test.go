@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+func TestJSONLog(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	jobs := fileJobs(client, 20, dataFile)
+	client.Delete(jobs[3].RemotePath)
+	var buf bytes.Buffer
+	cfg := PipelineCfg{SFTPReaders: 4, Workers: 4, BufferSize: 4, JSONLog: &buf}
+	_, err := cfg.TransferFilesStats(context.Background(), client, jobs, func(res FileResult) error {
+		if res.ID == jobs[5].ID {
+			return ErrSkip
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := map[string]map[string]any{}
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var line map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("bad JSON line %q: %v", scanner.Text(), err)
+		}
+		lines[line["id"].(string)] = line
+	}
+	if len(lines) != 20 {
+		t.Fatalf("expected a line per job, got %d", len(lines))
+	}
+	for _, job := range jobs {
+		line := lines[job.ID]
+		want := "ok"
+		switch job.ID {
+		case jobs[3].ID:
+			want = "failed"
+			if line["error"] == nil {
+				t.Errorf("%s: expected an error field", job.ID)
+			}
+		case jobs[5].ID:
+			want = "skipped"
+		}
+		if line["status"] != want || line["path"] != job.RemotePath {
+			t.Errorf("%s: got %v, want status %s", job.ID, line, want)
+		}
+		if _, ok := line["duration_ms"].(float64); !ok {
+			t.Errorf("%s: missing duration_ms", job.ID)
+		}
+	}
+	if lines[jobs[0].ID]["bytes"] != float64(4) {
+		t.Errorf("expected 4 bytes, got %v", lines[jobs[0].ID]["bytes"])
+	}
+	if _, ok := lines[jobs[0].ID]["error"]; ok {
+		t.Error("expected no error field for a success")
+	}
+}
+
+func TestJSONLogWriteErrors(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	jobs := fileJobs(client, 5, dataFile)
+	cfg := PipelineCfg{SFTPReaders: 2, Workers: 2, JSONLog: &failingWriter{}}
+	if stats, err := cfg.TransferFilesStats(context.Background(), client, jobs, func(FileResult) error { return nil }); err != nil || stats.Transferred != 5 {
+		t.Fatalf("expected a failing log not to affect the run, got %+v, %v", stats, err)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// keepalive pings client every KeepaliveInterval, as Preflight's round trip
+// does, until the returned function is called, which waits for the pinging
+// goroutine to exit. Failed pings are logged; they don't stop the pings.
+func (cfg PipelineCfg) keepalive(client SFTPClient) func() {
+	if cfg.KeepaliveInterval <= 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		ticker := time.NewTicker(cfg.KeepaliveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := ping(client); err != nil {
+					cfg.logger().Printf("keepalive failed: %v\n", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	})
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/pkg/sftp"
+)
+
+// ErrorKind is the broad category of a failure, for callers deciding whether
+// to retry or how to report it.
+type ErrorKind int
+
+const (
+	KindOther ErrorKind = iota
+	KindNotFound
+	KindPermission
+	// KindTransient is a failure that may go away if the job is tried
+	// again: a lost connection or a timeout.
+	KindTransient
+	// KindProcessTimeout is a file whose processing ran over
+	// ProcessTimeout.
+	KindProcessTimeout
+	// KindStalledConnection is a file whose reads fell below
+	// MinThroughputBytesPerSec.
+	KindStalledConnection
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case KindOther:
+		return "other"
+	case KindNotFound:
+		return "not found"
+	case KindPermission:
+		return "permission"
+	case KindTransient:
+		return "transient"
+	case KindProcessTimeout:
+		return "process timeout"
+	case KindStalledConnection:
+		return "stalled connection"
+	}
+	return fmt.Sprintf("ErrorKind(%d)", int(k))
+}
+
+// KindOf classifies err by the os, sftp and network errors it wraps.
+func KindOf(err error) ErrorKind {
+	switch {
+	case err == nil:
+		return KindOther
+	case errors.Is(err, ErrProcessTimeout):
+		return KindProcessTimeout
+	case errors.Is(err, ErrStalled):
+		return KindStalledConnection
+	case IsNotFound(err):
+		return KindNotFound
+	case IsPermission(err):
+		return KindPermission
+	case IsTransient(err):
+		return KindTransient
+	}
+	return KindOther
+}
+
+// statusCode returns the SFTP status code err carries, if any.
+func statusCode(err error) (uint32, bool) {
+	var status *sftp.StatusError
+	if !errors.As(err, &status) {
+		return 0, false
+	}
+	return status.Code, true
+}
+
+// IsNotFound reports whether err means the remote file doesn't exist.
+func IsNotFound(err error) bool {
+	if errors.Is(err, os.ErrNotExist) {
+		return true
+	}
+	code, ok := statusCode(err)
+	return ok && code == uint32(sftp.ErrSSHFxNoSuchFile)
+}
+
+// IsPermission reports whether err means access to the remote file was
+// denied.
+func IsPermission(err error) bool {
+	if errors.Is(err, os.ErrPermission) {
+		return true
+	}
+	code, ok := statusCode(err)
+	return ok && code == uint32(sftp.ErrSSHFxPermissionDenied)
+}
+
+// IsTransient reports whether err is a lost connection or a timeout, which
+// retrying the job may get past.
+func IsTransient(err error) bool {
+	if connectionLost(err) || errors.Is(err, ErrFileTimeout) ||
+		errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	code, ok := statusCode(err)
+	return ok && (code == uint32(sftp.ErrSSHFxNoConnection) || code == uint32(sftp.ErrSSHFxConnectionLost))
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/pkg/sftp"
+)
+
+func TestKindOf(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		kind ErrorKind
+	}{
+		{nil, KindOther},
+		{errors.New("boom"), KindOther},
+		{fmt.Errorf("open /a: %w", os.ErrNotExist), KindNotFound},
+		{&os.PathError{Op: "open", Path: "/a", Err: &sftp.StatusError{Code: uint32(sftp.ErrSSHFxNoSuchFile)}}, KindNotFound},
+		{fmt.Errorf("open /a: %w", os.ErrPermission), KindPermission},
+		{fmt.Errorf("wrapped: %w", &sftp.StatusError{Code: uint32(sftp.ErrSSHFxPermissionDenied)}), KindPermission},
+		{fmt.Errorf("read: %w", sftp.ErrSSHFxConnectionLost), KindTransient},
+		{&sftp.StatusError{Code: uint32(sftp.ErrSSHFxNoConnection)}, KindTransient},
+		{fmt.Errorf("read: %w", io.ErrUnexpectedEOF), KindOther},
+		{fmt.Errorf("%w: %w", ErrFileTimeout, context.DeadlineExceeded), KindTransient},
+		{&sftp.StatusError{Code: uint32(sftp.ErrSSHFxFailure)}, KindOther},
+	} {
+		if got := KindOf(tc.err); got != tc.kind {
+			t.Errorf("KindOf(%v) = %v, want %v", tc.err, got, tc.kind)
+		}
+	}
+}
+
+func TestTransferErrorKind(t *testing.T) {
+	// FakeClient fails Opens of missing files the way *sftp.Client does
+	client := newFakeClient(map[string][]byte{"/remote/a": []byte("a")})
+	jobs := []FileJob{{RemotePath: "/remote/a", ID: "a"}, {RemotePath: "/remote/b", ID: "b"}}
+	cfg := DefaultCfg()
+	_, errs := cfg.TransferFilesWithErrors(client, jobs, func(FileResult) error { return os.ErrPermission })
+	kinds := map[string]ErrorKind{}
+	for _, e := range errs {
+		kinds[e.ID] = e.Kind
+	}
+	if kinds["a"] != KindPermission || kinds["b"] != KindNotFound {
+		t.Errorf("expected a permission and b not found, got %v", kinds)
+	}
+}
+
+func TestTruncatedGzipNotTransient(t *testing.T) {
+	packed := gzipped(t, []byte("2024-01-01 INFO started\n"))
+	client := newFakeClient(map[string][]byte{"/logs/truncated.gz": packed[:len(packed)-6]})
+	cfg := DefaultCfg()
+	cfg.Decompress = true
+	_, errs := cfg.TransferFilesWithErrors(client, []FileJob{{RemotePath: "/logs/truncated.gz", ID: "truncated"}}, func(FileResult) error { return nil })
+	if len(errs) != 1 {
+		t.Fatalf("expected the truncated file to fail, got %v", errs)
+	}
+	if IsTransient(errs[0]) || errs[0].Kind == KindTransient {
+		t.Errorf("expected a truncated gzip not to be transient, got %v", errs[0].Kind)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+)
+
+// latencySamples bounds the file latencies kept for the percentiles, so a
+// run of any size holds the same few KB.
+const latencySamples = 4096
+
+// latencies is a uniform sample of up to latencySamples file latencies,
+// kept by reservoir sampling: once it is full the nth latency replaces a
+// random sample with probability latencySamples/n.
+type latencies struct {
+	mu      sync.Mutex
+	n       int
+	samples []time.Duration
+}
+
+func (l *latencies) observe(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.n++
+	if len(l.samples) < latencySamples {
+		l.samples = append(l.samples, d)
+	} else if i := rand.IntN(l.n); i < latencySamples {
+		l.samples[i] = d
+	}
+}
+
+// percentiles returns the sample's p50, p95 and p99, or zeros if it is
+// empty.
+func (l *latencies) percentiles() (p50, p95, p99 time.Duration) {
+	l.mu.Lock()
+	sorted := slices.Clone(l.samples)
+	l.mu.Unlock()
+	slices.Sort(sorted)
+	return percentile(sorted, 0.50), percentile(sorted, 0.95), percentile(sorted, 0.99)
+}
+
+// percentile is the nearest-rank p-quantile of sorted: the smallest value
+// at least a fraction p of the values are no greater than.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[min(max(i, 0), len(sorted)-1)]
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+func TestPercentile(t *testing.T) {
+	var l latencies
+	// 1ms to 100ms, shuffled
+	for _, i := range rand.Perm(100) {
+		l.observe(time.Duration(i+1) * time.Millisecond)
+	}
+	p50, p95, p99 := l.percentiles()
+	if p50 != 50*time.Millisecond || p95 != 95*time.Millisecond || p99 != 99*time.Millisecond {
+		t.Errorf("expected 50ms, 95ms and 99ms, got %v, %v and %v", p50, p95, p99)
+	}
+
+	var empty latencies
+	if p50, p95, p99 := empty.percentiles(); p50 != 0 || p95 != 0 || p99 != 0 {
+		t.Errorf("expected zeros for no samples, got %v, %v and %v", p50, p95, p99)
+	}
+}
+
+func TestPercentileReservoir(t *testing.T) {
+	var l latencies
+	// A million latencies spread evenly over 0-1s
+	const n = 1_000_000
+	for i := 0; i < n; i++ {
+		l.observe(time.Duration(rand.IntN(n)) * time.Microsecond)
+	}
+	if len(l.samples) != latencySamples {
+		t.Fatalf("expected the sample capped at %d, got %d", latencySamples, len(l.samples))
+	}
+	p50, p95, p99 := l.percentiles()
+	for _, c := range []struct {
+		got, want time.Duration
+	}{{p50, 500 * time.Millisecond}, {p95, 950 * time.Millisecond}, {p99, 990 * time.Millisecond}} {
+		if d := c.got - c.want; d < -30*time.Millisecond || d > 30*time.Millisecond {
+			t.Errorf("expected about %v, got %v", c.want, c.got)
+		}
+	}
+}
+
+func TestTransferStatsLatency(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	var jobs []FileJob
+	for i := 0; i < 20; i++ {
+		path := fmt.Sprintf("/remote/%d.bin", i)
+		// One slow file in twenty
+		latency := time.Duration(0)
+		if i == 0 {
+			latency = 100 * time.Millisecond
+		}
+		client.Add(path, sftptest.File{Data: []byte("data"), OpenLatency: latency})
+		jobs = append(jobs, FileJob{RemotePath: path, ID: fmt.Sprint(i)})
+	}
+	stats, err := DefaultCfg().TransferFilesStats(t.Context(), client, jobs, func(FileResult) error { return nil })
+	if err != nil || stats.Transferred != 20 {
+		t.Fatalf("expected 20 transfers, got %+v, %v", stats, err)
+	}
+	if stats.LatencyP50 >= 50*time.Millisecond || stats.LatencyP99 < 100*time.Millisecond || stats.LatencyP95 > stats.LatencyP99 {
+		t.Errorf("expected a fast median and the slow file at p99, got %v, %v, %v", stats.LatencyP50, stats.LatencyP95, stats.LatencyP99)
+	}
+}
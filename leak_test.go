@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+// noLeaks runs fn and fails t unless it returns promptly and leaves no more
+// goroutines running than before, once any on their way out have exited.
+func noLeaks(t *testing.T, fn func()) {
+	t.Helper()
+	before := runtime.NumGoroutine()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn()
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("run did not return\n%s", stacks())
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("goroutines leaked: %d before, %d after\n%s", before, after, stacks())
+	}
+}
+
+func stacks() []byte {
+	buf := make([]byte, 1<<20)
+	return buf[:runtime.Stack(buf, true)]
+}
+
+// leakJobs returns 20 files that read normally followed by 100 that hang
+// until closed.
+func leakJobs() ([]FileJob, *sftptest.FakeClient) {
+	client := sftptest.NewFakeClient()
+	jobs := fileJobs(client, 20, dataFile)
+	for i := range jobs {
+		jobs[i].Priority = i % 3
+	}
+	for i := 0; i < 100; i++ {
+		path := fmt.Sprintf("/remote/hang_%d.bin", i)
+		client.Add(path, hangingFile)
+		jobs = append(jobs, FileJob{RemotePath: path, ID: fmt.Sprintf("hang_%d", i)})
+	}
+	return jobs, client
+}
+
+func leakCfgs() map[string]PipelineCfg {
+	base := PipelineCfg{SFTPReaders: 4, Workers: 2, BufferSize: 1}
+	cfgs := map[string]PipelineCfg{"default": base}
+	add := func(name string, set func(*PipelineCfg)) {
+		cfg := base
+		set(&cfg)
+		cfgs[name] = cfg
+	}
+	add("ordered", func(c *PipelineCfg) { c.Ordered = true })
+	add("adaptive", func(c *PipelineCfg) { c.Adaptive, c.AdaptiveInterval = true, time.Millisecond })
+	add("fanout", func(c *PipelineCfg) { c.Dedupe = DedupeFanOut })
+	add("sizeaware", func(c *PipelineCfg) { c.SizeAwareScheduling = true })
+	add("inflight", func(c *PipelineCfg) { c.MaxInFlightBytes = 4 })
+	add("stop", func(c *PipelineCfg) { c.Stop = make(chan struct{}) })
+	add("failfast", func(c *PipelineCfg) { c.FailFast = true })
+	add("deadline", func(c *PipelineCfg) { c.Deadline = time.Minute })
+	add("timeout", func(c *PipelineCfg) { c.PerFileTimeout = time.Minute })
+	add("idle", func(c *PipelineCfg) { c.IdleTimeout = time.Millisecond })
+	return cfgs
+}
+
+func TestNoGoroutineLeaks(t *testing.T) {
+	for name, cfg := range leakCfgs() {
+		t.Run(name+"/complete", func(t *testing.T) {
+			jobs, client := leakJobs()
+			var stats TransferStats
+			var err error
+			noLeaks(t, func() {
+				stats, err = cfg.TransferFilesStats(context.Background(), client, jobs[:20], func(FileResult) error { return nil })
+			})
+			if err != nil || stats.Transferred != 20 {
+				t.Errorf("expected 20 transferred, got %+v, %v", stats, err)
+			}
+		})
+
+		t.Run(name+"/cancel", func(t *testing.T) {
+			jobs, client := leakJobs()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			var processed atomic.Int32
+			var err error
+			noLeaks(t, func() {
+				_, err = cfg.TransferFilesStats(ctx, client, jobs, func(FileResult) error {
+					if processed.Add(1) == 10 {
+						cancel()
+					}
+					return nil
+				})
+			})
+			if err == nil {
+				t.Error("expected the cancelled run to return an error")
+			}
+		})
+	}
+}
+
+func TestNoGoroutineLeaksStreaming(t *testing.T) {
+	for name, cfg := range leakCfgs() {
+		t.Run(name, func(t *testing.T) {
+			jobs, client := leakJobs()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			var processed atomic.Int32
+			noLeaks(t, func() {
+				cfg.stream(ctx, client, fromSlice(jobs), nil, func(job FileJob, r io.Reader) error {
+					_, err := io.Copy(io.Discard, r)
+					if processed.Add(1) == 10 {
+						cancel()
+					}
+					return err
+				}, nil)
+			})
+		})
+	}
+}
+
+func TestNoGoroutineLeaksChan(t *testing.T) {
+	jobs, client := leakJobs()
+	// The channel is never closed, so only cancellation ends the run
+	src := make(chan FileJob, len(jobs))
+	for _, job := range jobs[:20] {
+		src <- job
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var processed atomic.Int32
+	var err error
+	cfg := PipelineCfg{SFTPReaders: 4, Workers: 2, BufferSize: 1}
+	noLeaks(t, func() {
+		_, err = cfg.TransferFilesChan(ctx, client, src, func(FileResult) error {
+			if processed.Add(1) == 20 {
+				cancel()
+			}
+			return nil
+		})
+	})
+	if err == nil {
+		t.Error("expected the cancelled run to return an error")
+	}
+}
+
+func TestFeederExitsWithReaders(t *testing.T) {
+	jobs, client := leakJobs()
+	for name, cfg := range map[string]PipelineCfg{
+		"ordered":     {SFTPReaders: 4, Workers: 1, BufferSize: 1, Ordered: true},
+		"prioritized": {SFTPReaders: 4, Workers: 1, BufferSize: 1},
+		"idle":        {SFTPReaders: 4, Workers: 1, BufferSize: 1, IdleTimeout: time.Minute},
+	} {
+		t.Run(name, func(t *testing.T) {
+			r := cfg.newRun([]SFTPClient{client}, len(jobs), nil)
+			var window chan struct{}
+			if cfg.Ordered {
+				window = make(chan struct{}, len(jobs))
+			}
+			noLeaks(t, func() {
+				var readWg sync.WaitGroup
+				// Every reader gives up on its first job, as if it had died
+				feed := r.feedReaders(context.Background(), &readWg, fromSlice(jobs), window, func(SFTPClient, queued[FileJob]) bool {
+					return false
+				})
+				readWg.Wait()
+				<-feed.done
+				if feed.finished(TransferStats{}) {
+					t.Error("expected the abandoned feed not to count as finished")
+				}
+			})
+		})
+	}
+}
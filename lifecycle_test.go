@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"testing"
+)
+
+// lifecycle counts hook calls per job ID.
+type lifecycle struct {
+	mu       sync.Mutex
+	started  map[string]int
+	complete map[string]int
+	errs     map[string]error
+}
+
+func newLifecycle(cfg *PipelineCfg) *lifecycle {
+	l := &lifecycle{started: map[string]int{}, complete: map[string]int{}, errs: map[string]error{}}
+	cfg.OnFileStart = func(job FileJob) {
+		l.mu.Lock()
+		l.started[job.ID]++
+		l.mu.Unlock()
+	}
+	cfg.OnFileComplete = func(r FileResult, err error) {
+		l.mu.Lock()
+		l.complete[r.ID]++
+		l.errs[r.ID] = err
+		l.mu.Unlock()
+	}
+	return l
+}
+
+func (l *lifecycle) check(t *testing.T, name string, jobs []FileJob) {
+	t.Helper()
+	for _, job := range jobs {
+		if n := l.started[job.ID]; n != 1 {
+			t.Errorf("%s: OnFileStart fired %d times for %s", name, n, job.ID)
+		}
+		if n := l.complete[job.ID]; n != 1 {
+			t.Errorf("%s: OnFileComplete fired %d times for %s", name, n, job.ID)
+		}
+	}
+	if err := l.errs["missing"]; err == nil {
+		t.Errorf("%s: expected missing to complete with an error", name)
+	}
+	if err := l.errs["skip"]; !errors.Is(err, ErrSkip) {
+		t.Errorf("%s: expected skip to complete with ErrSkip, got %v", name, err)
+	}
+	if err := l.errs["a"]; err != nil {
+		t.Errorf("%s: expected a to succeed, got %v", name, err)
+	}
+}
+
+func TestLifecycleHooks(t *testing.T) {
+	client := newFakeClient(map[string][]byte{
+		"/remote/a.bin":    []byte("alpha"),
+		"/remote/skip.bin": []byte("skip"),
+	})
+	jobs := []FileJob{
+		{RemotePath: "/remote/a.bin", ID: "a"},
+		{RemotePath: "/remote/missing.bin", ID: "missing"},
+		{RemotePath: "/remote/skip.bin", ID: "skip"},
+		{RemotePath: "/remote/a.bin", ID: "a-again"},
+	}
+
+	cfg := DefaultCfg()
+	cfg.Dedupe = DedupeFanOut
+	l := newLifecycle(&cfg)
+	cfg.TransferFiles(client, jobs, func(r FileResult) error {
+		if r.ID == "skip" {
+			return ErrSkip
+		}
+		return nil
+	})
+	l.check(t, "in memory", jobs)
+
+	cfg = DefaultCfg()
+	l = newLifecycle(&cfg)
+	cfg.TransferFilesStreaming(client, jobs, func(id string, r io.Reader) error {
+		if id == "skip" {
+			return ErrSkip
+		}
+		_, err := io.Copy(io.Discard, r)
+		return err
+	})
+	l.check(t, "streaming", jobs)
+}
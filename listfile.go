@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// JobsFromReader parses a list of remote files, one per line, as either
+// "path" or "path<TAB>id". A job without an ID column is given its path as
+// its ID. Whitespace around each column is trimmed, and blank lines and lines
+// starting with "#" are skipped. A line with more than two columns, or an
+// empty one, fails with an error naming its line number.
+func JobsFromReader(r io.Reader) ([]FileJob, error) {
+	var jobs []FileJob
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if trimmed := strings.TrimSpace(line); trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		switch {
+		case len(fields) > 2:
+			return nil, fmt.Errorf("line %d: %d columns, want path and an optional ID", n, len(fields))
+		case fields[0] == "" || len(fields) == 2 && fields[1] == "":
+			return nil, fmt.Errorf("line %d: empty column", n)
+		}
+		job := FileJob{RemotePath: fields[0], ID: fields[0]}
+		if len(fields) == 2 {
+			job.ID = fields[1]
+		}
+		jobs = append(jobs, job)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// WriteJobs writes jobs as a list JobsFromReader reads back, such as the
+// failed jobs of TransferFilesFailedJobs to retry later: "path<TAB>id" per
+// job, or just the path when it is also the ID. Meta and the other fields
+// aren't kept. If a path or ID is one the format can't hold, because it is
+// empty, has surrounding whitespace or contains a tab or newline, nothing is
+// written and the error names the job.
+func WriteJobs(w io.Writer, jobs []FileJob) error {
+	for _, job := range jobs {
+		for _, s := range []string{job.RemotePath, job.ID} {
+			if s == "" || s != strings.TrimSpace(s) || strings.ContainsAny(s, "\t\n\r") {
+				return fmt.Errorf("job %q: can't write %q to a job list", job.ID, s)
+			}
+		}
+		if strings.HasPrefix(job.RemotePath, "#") {
+			return fmt.Errorf("job %q: path %q would be read as a comment", job.ID, job.RemotePath)
+		}
+	}
+	bw := bufio.NewWriter(w)
+	for _, job := range jobs {
+		line := job.RemotePath
+		if job.ID != job.RemotePath {
+			line += "\t" + job.ID
+		}
+		if _, err := bw.WriteString(line + "\n"); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJobsFromReader(t *testing.T) {
+	list := "# nightly export\n" +
+		"/exports/a.csv\n" +
+		"\n" +
+		"/exports/b.csv\tb\n" +
+		"   \n" +
+		"  # indented comment\n" +
+		"/exports/c d.csv \t c-id \r\n" +
+		"/exports/e.csv"
+	jobs, err := JobsFromReader(strings.NewReader(list))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FileJob{
+		{RemotePath: "/exports/a.csv", ID: "/exports/a.csv"},
+		{RemotePath: "/exports/b.csv", ID: "b"},
+		{RemotePath: "/exports/c d.csv", ID: "c-id"},
+		{RemotePath: "/exports/e.csv", ID: "/exports/e.csv"},
+	}
+	if !reflect.DeepEqual(jobs, want) {
+		t.Errorf("JobsFromReader:\n got %v\nwant %v", jobs, want)
+	}
+
+	for _, bad := range []string{"/a\tb\tc\n", "/a\n\t b\n", "/a\t\n"} {
+		if _, err := JobsFromReader(strings.NewReader(bad)); err == nil {
+			t.Errorf("expected %q to fail", bad)
+		}
+	}
+	if _, err := JobsFromReader(strings.NewReader("/a\t \n")); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("expected an error naming line 1, got %v", err)
+	}
+}
+
+func TestWriteJobs(t *testing.T) {
+	var buf bytes.Buffer
+	jobs := []FileJob{{RemotePath: "/a.bin", ID: "/a.bin"}, {RemotePath: "/b.bin", ID: "b"}}
+	if err := WriteJobs(&buf, jobs); err != nil {
+		t.Fatal(err)
+	}
+	if want := "/a.bin\n/b.bin\tb\n"; buf.String() != want {
+		t.Errorf("expected %q, got %q", want, buf.String())
+	}
+
+	for _, job := range []FileJob{
+		{RemotePath: "/tab\tpath", ID: "x"},
+		{RemotePath: "/c.bin", ID: " padded"},
+		{RemotePath: "/d.bin"},
+		{RemotePath: "#comment", ID: "x"},
+	} {
+		buf.Reset()
+		err := WriteJobs(&buf, []FileJob{jobs[1], job})
+		if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("%q", job.ID)) || buf.Len() != 0 {
+			t.Errorf("%+v: expected an error naming the job and nothing written, got %v, %q", job, err, buf.String())
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package main
+
+// Logger receives the pipeline's human-readable output. *log.Logger
+// satisfies it.
+type Logger interface {
+	Printf(format string, v ...any)
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Printf(string, ...any) {}
+
+// logger returns cfg.Logger, or a logger that discards everything if unset.
+func (cfg PipelineCfg) logger() Logger {
+	if cfg.Logger == nil {
+		return nopLogger{}
+	}
+	return cfg.Logger
+}
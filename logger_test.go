@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingLogger keeps every formatted line.
+type recordingLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *recordingLogger) Printf(format string, v ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func TestLoggerReceivesSummary(t *testing.T) {
+	client := newFakeClient(map[string][]byte{"/remote/a.bin": []byte("a")})
+	jobs := []FileJob{
+		{RemotePath: "/remote/a.bin", ID: "a"},
+		{RemotePath: "/remote/missing.bin", ID: "missing"},
+	}
+
+	log := &recordingLogger{}
+	cfg := DefaultCfg()
+	cfg.Logger = log
+	cfg.TransferFiles(client, jobs, func(FileResult) error { return nil })
+
+	if len(log.lines) != 1 {
+		t.Fatalf("expected one summary line, got %q", log.lines)
+	}
+	if !strings.Contains(log.lines[0], "Success: 1, Failed: 1") {
+		t.Errorf("unexpected summary %q", log.lines[0])
+	}
+}
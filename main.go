@@ -1,75 +1,457 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/pkg/sftp"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type FileJob struct {
 	RemotePath string
 	ID         string
+	// ExpectedSHA256, if set, is the hex SHA-256 the file's content must
+	// have. The in-memory pipeline hashes files as it reads them and fails
+	// any that don't match with ErrChecksumMismatch.
+	ExpectedSHA256 string
+	// ExpectedChecksum is like ExpectedSHA256 for the hex digest under
+	// PipelineCfg.ChecksumAlgo.
+	ExpectedChecksum string
+	// Priority orders jobs for reading: higher values are started first and
+	// equal ones keep input order. It has no effect in Ordered mode.
+	Priority int
+	// Meta is application data carried through to FileResult.Meta untouched.
+	Meta map[string]string
+	// Offset and Length, when positive, read only the part of the file
+	// that starts Offset bytes in and runs for Length bytes, or to the end
+	// if Length is zero, for example one record of a concatenated blob. An
+	// Offset past the end of the file fails the job with ErrOffset; a
+	// Length past it is cut short. HeadBytes applies within the part.
+	Offset int64
+	Length int64
 }
 type FileResult struct {
 	ID   string
 	Data []byte
+	// Checksum is the hex digest of Data under PipelineCfg.ChecksumAlgo when
+	// ComputeChecksum is set.
+	Checksum string
+	// Meta is the job's FileJob.Meta.
+	Meta map[string]string
+	// Compressed reports that Data was gzipped under CompressResults.
+	Compressed bool
+	// ContentType is the MIME type sniffed from the start of the file, as
+	// read before any CompressResults, under SniffContentType.
+	ContentType string
+	// SpillPath is the temp file holding the data of a file larger than
+	// SpillThreshold, in which case Data is nil; Reader reads either. The
+	// file is removed once processFunc returns.
+	SpillPath string
+	spillSize int64
+	// ctx is done once the run stops starting files, for the waits of
+	// middleware such as Retry.
+	ctx context.Context
 }
 
 type ProcessFunc func(result FileResult) error
 
+// fileRead is the outcome of reading one job, still tied to the job and its
+// position in the input. A failed read carries the stage and error instead of
+// a result. size is the number of bytes read, or in a DryRun the file's size.
+type fileRead struct {
+	index  int
+	job    FileJob
+	result FileResult
+	size   int64
+	stage  Stage
+	err    error
+	// held is the read's share of MaxInFlightBytes.
+	held int64
+	// client is the connection the file was read through.
+	client SFTPClient
+	// span covers the job from the start of its read until it is delivered.
+	span  trace.Span
+	start time.Time
+}
+
+// queued is a job tagged with its position in the input.
+type queued[T any] struct {
+	index int
+	job   T
+}
+
 type PipelineCfg struct {
+	// SFTPReaders is how many files are opened and read at once. It is the
+	// IO parallelism: the more latency there is to hide, the more readers
+	// pay off. See DefaultCfgForLink.
 	SFTPReaders int
-	Workers     int
-	BufferSize  int
+	// Workers is how many goroutines pass results to processFunc. It is the
+	// CPU parallelism, so for a CPU-bound processFunc it should be around
+	// GOMAXPROCS; ProcessSemaphore caps it further.
+	Workers int
+	// BufferSize is how many read files may wait for a worker.
+	BufferSize int
+	RetryPolicy
+	// Progress, if set, is called after every job finishes.
+	Progress ProgressFunc
+	// OnProgress, if set, is called with a Progress snapshot every
+	// ProgressInterval (default one second) and once more when the run ends.
+	OnProgress       func(Progress)
+	ProgressInterval time.Duration
+	// ReportInterval, if positive, logs a status line such as "1234/5000
+	// done, 23 failed, 45.0 MB/s" through the Logger at that interval, with
+	// the rate over the last interval, on top of the final summary.
+	ReportInterval time.Duration
+	// TotalBytes is the combined size of the jobs, if known, for
+	// Progress.BytesTotal and a byte-based ETA.
+	TotalBytes int64
+	// MaxBytesPerSec caps the combined read rate of all readers. Zero means
+	// unlimited.
+	MaxBytesPerSec int64
+	// MaxOpensPerSec caps how many files all readers together open per
+	// second, retries included, for servers that limit request rates. It
+	// combines with MaxBytesPerSec. Zero means unlimited.
+	MaxOpensPerSec int
+	// MaxInFlightBytes caps the file data held in memory between being read
+	// and processed; readers wait for room before reading a file. Zero
+	// means unlimited.
+	MaxInFlightBytes int64
+	// Ordered calls processFunc one result at a time in input order. See
+	// ReorderWindow.
+	Ordered bool
+	// SizeAwareScheduling hands buffered results to workers smallest first
+	// rather than in the order they were read. Ignored when Ordered.
+	SizeAwareScheduling bool
+	// ReorderWindow bounds how many jobs past the oldest unfinished one may
+	// be read ahead in Ordered mode. Zero means 2*SFTPReaders.
+	ReorderWindow int
+	// Limit, when positive, runs only the first Limit jobs of the source
+	// and ignores the rest, for example for a smoke test against a large
+	// listing. Totals are counted against Limit. A channel source is not
+	// received from after its Limit-th job.
+	Limit int
+	// StopAfterSuccesses, when positive, ends the run once that many jobs
+	// have succeeded, for sampling any N good files out of many. Failed and
+	// skipped jobs don't count. No new jobs start once the target is
+	// reached, and files still being read then are dropped uncounted, so
+	// exactly StopAfterSuccesses results reach processFunc. It is ignored
+	// by TransferFilesBatch.
+	StopAfterSuccesses int
+	// Shuffle feeds the jobs in a random order, so a listing sorted by
+	// directory doesn't hit one remote directory at a time. The order is
+	// drawn from ShuffleSeed, or from the clock if that is zero. Results
+	// placed in input order, as by CollectFiles, keep that order. It needs
+	// the jobs as a slice and can't be combined with Ordered.
+	Shuffle     bool
+	ShuffleSeed int64
+	// GroupByDir gives each reader its own share of the jobs, keeping the
+	// files of a directory together so consecutive reads on a connection
+	// hit the same directory, for backends where that is faster. Large
+	// directories are split to keep the shares even. Priorities and
+	// IdleTimeout are ignored, and like Shuffle it needs the jobs as a
+	// slice and can't be combined with Ordered.
+	GroupByDir bool
+	// PerFileTimeout bounds each attempt to open and read a file. A file
+	// that runs over is closed and fails with ErrFileTimeout. Zero means no
+	// timeout.
+	PerFileTimeout time.Duration
+	// MinThroughputBytesPerSec, when positive, closes a file whose reads
+	// deliver fewer bytes than this per second, averaged over a
+	// StallWindow, and fails the attempt with ErrStalled. It catches
+	// connections that trickle data rather than failing outright. It
+	// applies to the in-memory variants only, and must sit below any
+	// MaxBytesPerSec share a reader gets.
+	MinThroughputBytesPerSec int64
+	// StallWindow is the interval MinThroughputBytesPerSec is measured
+	// over. Zero means 10s.
+	StallWindow time.Duration
+	// KeepaliveInterval, when positive, makes a Pipeline ping its client
+	// that often, with Getwd if it has it or else a Stat of ".", so servers
+	// with idle timeouts don't drop the connection during lulls. The pings
+	// stop with the pipeline.
+	KeepaliveInterval time.Duration
+	// ProcessTimeout bounds each call of the ProcessFunc or
+	// BatchProcessFunc. A call that runs over fails its files with
+	// ErrProcessTimeout and the worker moves on, but the call itself can't
+	// be stopped and is left running in its own goroutine. Zero means no
+	// timeout.
+	ProcessTimeout time.Duration
+	// ProcessSemaphore, when positive, caps how many ProcessFunc or
+	// BatchProcessFunc calls run at once across all workers, for example to
+	// GOMAXPROCS for CPU-bound parsing. A call abandoned by ProcessTimeout
+	// holds its slot until it really returns. Zero means Workers is the
+	// only bound.
+	ProcessSemaphore int
+	// ZipMethod picks the compression method, such as zip.Store or
+	// zip.Deflate, of each entry TransferFilesToZip writes, given its name.
+	// Nil deflates everything.
+	ZipMethod func(name string) uint16
+	// HeadBytes, if positive, reads only the first HeadBytes of each file,
+	// for sampling. Smaller files are read whole.
+	HeadBytes int64
+	// Deadline bounds the whole run. When it elapses no new jobs start,
+	// in-flight reads are cancelled and TransferStats.DeadlineExceeded is
+	// set. Zero means no deadline.
+	Deadline time.Duration
+	// Adaptive is an experimental mode that starts with a few readers and
+	// tunes their number, up to SFTPReaders, from the throughput measured
+	// every AdaptiveInterval (default 250ms).
+	Adaptive         bool
+	AdaptiveInterval time.Duration
+	// IdleTimeout, when positive, starts readers only as jobs arrive, up to
+	// SFTPReaders, and lets a reader that has waited IdleTimeout for a job
+	// exit, so a sparse or bursty source such as TransferFilesChan doesn't
+	// keep every reader parked between bursts.
+	IdleTimeout time.Duration
+	// SkipExisting makes the to-disk variants skip a job when the local
+	// destination already exists with the remote file's size. The client
+	// must implement Stat.
+	SkipExisting bool
+	// PreservePaths makes TransferFilesToDir mirror each RemotePath under
+	// the destination directory, creating directories as needed, instead of
+	// naming files by ID.
+	PreservePaths bool
+	// NameFunc, if set, names each job's file under TransferFilesToDir's
+	// destination directory in place of its ID, overriding PreservePaths.
+	// The name may contain slashes to place files in subdirectories, which
+	// are created as needed, but must stay inside the directory.
+	NameFunc func(job FileJob) string
+	// Resume makes TransferFilesToDir download into a ".part" file that is
+	// kept when a transfer fails, and continue a later transfer from the
+	// end of it when the remote file can seek.
+	Resume bool
+	// Fsync makes TransferFilesToDir sync each file to disk before renaming
+	// it into place, and its directory after, so a crash can't lose a file
+	// reported as transferred.
+	// Each sync waits on the disk, which can cost more than the download
+	// on fast links with many small files.
+	Fsync bool
+	// PreserveAttrs makes TransferFilesToDir give each file the remote
+	// file's permission bits and modification time before it is renamed
+	// into place; failing to apply them fails the file. If the remote Stat
+	// fails the file keeps the defaults and a warning is logged.
+	PreserveAttrs bool
+	// NewClient dials a connection for TransferFilesDial, which opens up to
+	// PoolSize of them (default 1).
+	NewClient func() (SFTPClient, error)
+	PoolSize  int
+	// Stop, when closed, shuts a run down gracefully: no new files are
+	// started, but files already being read are finished and processed. The
+	// run then returns ErrStopped. Cancel the context instead to abort
+	// in-flight work too.
+	Stop <-chan struct{}
+	// BatchSize is the number of results TransferFilesBatch passes to its
+	// BatchProcessFunc at a time. Zero means 100.
+	BatchSize int
+	// ComputeChecksum fills FileResult.Checksum with the digest of each
+	// file, hashed while it is read.
+	ComputeChecksum bool
+	// ChecksumAlgo is the hash for ComputeChecksum and
+	// FileJob.ExpectedChecksum. The zero value is SHA-256.
+	ChecksumAlgo ChecksumAlgo
+	// Decompress gunzips files whose RemotePath ends in ".gz" as they are
+	// read, so FileResult.Data holds the decompressed bytes.
+	Decompress bool
+	// CompressResults gzips each file's data before it is passed to
+	// processFunc and sets FileResult.Compressed. The work is done by the
+	// Workers rather than the readers, and Checksum still covers the
+	// uncompressed data. The streaming variants ignore it.
+	CompressResults bool
+	// SniffContentType sets FileResult.ContentType from the first 512
+	// bytes of each file using http.DetectContentType. The streaming
+	// variants instead pass their process function a *SniffedReader, which
+	// has peeked at those bytes without consuming them.
+	SniffContentType bool
+	// SpillThreshold, when positive, makes the in-memory variants write a
+	// file larger than this many bytes to a temp file in SpillDir instead
+	// of holding it, passing processFunc its FileResult.SpillPath. Spilled
+	// results aren't compressed under CompressResults. Batch runs,
+	// CollectFiles and the tar and zip variants ignore it.
+	SpillThreshold int64
+	// SpillDir is where spilled files go. Empty means os.TempDir.
+	SpillDir string
+	// ChunkSize, when positive, makes the in-memory variants read each file
+	// larger than ChunkSize as ChunkSize pieces fetched in parallel with
+	// ReadAt, for a few large files on a high-latency link. It needs a
+	// client whose files support ReadAt, as *sftp.File does, and that can
+	// Stat them for their size; other files, and those Decompress gunzips,
+	// are read in one pass.
+	ChunkSize int64
+	// ChunkParallelism is the number of chunks of one file read at once
+	// under ChunkSize. Zero means 4.
+	ChunkParallelism int
+	// DryRun lists the files a run would transfer, with their sizes when the
+	// client implements Stat, without opening them or calling the process
+	// function. Each planned file counts as transferred.
+	DryRun bool
+	// MinBytes and MaxBytes skip files whose size, found with Stat before
+	// they are opened, falls outside [MinBytes, MaxBytes]. Zero means no
+	// bound. The client must implement Stat.
+	MinBytes int64
+	MaxBytes int64
+	// ModifiedAfter, if set, skips files whose modification time, found with
+	// Stat before they are opened, isn't after it, for incremental syncs
+	// from a checkpoint. The client must implement Stat.
+	ModifiedAfter time.Time
+	// SkipEmpty counts files that turn out to be empty once read as skipped
+	// instead of passing empty Data to processFunc. The streaming variants
+	// ignore it; MinBytes of 1 skips empty files before they are opened.
+	SkipEmpty bool
+	// Dedupe collapses jobs that share a RemotePath so the file is read
+	// once. See DedupeMode.
+	Dedupe DedupeMode
+	// OnFileStart is called when a reader starts on a job, and
+	// OnFileComplete once the job has finished, with its result and the
+	// error it failed with, if any; for ErrSkip the job was skipped. A job
+	// cut short by cancellation gets no OnFileComplete. Both run
+	// concurrently on pipeline goroutines. The streaming variants pass a
+	// result with only the ID.
+	OnFileStart    func(job FileJob)
+	OnFileComplete func(result FileResult, err error)
+	// Tracer records a span per file, with child spans for its open, read
+	// and process steps, under any span in the run's context. Nil uses the
+	// global OpenTelemetry tracer provider.
+	Tracer trace.Tracer
+	// Metrics are updated as each file finishes.
+	Metrics Metrics
+	// JSONLog, if set, receives a JSON object per finished job, one per
+	// line, with its id, path, bytes, duration_ms, status ("ok", "failed"
+	// or "skipped") and any error. Writes are serialized and their errors
+	// ignored.
+	JSONLog io.Writer
+	// CheckpointPath, if set, names a file the ID of every job that
+	// succeeds is appended to. Jobs whose IDs it already holds when a run
+	// starts are skipped without being opened, so a restarted run resumes
+	// where an interrupted one left off. IDs must not contain newlines. The
+	// file is synced periodically and when the run ends.
+	CheckpointPath string
+	// DeleteAfterTransfer removes each remote file, through a client that
+	// implements Remove, once its job has succeeded, making the run a move.
+	// Failed and skipped jobs are left in place, and in a DryRun nothing is
+	// removed. A removal that fails is logged and counted in
+	// TransferStats.RemoveFailed without failing the job. Under Dedupe the
+	// file goes once the first job sharing it succeeds.
+	DeleteAfterTransfer bool
+	// ArchiveDir, if set, is a remote directory each file is renamed into,
+	// keeping its base name, once its job has succeeded: a safer move than
+	// DeleteAfterTransfer, which it takes precedence over. The directory is
+	// created if the client can MkdirAll, and a name already taken there
+	// gets a numeric suffix. Like removals, a failed rename is logged and
+	// counted, in TransferStats.ArchiveFailed, without failing the job, and
+	// a file already moved by the first job sharing it counts as archived.
+	ArchiveDir string
+	// CheckConnection makes each run first check its clients with
+	// Preflight, returning the error without starting any job if one fails.
+	CheckConnection bool
+	// FailFast stops new jobs from starting at the first failed job, and the
+	// run returns that job's TransferError. Files in flight still finish.
+	FailFast bool
+	// MaxFailures, when positive, is a circuit breaker: once more than
+	// MaxFailures jobs have failed no new jobs start, files in flight still
+	// finish, and the run returns an error wrapping ErrCircuitBreakerTripped.
+	MaxFailures int
+	// RecoverPanics turns a panic in processFunc into a failure of that job,
+	// logged with its stack, instead of crashing the program. DefaultCfg
+	// sets it.
+	RecoverPanics bool
+	// Logger receives the run summary. Nil discards it; use log.Default()
+	// to print it.
+	Logger Logger
 }
 
 func DefaultCfg() PipelineCfg {
 	return PipelineCfg{
-		SFTPReaders: 80,
-		Workers:     10,
-		BufferSize:  10,
+		SFTPReaders:   80,
+		Workers:       10,
+		BufferSize:    10,
+		RecoverPanics: true,
 	}
 
 }
 
-func (cfg PipelineCfg) TransferFiles(sftpClient *sftp.Client, jobs []FileJob, processFunc ProcessFunc) (transferred int32, failed int32) {
+func (cfg PipelineCfg) TransferFiles(sftpClient SFTPClient, jobs []FileJob, processFunc ProcessFunc) (transferred int32, failed int32) {
+	transferred, failed, _ = cfg.TransferFilesCtx(context.Background(), sftpClient, jobs, processFunc)
+	return transferred, failed
+}
 
-	jobsChan := make(chan FileJob, len(jobs))
-	resultsChan := make(chan FileResult, cfg.BufferSize)
-	start := time.Now()
+// TransferFilesCtx is TransferFiles with cancellation. Once ctx is done no new
+// jobs are started, in-flight reads are interrupted by closing the file, and
+// the counts cover only what completed before cancellation.
+func (cfg PipelineCfg) TransferFilesCtx(ctx context.Context, sftpClient SFTPClient, jobs []FileJob, processFunc ProcessFunc) (transferred int32, failed int32, err error) {
+	stats, err := cfg.transfer(ctx, []SFTPClient{sftpClient}, fromSlice(jobs), processFunc, hooks{})
+	return stats.Transferred, stats.Failed, err
+}
 
-	// Add Jobs to `jobsChan`
-	go func() {
-		for _, job := range jobs {
-			jobsChan <- job
-		}
-		close(jobsChan)
-	}()
+// transfer runs the pipeline, binding reader i to clients[i%len(clients)].
+func (cfg PipelineCfg) transfer(ctx context.Context, clients []SFTPClient, jobs source[FileJob], processFunc ProcessFunc, h hooks) (TransferStats, error) {
+	if err := cfg.preflight(clients); err != nil {
+		return TransferStats{}, err
+	}
+	jobs, err := cfg.shuffle(limit(jobs, cfg.Limit))
+	if err == nil {
+		err = cfg.checkGroupByDir(jobs)
+	}
+	if err != nil {
+		return TransferStats{}, err
+	}
+
+	resultsChan := make(chan fileRead, cfg.BufferSize)
+	start := time.Now()
+	ctx, cancel := cfg.deadlineContext(ctx)
+	defer cancel()
+	r := cfg.newRun(clients, jobs.total, h.onError)
+	r.batch = cfg.newBatcher(h.batch)
+	r.pause = h.pause
+	if r.dedupe, err = cfg.newDedupe(ctx, jobs, true); err != nil {
+		return TransferStats{}, err
+	}
+	if r.checkpoint, err = cfg.newCheckpoint(); err != nil {
+		return TransferStats{}, err
+	}
+	defer r.closeCheckpoint()
+	startCtx, stopStarting := r.startContext(ctx)
+	defer stopStarting()
+	stopAdapting := r.adapt(ctx)
+	stopReporting := r.reportProgress(start)
+	stopStatus := r.reportStatus(start)
 
+	var window chan struct{}
+	if cfg.Ordered {
+		window = make(chan struct{}, cfg.reorderWindow())
+	}
 	// Spin up Go Routine for each `job`
 	var readWg sync.WaitGroup
-	for i := 0; i < cfg.SFTPReaders; i++ {
-		readWg.Go(func() {
-			for job := range jobsChan {
-				f, err := sftpClient.Open(job.RemotePath)
-				if err != nil {
-					atomic.AddInt32(&failed, 1)
-					continue
-				}
-				data, err := io.ReadAll(f)
-				f.Close()
-				if err != nil {
-					atomic.AddInt32(&failed, 1)
-					continue
-				}
-				resultsChan <- FileResult{ID: job.ID, Data: data}
-			}
-		})
-	}
+	feed := r.feedReaders(startCtx, &readWg, jobs, window, func(client SFTPClient, q queued[FileJob]) bool {
+		if startCtx.Err() != nil || !r.pause.wait(startCtx) {
+			return false
+		}
+		if !r.gate.acquire(startCtx) {
+			return false
+		}
+		r.started(q.job)
+		read := r.read(ctx, client, q)
+		read.result.ctx = startCtx
+		r.gate.release()
+		// A read cut short by cancellation didn't complete, so it isn't
+		// counted either way.
+		if read.err != nil && ctx.Err() != nil {
+			read.span.End()
+			return false
+		}
+		r.bytes.Add(read.size)
+		select {
+		case resultsChan <- read:
+			return true
+		case <-ctx.Done():
+			r.drop(read)
+			return false
+		}
+	})
 
 	// Wait for Jobs to be Read
 	go func() {
@@ -77,24 +459,552 @@ func (cfg PipelineCfg) TransferFiles(sftpClient *sftp.Client, jobs []FileJob, pr
 		close(resultsChan)
 	}()
 
+	processChan, workers := (<-chan fileRead)(resultsChan), cfg.Workers
+	if cfg.Ordered {
+		processChan, workers = reorder(ctx, resultsChan, window, r.inflight, r.drop), 1
+	} else if cfg.SizeAwareScheduling {
+		processChan = smallestFirst(ctx, resultsChan, max(cfg.BufferSize, 1), r.drop)
+	}
+
 	// Sping up Go Routine to 'processFunc' foreach job
 	var processWg sync.WaitGroup
-	for i := 0; i < cfg.Workers; i++ {
+	for i := 0; i < workers; i++ {
 		processWg.Go(func() {
-			for result := range resultsChan {
-				if err := processFunc(result); err != nil {
-					atomic.AddInt32(&failed, 1)
-				} else {
-					atomic.AddInt32(&transferred, 1)
+			for read := range processChan {
+				if ctx.Err() != nil {
+					r.drop(read)
+					return
+				}
+				if errors.Is(read.err, errFannedOut) {
+					read.span.End()
+					continue
+				}
+				for _, read := range r.dedupe.fanOut(read) {
+					r.deliver(ctx, read, processFunc, h)
 				}
+				r.unspill(read.result)
+				r.inflight.release(read.index, read.held)
 			}
 		})
 	}
 
-	// Wait for `processFunc` to complete
+	// Wait for `processFunc` to complete, and for readers and the feeder
+	// cut short by cancellation to unwind. Draining processChan waits out
+	// the goroutines that close it, so none outlive the run.
 	processWg.Wait()
+	for read := range processChan {
+		r.drop(read)
+	}
+	r.flushRest(ctx, h)
+	readWg.Wait()
+	<-feed.done
 
-	fmt.Printf("Transfer completed in %s. Success: %d, Failed: %d\n", time.Since(start), transferred, failed)
+	stopAdapting()
+	stopReporting()
+	stopStatus()
+	stats := r.summary(ctx, start)
 
-	return transferred, failed
+	return stats, r.runErr(ctx, feed.finished(stats))
+}
+
+// hooks are optional callbacks from transfer. Each is called concurrently
+// from pipeline goroutines.
+type hooks struct {
+	// onError is called for every failed job.
+	onError func(TransferError)
+	// onDone is called once for every job that finishes, with the read and
+	// the error the job ended with: nil, ErrSkip or a failure.
+	onDone func(read fileRead, err error)
+	// batch, if set, takes the place of processFunc: results are passed to
+	// it BatchSize at a time.
+	batch BatchProcessFunc
+	// pause, if set, holds readers back from starting jobs while paused.
+	pause *pause
+}
+
+func (h hooks) done(read fileRead, err error) {
+	if h.onDone != nil {
+		h.onDone(read, err)
+	}
+}
+
+// startContext returns the context that gates starting new jobs. It is done
+// when ctx is, once cfg.Stop is closed, or under FailFast or MaxFailures
+// once too many jobs have failed.
+func (r *run) startContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	cfg := r.cfg
+	if cfg.Stop == nil && r.failFast == nil && r.target == nil {
+		return ctx, func() {}
+	}
+	startCtx, cancel := context.WithCancel(ctx)
+	r.failFast.bind(cancel)
+	r.target.bind(cancel)
+	if cfg.Stop == nil {
+		return startCtx, cancel
+	}
+	go func() {
+		select {
+		case <-cfg.Stop:
+			cancel()
+		case <-startCtx.Done():
+		}
+	}()
+	return startCtx, cancel
+}
+
+// deadlineContext applies cfg.Deadline to a run's context.
+func (cfg PipelineCfg) deadlineContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if cfg.Deadline <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeoutCause(ctx, cfg.Deadline, errDeadline)
+}
+
+// deadlineExceeded reports whether cfg.Deadline, rather than the caller's
+// context, ended the run.
+func deadlineExceeded(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), errDeadline)
+}
+
+// runErr is the error a run returns: ctx's error if it was cancelled, or
+// ErrStopped if a graceful stop left jobs unstarted.
+func (cfg PipelineCfg) runErr(ctx context.Context, finished bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !finished {
+		select {
+		case <-cfg.Stop:
+			return ErrStopped
+		default:
+		}
+	}
+	return nil
+}
+
+// run holds the state shared by every goroutine of a single transfer.
+type run struct {
+	cfg     PipelineCfg
+	clients []SFTPClient
+	*tally
+	limiter  *rateLimiter
+	opens    *rateLimiter
+	gate     *gate
+	dedupe   *dedupe
+	inflight *inflight
+	failFast *failFast
+	batch    *batcher
+	pause    *pause
+	target   *target
+	procSem  procSem
+	// archiveDir is set when ArchiveDir is.
+	archiveDir *archiveDir
+	jsonLog    *jsonLog
+	checkpoint *checkpoint
+	tracer     trace.Tracer
+	// total is the number of jobs, or 0 if unknown.
+	total int
+}
+
+func (cfg PipelineCfg) newRun(clients []SFTPClient, total int, onError func(TransferError)) *run {
+	failFast := cfg.newFailFast()
+	r := &run{
+		cfg:      cfg,
+		clients:  clients,
+		tally:    cfg.newTally(total, failFast.wrap(onError)),
+		failFast: failFast,
+		total:    total,
+		limiter:  newRateLimiter(cfg.MaxBytesPerSec),
+		opens:    newRateLimiter(int64(cfg.MaxOpensPerSec)),
+		gate:     cfg.newGate(),
+		inflight: cfg.newInflight(),
+		target:   cfg.newTarget(),
+		procSem:  cfg.newProcSem(),
+		tracer:   cfg.tracer(),
+		jsonLog:  newJSONLog(cfg.JSONLog),
+	}
+	if cfg.ArchiveDir != "" {
+		r.archiveDir = &archiveDir{}
+	}
+	return r
+}
+
+// readerClient is the client reader i uses for its whole lifetime. Readers
+// are dealt out round-robin so each client serves an even share.
+func (r *run) readerClient(i int) SFTPClient {
+	return r.clients[i%len(r.clients)]
+}
+
+// open opens path for reading, subject to the run's rate limits. Under a
+// PerFileTimeout ctx is the file's own context and a hung Open is abandoned
+// when it expires.
+func (r *run) open(ctx context.Context, client SFTPClient, path string) (f io.ReadCloser, err error) {
+	ctx, span := r.tracer.Start(ctx, "sftp.open")
+	defer func() { endSpan(span, err) }()
+	if err := r.opens.wait(ctx, 1); err != nil {
+		return nil, err
+	}
+	if r.cfg.PerFileTimeout > 0 {
+		f, err = openCtx(ctx, client, path)
+	} else {
+		f, err = client.Open(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.limiter.wrap(ctx, f), nil
+}
+
+// fileContext derives the context for one attempt at a file from the run's
+// context, applying PerFileTimeout.
+func (r *run) fileContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.cfg.PerFileTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, r.cfg.PerFileTimeout)
+}
+
+// timeoutErr replaces err with ErrFileTimeout when fileCtx expired on its own
+// rather than because the run was cancelled.
+func (r *run) timeoutErr(ctx, fileCtx context.Context, err error) error {
+	if err != nil && ctx.Err() == nil && fileCtx.Err() != nil {
+		return fmt.Errorf("%w (%s): %v", ErrFileTimeout, r.cfg.PerFileTimeout, err)
+	}
+	return err
+}
+
+// openWithRetry opens path, retrying failed opens per the RetryPolicy.
+func (r *run) openWithRetry(ctx context.Context, client SFTPClient, path string) (io.ReadCloser, error) {
+	var f io.ReadCloser
+	err := r.cfg.retry(ctx, func() (err error) {
+		f, err = r.open(ctx, client, path)
+		return err
+	})
+	return f, err
+}
+
+// read reads q's file, or in a DryRun only plans it.
+func (r *run) read(ctx context.Context, client SFTPClient, q queued[FileJob]) fileRead {
+	read := fileRead{index: q.index, job: q.job, start: time.Now(), client: client}
+	ctx, read.span = r.startFileSpan(ctx, q.job)
+	if err := r.checkpoint.skip(q.job); err != nil {
+		read.err = err
+		return read
+	}
+	if err := r.dedupe.duplicate(q); err != nil {
+		read.err = err
+		return read
+	}
+	if err := r.checkStat(client, q.job); err != nil {
+		read.stage, read.err = StageStat, err
+		return read
+	}
+	if r.cfg.DryRun {
+		read.size, read.err = r.plan(client, q.job)
+		read.stage = StageStat
+		read.err = r.skipEmpty(q.job, read.size, read.err)
+		return read
+	}
+	held, err := r.reserve(ctx, client, q)
+	if err != nil {
+		read.stage, read.err = StageOpen, err
+		return read
+	}
+	read.result, read.stage, read.err = r.readFile(ctx, client, q.job)
+	read.size = read.result.size()
+	read.held = r.inflight.resize(q.index, held, int64(len(read.result.Data)))
+	read.err = r.skipEmpty(q.job, read.size, read.err)
+	return read
+}
+
+// drop discards a read that cancellation left undelivered.
+func (r *run) drop(read fileRead) {
+	r.unspill(read.result)
+	r.inflight.release(read.index, read.held)
+	read.span.End()
+}
+
+// deliver finishes a job given its read, passing the result to processFunc
+// unless the read failed or this is a DryRun. processFunc is called again
+// while it returns ErrRetryProcess and the RetryPolicy allows. In a batch
+// run the result joins the pending batch instead. A read that comes in once
+// StopAfterSuccesses is reached is dropped.
+func (r *run) deliver(ctx context.Context, read fileRead, processFunc ProcessFunc, h hooks) {
+	stage, err := read.stage, read.err
+	claimed := err == nil && r.batch == nil
+	if claimed && !r.target.claim() {
+		read.span.End()
+		return
+	}
+	if err == nil && !r.cfg.DryRun && r.cfg.CompressResults && read.result.SpillPath == "" {
+		stage = StageProcess
+		read.result, err = compressResult(read.result)
+	}
+	if err == nil && !r.cfg.DryRun {
+		if r.batch != nil {
+			r.flush(ctx, r.batch.add(read), h)
+			return
+		}
+		_, span := r.tracer.Start(trace.ContextWithSpan(context.Background(), read.span), "sftp.process")
+		stage, err = StageProcess, r.cfg.retryIf(ctx, isRetryProcess, func() error {
+			return r.bounded(func() error {
+				return r.protect(describe(read.job), func() error { return processFunc(read.result) })
+			})
+		})
+		endSpan(span, err)
+	}
+	r.settle(read, stage, err, h)
+	if claimed {
+		r.target.release(err == nil)
+	}
+}
+
+// settle records the outcome of a job that ended at stage with err.
+func (r *run) settle(read fileRead, stage Stage, err error, h hooks) {
+	read.span.SetAttributes(attrBytes.Int64(read.size))
+	endSpan(read.span, err)
+	r.finish(read.job, stage, err)
+	if err == nil {
+		r.dispose(read)
+	}
+	h.done(read, err)
+	r.completed(read, err)
+}
+
+// started calls OnFileStart, if set.
+func (r *run) started(job FileJob) {
+	if r.cfg.OnFileStart != nil {
+		r.cfg.OnFileStart(job)
+	}
+}
+
+// completed updates the Metrics, JSONLog and checkpoint for a finished job
+// and calls OnFileComplete, if set.
+func (r *run) completed(read fileRead, err error) {
+	elapsed := time.Since(read.start)
+	r.cfg.Metrics.observe(read.size, elapsed, err)
+	r.jsonLog.write(read, err)
+	if err == nil && !r.cfg.DryRun {
+		r.latency.observe(elapsed)
+		r.checkpointed(read.job)
+	}
+	if r.cfg.OnFileComplete != nil {
+		result := read.result
+		result.ID = read.job.ID
+		r.cfg.OnFileComplete(result, err)
+	}
+}
+
+// readFile reads job's file, re-opening it from scratch after each failure
+// per the RetryPolicy. On error it reports the stage that failed.
+func (r *run) readFile(ctx context.Context, client SFTPClient, job FileJob) (result FileResult, stage Stage, err error) {
+	err = r.cfg.retry(ctx, func() (err error) {
+		result, stage, err = r.readOnce(ctx, client, job)
+		return err
+	})
+	return result, stage, err
+}
+
+// readOnce opens and reads job's file, closing it early if ctx is cancelled
+// or the file times out so a blocked ReadAll returns.
+func (r *run) readOnce(ctx context.Context, client SFTPClient, job FileJob) (FileResult, Stage, error) {
+	fileCtx, cancel := r.fileContext(ctx)
+	defer cancel()
+
+	f, err := r.open(fileCtx, client, job.RemotePath)
+	if err != nil {
+		return FileResult{}, StageOpen, r.timeoutErr(ctx, fileCtx, err)
+	}
+	f, watch := r.watchStall(f)
+	defer watch.stop()
+	stop := context.AfterFunc(fileCtx, func() { f.Close() })
+	_, span := r.tracer.Start(fileCtx, "sftp.read")
+	h := newHasher(job, r.cfg.ChecksumAlgo, r.cfg.ComputeChecksum)
+	var result FileResult
+	if size, ok := r.chunkSize(client, job, f); ok {
+		result.Data, err = r.readChunks(fileCtx, f.(io.ReaderAt), size, h)
+	} else {
+		result, err = r.readAll(job, f, h)
+	}
+	if stop() {
+		f.Close()
+	}
+	if err == nil {
+		err = h.check()
+	} else {
+		err = r.stallErr(watch, r.timeoutErr(ctx, fileCtx, err))
+	}
+	span.SetAttributes(attrBytes.Int64(result.size()))
+	endSpan(span, err)
+	if err != nil {
+		r.unspill(result)
+		return FileResult{}, StageRead, err
+	}
+	result.ID, result.Checksum, result.Meta = job.ID, h.sum(), job.Meta
+	if result.SpillPath == "" {
+		result.ContentType = r.contentType(result.Data)
+	}
+	return result, StageRead, nil
+}
+
+// openCtx is client.Open that gives up once ctx is done. The abandoned Open
+// carries on in the background and its file is closed if it ever returns.
+func openCtx(ctx context.Context, client SFTPClient, path string) (io.ReadCloser, error) {
+	type opened struct {
+		f   io.ReadCloser
+		err error
+	}
+	ch := make(chan opened, 1)
+	go func() {
+		f, err := client.Open(path)
+		ch <- opened{f, err}
+	}()
+	select {
+	case o := <-ch:
+		return o.f, o.err
+	case <-ctx.Done():
+		go func() {
+			if o := <-ch; o.err == nil {
+				o.f.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// tally records the outcome of each job in a run. Its methods are safe for
+// concurrent use. Each job must reach exactly one of success, skip or fail,
+// which is what keeps the totals reconciled with the job count: a failed read
+// is recorded by the worker that receives it and never reaches processFunc.
+type tally struct {
+	transferred atomic.Int32
+	failed      atomic.Int32
+	skipped     atomic.Int32
+	// processTimeouts counts the failures that were ProcessTimeouts.
+	processTimeouts atomic.Int32
+	// removeFailed counts the successes DeleteAfterTransfer couldn't remove.
+	removeFailed atomic.Int32
+	// archiveFailed counts the successes that couldn't be moved into
+	// ArchiveDir.
+	archiveFailed atomic.Int32
+	bytes         atomic.Int64
+	// latency samples the durations of the files transferred.
+	latency  latencies
+	onError  func(TransferError)
+	progress *progress
+}
+
+func (cfg PipelineCfg) newTally(total int, onError func(TransferError)) *tally {
+	return &tally{onError: onError, progress: newProgress(cfg.Progress, total)}
+}
+
+func (t *tally) success() {
+	t.transferred.Add(1)
+	t.progress.step()
+}
+
+// skip records a job that was deliberately not transferred.
+func (t *tally) skip() {
+	t.skipped.Add(1)
+	t.progress.step()
+}
+
+// finish records the outcome of a job given the error its last stage
+// returned: success for nil, a skip for ErrSkip and a failure otherwise.
+func (t *tally) finish(job FileJob, stage Stage, err error) {
+	switch {
+	case err == nil:
+		t.success()
+	case errors.Is(err, ErrSkip):
+		t.skip()
+	default:
+		t.fail(job, stage, err)
+	}
+}
+
+func (t *tally) fail(job FileJob, stage Stage, err error) {
+	t.failed.Add(1)
+	if errors.Is(err, ErrProcessTimeout) {
+		t.processTimeouts.Add(1)
+	}
+	if t.onError != nil {
+		t.onError(TransferError{ID: job.ID, RemotePath: job.RemotePath, Stage: stage, Kind: KindOf(err), Err: err})
+	}
+	t.progress.step()
+}
+
+// feed is the channel a run's readers take jobs from, tagged with their
+// index.
+type feed[T any] struct {
+	jobs <-chan queued[T]
+	// sent is the number of jobs sent, stored once the source has been
+	// exhausted. It is -1 until then.
+	sent atomic.Int64
+	// done is closed once the feeder stops pulling from the source.
+	done chan struct{}
+}
+
+// finished reports whether every job of the source was sent and counted.
+func (f *feed[T]) finished(stats TransferStats) bool {
+	n := f.sent.Load()
+	return n >= 0 && int64(stats.Transferred+stats.Failed+stats.Skipped) == n
+}
+
+// feedJobs pulls jobs from src on demand into a channel of capacity size that
+// is closed once src is exhausted or ctx is done, so a large or unbounded
+// source is never held in memory. If window is non-nil a slot in it is taken
+// before each job is sent, so at most cap(window) jobs are out until their
+// slots are released.
+func feedJobs[T any](ctx context.Context, src source[T], size int, window chan struct{}) *feed[T] {
+	jobsChan := make(chan queued[T], max(size, 1))
+	done := make(chan struct{})
+	f := &feed[T]{jobs: jobsChan, done: done}
+	f.sent.Store(-1)
+
+	// Add Jobs to `jobsChan`
+	go func() {
+		defer close(done)
+		defer close(jobsChan)
+		i := 0
+		for job := range src.jobs(ctx) {
+			if window != nil {
+				select {
+				case window <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case jobsChan <- queued[T]{index: src.index(i), job: job}:
+			case <-ctx.Done():
+				return
+			}
+			i++
+		}
+		if ctx.Err() == nil {
+			f.sent.Store(int64(i))
+		}
+	}()
+	return f
+}
+
+// feedReaders starts the run's feeder and its readers on jobs, or under
+// GroupByDir a feeder per reader. The feeders' context also ends once every
+// reader in wg has exited, so a feeder blocked on a send that no reader will
+// take, because they all gave up early, exits instead of leaking with the
+// source half read.
+func (r *run) feedReaders(ctx context.Context, wg *sync.WaitGroup, jobs source[FileJob], window chan struct{}, read func(SFTPClient, queued[FileJob]) bool) *feed[FileJob] {
+	feedCtx, abandon := context.WithCancel(ctx)
+	var f *feed[FileJob]
+	if r.cfg.GroupByDir {
+		f = r.feedByDir(feedCtx, wg, jobs, read)
+	} else {
+		f = r.cfg.feed(feedCtx, jobs, window)
+		r.readers(ctx, wg, f.jobs, read)
+	}
+	go func() {
+		wg.Wait()
+		abandon()
+	}()
+	return f
 }
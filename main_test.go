@@ -2,44 +2,59 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"io"
-	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/MYK12397/sftp-go/sftptest"
 )
 
-type mockSFTPClient struct {
-	files map[string][]byte
+// newFakeClient returns a FakeClient serving each of files at its path.
+func newFakeClient(files map[string][]byte) *sftptest.FakeClient {
+	client := sftptest.NewFakeClient()
+	for path, data := range files {
+		client.AddData(path, data)
+	}
+	return client
 }
 
-func (m *mockSFTPClient) Open(path string) (io.ReadCloser, error) {
-	data, ok := m.files[path]
-	if !ok {
-		return nil, fmt.Errorf("file not found: %s", path)
+// fileJobs serves file n times on client, at /remote/file_<i>.bin, and
+// returns a job for each with ID id_<i>.
+func fileJobs(client *sftptest.FakeClient, n int, file sftptest.File) []FileJob {
+	jobs := make([]FileJob, n)
+	for i := range jobs {
+		path := fmt.Sprintf("/remote/file_%d.bin", i)
+		client.Add(path, file)
+		jobs[i] = FileJob{RemotePath: path, ID: fmt.Sprintf("id_%d", i)}
 	}
-	return io.NopCloser(bytes.NewReader(data)), nil
+	return jobs
+}
+
+// opened returns how many times client has been asked to open the files
+// jobs read, whether or not the Opens succeeded.
+func opened(client *sftptest.FakeClient, jobs []FileJob) int32 {
+	seen := map[string]bool{}
+	var n int32
+	for _, job := range jobs {
+		if !seen[job.RemotePath] {
+			seen[job.RemotePath] = true
+			n += int32(client.Opens(job.RemotePath))
+		}
+	}
+	return n
 }
 
 func BenchmarkTransferFiles(b *testing.B) {
 	numFiles := 1000
 	fileSize := 1024 * 500
 
-	mockClient := &mockSFTPClient{
-		files: make(map[string][]byte),
-	}
+	mockClient := sftptest.NewFakeClient()
 
 	// Create test files
-	jobs := make([]FileJob, numFiles)
-	for i := 0; i < numFiles; i++ {
-		path := fmt.Sprintf("/remote/file_%d.bin", i)
-		mockClient.files[path] = bytes.Repeat([]byte("x"), fileSize)
-		jobs[i] = FileJob{
-			RemotePath: path,
-			ID:         fmt.Sprintf("id_%d", i),
-		}
-	}
+	jobs := fileJobs(mockClient, numFiles, sftptest.File{Data: bytes.Repeat([]byte("x"), fileSize)})
 
 	processFunc := func(result FileResult) error {
 		if len(result.Data) == 0 {
@@ -52,7 +67,7 @@ func BenchmarkTransferFiles(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		transferred, failed := cfg.TransferFilesMock(mockClient, jobs, processFunc)
+		transferred, failed := cfg.TransferFiles(mockClient, jobs, processFunc)
 		if failed > 0 {
 			b.Fatalf("benchmark failed: %d files failed to transfer", failed)
 		}
@@ -67,19 +82,9 @@ func BenchmarkTransferFilesVariousConfigs(b *testing.B) {
 	numFiles := 1000
 	fileSize := 1024 * 100
 
-	mockClient := &mockSFTPClient{
-		files: make(map[string][]byte),
-	}
+	mockClient := sftptest.NewFakeClient()
 
-	jobs := make([]FileJob, numFiles)
-	for i := 0; i < numFiles; i++ {
-		path := fmt.Sprintf("/remote/file_%d.bin", i)
-		mockClient.files[path] = bytes.Repeat([]byte("x"), fileSize)
-		jobs[i] = FileJob{
-			RemotePath: path,
-			ID:         fmt.Sprintf("id_%d", i),
-		}
-	}
+	jobs := fileJobs(mockClient, numFiles, sftptest.File{Data: bytes.Repeat([]byte("x"), fileSize)})
 
 	processFunc := func(result FileResult) error {
 		if len(result.Data) == 0 {
@@ -101,7 +106,7 @@ func BenchmarkTransferFilesVariousConfigs(b *testing.B) {
 	for _, cfg := range configs {
 		b.Run(cfg.name, func(b *testing.B) {
 			for i := 0; i < b.N; i++ {
-				transferred, failed := cfg.cfg.TransferFilesMock(mockClient, jobs, processFunc)
+				transferred, failed := cfg.cfg.TransferFiles(mockClient, jobs, processFunc)
 				if failed > 0 || transferred != int32(numFiles) {
 					b.Fatalf("failed: transferred=%d, failed=%d", transferred, failed)
 				}
@@ -110,68 +115,54 @@ func BenchmarkTransferFilesVariousConfigs(b *testing.B) {
 	}
 }
 
-// TransferFilesMock is a test-friendly wrapper that accepts the mock client
-func (cfg PipelineCfg) TransferFilesMock(client interface {
-	Open(string) (io.ReadCloser, error)
-}, jobs []FileJob, processFunc ProcessFunc,
-) (transferred int32, failed int32) {
-	jobsChan := make(chan FileJob, len(jobs))
-	resultsChan := make(chan FileResult, cfg.BufferSize)
-	start := time.Now()
+var (
+	// dataFile is a small remote file that reads normally.
+	dataFile = sftptest.File{Data: []byte("data")}
+	// slowFile is dataFile with each read taking a little while.
+	slowFile = sftptest.File{Data: []byte("data"), ReadLatency: 5 * time.Millisecond}
+	// hangingFile is a remote file whose reads block until it is closed.
+	hangingFile = sftptest.File{ReadLatency: time.Hour}
+)
 
-	// Add Jobs to `jobsChan`
-	go func() {
-		for _, job := range jobs {
-			jobsChan <- job
-		}
-		close(jobsChan)
-	}()
+func TestTransferFilesCtxCancel(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	jobs := fileJobs(client, 20, dataFile)
+	for i := 0; i < 100; i++ {
+		path := fmt.Sprintf("/remote/hang_%d.bin", i)
+		client.Add(path, hangingFile)
+		jobs = append(jobs, FileJob{RemotePath: path, ID: fmt.Sprintf("hang_%d", i)})
+	}
 
-	// Spin up Go Routine for each `job`
-	var readWg sync.WaitGroup
-	for i := 0; i < cfg.SFTPReaders; i++ {
-		readWg.Go(func() {
-			for job := range jobsChan {
-				f, err := client.Open(job.RemotePath)
-				if err != nil {
-					atomic.AddInt32(&failed, 1)
-					continue
-				}
-				data, err := io.ReadAll(f)
-				f.Close()
-				if err != nil {
-					atomic.AddInt32(&failed, 1)
-					continue
-				}
-				resultsChan <- FileResult{ID: job.ID, Data: data}
-			}
-		})
+	ctx, cancel := context.WithCancel(context.Background())
+	var processed atomic.Int32
+	processFunc := func(result FileResult) error {
+		if processed.Add(1) == 20 {
+			cancel()
+		}
+		return nil
 	}
 
-	// Wait for Jobs to be Read
+	cfg := PipelineCfg{SFTPReaders: 4, Workers: 2, BufferSize: 1}
+	done := make(chan struct{})
+	var transferred, failed int32
+	var err error
 	go func() {
-		readWg.Wait()
-		close(resultsChan)
+		transferred, failed, err = cfg.TransferFilesCtx(ctx, client, jobs, processFunc)
+		close(done)
 	}()
 
-	// Sping up Go Routine to 'processFunc' foreach job
-	var processWg sync.WaitGroup
-	for i := 0; i < cfg.Workers; i++ {
-		processWg.Go(func() {
-			for result := range resultsChan {
-				if err := processFunc(result); err != nil {
-					atomic.AddInt32(&failed, 1)
-				} else {
-					atomic.AddInt32(&transferred, 1)
-				}
-			}
-		})
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("transfer did not return after cancellation")
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if failed != 0 {
+		t.Errorf("interrupted reads should not count as failed, got %d", failed)
+	}
+	if transferred > 20 {
+		t.Errorf("expected at most 20 transfers, got %d", transferred)
 	}
-
-	// Wait for `processFunc` to complete
-	processWg.Wait()
-
-	elapsed := time.Since(start)
-	fmt.Printf("Transfer completed in %s. Success: %d, Failed: %d\n", elapsed, transferred, failed)
-	return transferred, failed
 }
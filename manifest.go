@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// Manifest statuses
+const (
+	StatusTransferred = "transferred"
+	StatusFailed      = "failed"
+	StatusSkipped     = "skipped"
+)
+
+// ManifestEntry records how one job ended.
+type ManifestEntry struct {
+	ID         string `json:"id"`
+	RemotePath string `json:"remote_path"`
+	Bytes      int64  `json:"bytes"`
+	Checksum   string `json:"checksum,omitempty"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+}
+
+// TransferFilesManifest is TransferFilesStats returning a ManifestEntry per
+// finished job, in input order, ready to be marshalled to JSON. Checksums are
+// always computed. Jobs a cancelled run never finished have no entry.
+func (cfg PipelineCfg) TransferFilesManifest(ctx context.Context, sftpClient SFTPClient, jobs []FileJob, processFunc ProcessFunc) ([]ManifestEntry, error) {
+	cfg.ComputeChecksum = true
+	// Every job finishes at most once, so each slot has a single writer
+	entries := make([]ManifestEntry, len(jobs))
+	done := make([]bool, len(jobs))
+	_, err := cfg.transfer(ctx, []SFTPClient{sftpClient}, fromSlice(jobs), processFunc, hooks{
+		onDone: func(read fileRead, err error) {
+			entries[read.index] = newManifestEntry(read, err)
+			done[read.index] = true
+		},
+	})
+
+	manifest := entries[:0]
+	for i, e := range entries {
+		if done[i] {
+			manifest = append(manifest, e)
+		}
+	}
+	return manifest, err
+}
+
+func newManifestEntry(read fileRead, err error) ManifestEntry {
+	e := ManifestEntry{
+		ID:         read.job.ID,
+		RemotePath: read.job.RemotePath,
+		Bytes:      read.size,
+		Checksum:   read.result.Checksum,
+		Status:     StatusTransferred,
+	}
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrSkip):
+		e.Status = StatusSkipped
+	default:
+		e.Status, e.Error = StatusFailed, err.Error()
+	}
+	return e
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestTransferFilesManifest(t *testing.T) {
+	client := newFakeClient(map[string][]byte{
+		"/remote/a.bin": []byte("alpha"),
+		"/remote/b.bin": []byte("beta"),
+		"/remote/c.bin": []byte("gamma"),
+	})
+	jobs := []FileJob{
+		{RemotePath: "/remote/a.bin", ID: "a"},
+		{RemotePath: "/remote/missing.bin", ID: "missing"},
+		{RemotePath: "/remote/b.bin", ID: "b"},
+		{RemotePath: "/remote/c.bin", ID: "c"},
+	}
+	processFunc := func(r FileResult) error {
+		switch r.ID {
+		case "b":
+			return ErrSkip
+		case "c":
+			return errors.New("upload rejected")
+		}
+		return nil
+	}
+
+	manifest, err := DefaultCfg().TransferFilesManifest(context.Background(), client, jobs, processFunc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest) != len(jobs) {
+		t.Fatalf("expected %d entries, got %d", len(jobs), len(manifest))
+	}
+	sum := sha256.Sum256([]byte("alpha"))
+	want := []ManifestEntry{
+		{ID: "a", RemotePath: "/remote/a.bin", Bytes: 5, Checksum: hex.EncodeToString(sum[:]), Status: StatusTransferred},
+		{ID: "missing", RemotePath: "/remote/missing.bin", Status: StatusFailed},
+		{ID: "b", RemotePath: "/remote/b.bin", Bytes: 4, Status: StatusSkipped},
+		{ID: "c", RemotePath: "/remote/c.bin", Bytes: 5, Status: StatusFailed},
+	}
+	for i, e := range manifest {
+		w := want[i]
+		if e.ID != w.ID || e.RemotePath != w.RemotePath || e.Bytes != w.Bytes || e.Status != w.Status {
+			t.Errorf("entry %d = %+v, want %+v", i, e, w)
+		}
+		if w.Checksum != "" && e.Checksum != w.Checksum {
+			t.Errorf("%s: Checksum = %q, want %q", e.ID, e.Checksum, w.Checksum)
+		}
+		if (e.Status == StatusFailed) != (e.Error != "") {
+			t.Errorf("%s: Error = %q with status %s", e.ID, e.Error, e.Status)
+		}
+	}
+
+	if _, err := json.Marshal(manifest); err != nil {
+		t.Errorf("manifest doesn't marshal: %v", err)
+	}
+}
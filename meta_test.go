@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestMetaReachesResult(t *testing.T) {
+	client := newFakeClient(map[string][]byte{"/remote/shared.bin": []byte("shared")})
+	jobs := fileJobs(client, 20, dataFile)
+	for i := range jobs {
+		jobs[i].Meta = map[string]string{
+			"tenant":   fmt.Sprintf("tenant-%d", i%3),
+			"category": "invoices",
+		}
+	}
+	jobs = append(jobs,
+		FileJob{RemotePath: "/remote/shared.bin", ID: "first", Meta: map[string]string{"tenant": "a"}},
+		FileJob{RemotePath: "/remote/shared.bin", ID: "second", Meta: map[string]string{"tenant": "b"}},
+		FileJob{RemotePath: "/remote/file_0.bin", ID: "none"},
+	)
+
+	var mu sync.Mutex
+	got := map[string]map[string]string{}
+	cfg := DefaultCfg()
+	cfg.Dedupe = DedupeFanOut
+	cfg.TransferFiles(client, jobs, func(r FileResult) error {
+		mu.Lock()
+		got[r.ID] = r.Meta
+		mu.Unlock()
+		return nil
+	})
+
+	for _, job := range jobs {
+		meta, ok := got[job.ID]
+		if !ok {
+			t.Errorf("%s: not processed", job.ID)
+			continue
+		}
+		if len(meta) != len(job.Meta) {
+			t.Errorf("%s: Meta = %v, want %v", job.ID, meta, job.Meta)
+		}
+		for k, v := range job.Meta {
+			if meta[k] != v {
+				t.Errorf("%s: Meta[%q] = %q, want %q", job.ID, k, meta[k], v)
+			}
+		}
+	}
+}
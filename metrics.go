@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// Counter is a metric that only goes up, such as a prometheus.Counter.
+type Counter interface {
+	Inc()
+}
+
+// Observer records samples into a distribution, such as a
+// prometheus.Histogram.
+type Observer interface {
+	Observe(float64)
+}
+
+// Metrics are the instruments a run updates as each file finishes; any may be
+// nil. Prometheus counters and histograms satisfy the interfaces, and the
+// conventional names are sftp_files_transferred_total,
+// sftp_files_failed_total, sftp_file_bytes and sftp_file_duration_seconds.
+// The histograms only observe transferred files. Instruments are updated
+// concurrently from pipeline goroutines.
+type Metrics struct {
+	FilesTransferred Counter
+	FilesFailed      Counter
+	FileBytes        Observer
+	FileDuration     Observer
+}
+
+func (m Metrics) observe(bytes int64, elapsed time.Duration, err error) {
+	switch {
+	case err == nil:
+		if m.FilesTransferred != nil {
+			m.FilesTransferred.Inc()
+		}
+		if m.FileBytes != nil {
+			m.FileBytes.Observe(float64(bytes))
+		}
+		if m.FileDuration != nil {
+			m.FileDuration.Observe(elapsed.Seconds())
+		}
+	case errors.Is(err, ErrSkip):
+	default:
+		if m.FilesFailed != nil {
+			m.FilesFailed.Inc()
+		}
+	}
+}
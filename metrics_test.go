@@ -0,0 +1,76 @@
+package main
+
+import (
+	"io"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+type fakeCounter struct{ n atomic.Int64 }
+
+func (c *fakeCounter) Inc() { c.n.Add(1) }
+
+type fakeHistogram struct {
+	mu      sync.Mutex
+	samples []float64
+}
+
+func (h *fakeHistogram) Observe(v float64) {
+	h.mu.Lock()
+	h.samples = append(h.samples, v)
+	h.mu.Unlock()
+}
+
+func TestMetrics(t *testing.T) {
+	client := newFakeClient(map[string][]byte{
+		"/remote/a.bin":    []byte("alpha"),
+		"/remote/b.bin":    []byte("beta"),
+		"/remote/skip.bin": []byte("skip"),
+	})
+	jobs := []FileJob{
+		{RemotePath: "/remote/a.bin", ID: "a"},
+		{RemotePath: "/remote/b.bin", ID: "b"},
+		{RemotePath: "/remote/skip.bin", ID: "skip"},
+		{RemotePath: "/remote/missing.bin", ID: "missing"},
+		{RemotePath: "/remote/gone.bin", ID: "gone"},
+	}
+
+	run := func(name string, transfer func(cfg PipelineCfg)) {
+		var transferred, failed fakeCounter
+		var bytes, duration fakeHistogram
+		cfg := DefaultCfg()
+		cfg.Metrics = Metrics{FilesTransferred: &transferred, FilesFailed: &failed, FileBytes: &bytes, FileDuration: &duration}
+		transfer(cfg)
+
+		if transferred.n.Load() != 2 || failed.n.Load() != 2 {
+			t.Errorf("%s: transferred = %d, failed = %d, want 2 and 2", name, transferred.n.Load(), failed.n.Load())
+		}
+		slices.Sort(bytes.samples)
+		if !slices.Equal(bytes.samples, []float64{4, 5}) {
+			t.Errorf("%s: byte samples %v, want [4 5]", name, bytes.samples)
+		}
+		if len(duration.samples) != 2 {
+			t.Errorf("%s: expected 2 duration samples, got %v", name, duration.samples)
+		}
+	}
+
+	run("in memory", func(cfg PipelineCfg) {
+		cfg.TransferFiles(client, jobs, func(r FileResult) error {
+			if r.ID == "skip" {
+				return ErrSkip
+			}
+			return nil
+		})
+	})
+	run("streaming", func(cfg PipelineCfg) {
+		cfg.TransferFilesStreaming(client, jobs, func(id string, r io.Reader) error {
+			if id == "skip" {
+				return ErrSkip
+			}
+			_, err := io.Copy(io.Discard, r)
+			return err
+		})
+	})
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ProcessMiddleware wraps a ProcessFunc with behaviour that applies to every
+// file, such as timing, logging or retries.
+type ProcessMiddleware func(next ProcessFunc) ProcessFunc
+
+// Wrap returns processFunc wrapped in middlewares, the first outermost: it
+// sees each result first and each error last.
+func Wrap(processFunc ProcessFunc, middlewares ...ProcessMiddleware) ProcessFunc {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		processFunc = middlewares[i](processFunc)
+	}
+	return processFunc
+}
+
+// Timing calls record with how long each call of the wrapped ProcessFunc
+// took and what it returned. record may be called concurrently.
+func Timing(record func(result FileResult, d time.Duration, err error)) ProcessMiddleware {
+	return func(next ProcessFunc) ProcessFunc {
+		return func(result FileResult) error {
+			start := time.Now()
+			err := next(result)
+			record(result, time.Since(start), err)
+			return err
+		}
+	}
+}
+
+// context is the run's context for waits on result's behalf, or
+// context.Background for a result made outside a run.
+func (r FileResult) context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// Recover turns a panic in the wrapped ProcessFunc into an error wrapping
+// ErrPanic, as RecoverPanics does for the whole processing step but without
+// the stack being logged.
+func Recover() ProcessMiddleware {
+	return func(next ProcessFunc) ProcessFunc {
+		return func(result FileResult) (err error) {
+			defer func() {
+				if v := recover(); v != nil {
+					err = fmt.Errorf("%w: %v", ErrPanic, v)
+				}
+			}()
+			return next(result)
+		}
+	}
+}
+
+// Retry calls the wrapped ProcessFunc again with the same result on any
+// error but ErrSkip, with policy's backoff, until it succeeds or policy gives
+// up. ErrRetryProcess does the same for a ProcessFunc that asks for it, but
+// only when that error is returned. A wait is cut short, and the last error
+// returned, once the run is cancelled, reaches its Deadline or stops
+// starting files.
+func Retry(policy RetryPolicy) ProcessMiddleware {
+	retriable := func(err error) bool { return !errors.Is(err, ErrSkip) }
+	return func(next ProcessFunc) ProcessFunc {
+		return func(result FileResult) error {
+			return policy.retryIf(result.context(), retriable, func() error {
+				return next(result)
+			})
+		}
+	}
+}
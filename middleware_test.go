@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWrapOrder(t *testing.T) {
+	var calls []string
+	tag := func(name string) ProcessMiddleware {
+		return func(next ProcessFunc) ProcessFunc {
+			return func(result FileResult) error {
+				calls = append(calls, name+" in")
+				err := next(result)
+				calls = append(calls, name+" out")
+				return err
+			}
+		}
+	}
+	processFunc := Wrap(func(FileResult) error {
+		calls = append(calls, "process")
+		return nil
+	}, tag("a"), tag("b"))
+	if err := processFunc(FileResult{}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a in", "b in", "process", "b out", "a out"}
+	if !slices.Equal(calls, want) {
+		t.Errorf("expected %v, got %v", want, calls)
+	}
+}
+
+func TestTiming(t *testing.T) {
+	client := newFakeClient(map[string][]byte{
+		"/remote/a.bin": []byte("a"),
+		"/remote/b.bin": []byte("b"),
+	})
+	jobs := []FileJob{
+		{RemotePath: "/remote/a.bin", ID: "a"},
+		{RemotePath: "/remote/b.bin", ID: "b"},
+	}
+	var mu sync.Mutex
+	durations := map[string]time.Duration{}
+	timing := Timing(func(result FileResult, d time.Duration, err error) {
+		mu.Lock()
+		durations[result.ID] = d
+		mu.Unlock()
+	})
+	processFunc := Wrap(func(FileResult) error {
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	}, timing)
+	if transferred, failed := DefaultCfg().TransferFiles(client, jobs, processFunc); transferred != 2 || failed != 0 {
+		t.Fatalf("expected 2 transfers, got %d, %d failed", transferred, failed)
+	}
+	if len(durations) != 2 {
+		t.Fatalf("expected 2 durations, got %v", durations)
+	}
+	for id, d := range durations {
+		if d < 20*time.Millisecond {
+			t.Errorf("%s: expected at least 20ms, got %v", id, d)
+		}
+	}
+}
+
+func TestRecoverAndRetry(t *testing.T) {
+	var attempts int
+	processFunc := Wrap(func(FileResult) error {
+		attempts++
+		if attempts < 3 {
+			panic("flaky")
+		}
+		return nil
+	}, Retry(RetryPolicy{MaxRetries: 3}), Recover())
+	if err := processFunc(FileResult{}); err != nil || attempts != 3 {
+		t.Fatalf("expected success on attempt 3, got %v after %d", err, attempts)
+	}
+
+	attempts = 0
+	err := Wrap(func(FileResult) error {
+		attempts++
+		panic("always")
+	}, Retry(RetryPolicy{MaxRetries: 2}), Recover())(FileResult{})
+	if !errors.Is(err, ErrPanic) || !strings.Contains(err.Error(), "always") || attempts != 3 {
+		t.Errorf("expected ErrPanic after 3 attempts, got %v after %d", err, attempts)
+	}
+
+	attempts = 0
+	err = Wrap(func(FileResult) error {
+		attempts++
+		return ErrSkip
+	}, Retry(RetryPolicy{MaxRetries: 2}))(FileResult{})
+	if !errors.Is(err, ErrSkip) || attempts != 1 {
+		t.Errorf("expected ErrSkip without retries, got %v after %d", err, attempts)
+	}
+}
+
+func TestRetryStopsWithRun(t *testing.T) {
+	client := newFakeClient(map[string][]byte{"/remote/a.bin": []byte("a")})
+	jobs := []FileJob{{RemotePath: "/remote/a.bin", ID: "a"}}
+	for name, stop := range map[string]func(cfg *PipelineCfg) func(){
+		"cancel": func(*PipelineCfg) func() { return nil },
+		"stop": func(cfg *PipelineCfg) func() {
+			ch := make(chan struct{})
+			cfg.Stop = ch
+			return func() { close(ch) }
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			cfg := DefaultCfg()
+			end := stop(&cfg)
+			if end == nil {
+				end = cancel
+			}
+			var attempts atomic.Int32
+			processFunc := Wrap(func(FileResult) error {
+				if attempts.Add(1) == 1 {
+					end()
+				}
+				return errors.New("unavailable")
+			}, Retry(RetryPolicy{MaxRetries: 5, BackoffBase: time.Minute}))
+			start := time.Now()
+			cfg.TransferFilesStats(ctx, client, jobs, processFunc)
+			if d := time.Since(start); d > 5*time.Second || attempts.Load() != 1 {
+				t.Errorf("expected the backoff cut short after 1 attempt, got %d in %v", attempts.Load(), d)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import "context"
+
+func (cfg PipelineCfg) reorderWindow() int {
+	if cfg.ReorderWindow > 0 {
+		return cfg.ReorderWindow
+	}
+	return max(2*cfg.SFTPReaders, 1)
+}
+
+// reorder forwards reads from in in input order, holding back any that arrive
+// early and releasing a window slot as each one leaves. A slow file blocks
+// everything behind it (head-of-line blocking): once the window is full no new
+// job is started until that file finishes, which is what bounds memory.
+// Each step forward is reported to b. Once ctx is done, the reads held back
+// and any still coming in on in are passed to drop.
+func reorder(ctx context.Context, in <-chan fileRead, window chan struct{}, b *inflight, drop func(fileRead)) <-chan fileRead {
+	out := make(chan fileRead)
+	go func() {
+		defer close(out)
+		pending := make(map[int]fileRead)
+		defer func() {
+			for _, read := range pending {
+				drop(read)
+			}
+			for read := range in {
+				drop(read)
+			}
+		}()
+		next := 0
+		for read := range in {
+			pending[read.index] = read
+			for {
+				ready, ok := pending[next]
+				if !ok {
+					break
+				}
+				select {
+				case out <- ready:
+				case <-ctx.Done():
+					return
+				}
+				delete(pending, next)
+				<-window
+				next++
+				b.advance(next)
+			}
+		}
+	}()
+	return out
+}
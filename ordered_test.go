@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+func TestOrderedPreservesInputOrder(t *testing.T) {
+	// Random open latencies make reads finish out of order
+	rnd := rand.New(rand.NewSource(1))
+	client := sftptest.NewFakeClient()
+	var jobs []FileJob
+	for i := 0; i < 200; i++ {
+		path := fmt.Sprintf("/remote/file_%d.bin", i)
+		if i%7 != 3 {
+			client.Add(path, sftptest.File{Data: []byte(path), OpenLatency: time.Duration(rnd.Intn(2000)) * time.Microsecond})
+		}
+		jobs = append(jobs, FileJob{RemotePath: path, ID: fmt.Sprintf("id_%d", i)})
+	}
+
+	var got []string
+	processFunc := func(result FileResult) error {
+		got = append(got, result.ID)
+		return nil
+	}
+
+	cfg := PipelineCfg{SFTPReaders: 16, Workers: 8, BufferSize: 4, Ordered: true, ReorderWindow: 10}
+	transferred, failed := cfg.TransferFiles(client, jobs, processFunc)
+	if int(transferred+failed) != len(jobs) {
+		t.Fatalf("expected %d outcomes, got %d", len(jobs), transferred+failed)
+	}
+
+	var want []string
+	for i, job := range jobs {
+		if i%7 != 3 {
+			want = append(want, job.ID)
+		}
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("results out of order:\ngot  %v\nwant %v", got, want)
+	}
+	if peak := client.PeakOpen(); peak > 10 {
+		t.Errorf("%d files open at once, reorder window is 10", peak)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrPipelineClosed is returned by Submit on a Pipeline that isn't running:
+// one not yet started, stopping, or whose run has ended.
+var ErrPipelineClosed = errors.New("pipeline is not running")
+
+// Pipeline is a long-lived transfer that takes jobs as they arrive, for a
+// service that doesn't have its jobs up front. The readers and workers stay
+// up from Start to Stop; in between it is a TransferFilesChan run fed by
+// Submit.
+type Pipeline struct {
+	cfg         PipelineCfg
+	client      SFTPClient
+	processFunc ProcessFunc
+
+	jobs     chan FileJob
+	pause    *pause
+	stopping chan struct{}
+	stopOnce sync.Once
+	// done is closed when the run returns, after stats and err are set.
+	done   chan struct{}
+	cancel context.CancelFunc
+	stats  TransferStats
+	err    error
+
+	// mu guards started and closed, and is held for reading by Submit so
+	// that Stop doesn't close jobs under a send.
+	mu      sync.RWMutex
+	started bool
+	closed  bool
+}
+
+// NewPipeline returns a Pipeline that reads jobs through client and passes
+// their results to processFunc. Nothing runs until Start.
+func (cfg PipelineCfg) NewPipeline(client SFTPClient, processFunc ProcessFunc) *Pipeline {
+	return &Pipeline{
+		cfg:         cfg,
+		client:      client,
+		processFunc: processFunc,
+		jobs:        make(chan FileJob),
+		pause:       &pause{},
+		stopping:    make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// Start starts the pipeline's readers and workers, and under
+// KeepaliveInterval the pings that keep its connection alive. A Pipeline
+// runs once: starting it again, even after Stop, is an error.
+func (p *Pipeline) Start() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.started || p.closed {
+		return errors.New("pipeline already started or stopped")
+	}
+	p.started = true
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	stopKeepalive := p.cfg.keepalive(p.client)
+	go func() {
+		defer close(p.done)
+		defer stopKeepalive()
+		p.stats, p.err = p.cfg.transfer(ctx, []SFTPClient{p.client}, fromChan(p.jobs), p.processFunc, hooks{pause: p.pause})
+	}()
+	return nil
+}
+
+// Submit queues job, blocking until a reader is free to take it. It is safe
+// to call from many goroutines, and fails with ErrPipelineClosed once the
+// pipeline has stopped taking jobs.
+func (p *Pipeline) Submit(job FileJob) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if !p.started || p.closed {
+		return ErrPipelineClosed
+	}
+	select {
+	case p.jobs <- job:
+		return nil
+	case <-p.stopping:
+	case <-p.done:
+	}
+	return ErrPipelineClosed
+}
+
+// Stop stops taking jobs, resumes the pipeline if it is paused, waits for
+// the jobs already submitted to finish and returns the stats of the whole
+// run. If ctx is done first the run is cancelled as TransferFilesCtx would
+// be, and Stop returns once it has unwound. Stopping a pipeline that was
+// never started returns at once.
+func (p *Pipeline) Stop(ctx context.Context) (TransferStats, error) {
+	p.stopOnce.Do(func() { close(p.stopping) })
+	p.Resume()
+	p.mu.Lock()
+	started := p.started
+	if started && !p.closed {
+		close(p.jobs)
+	}
+	p.closed = true
+	p.mu.Unlock()
+	if !started {
+		return TransferStats{}, nil
+	}
+
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		p.cancel()
+		<-p.done
+	}
+	p.cancel()
+	return p.stats, p.err
+}
+
+// Pause stops readers from starting jobs until Resume. Files already being
+// read or processed carry on, and Submit still queues jobs, blocking once
+// the readers' buffers are full.
+func (p *Pipeline) Pause() { p.pause.set(true) }
+
+// Resume lets readers start jobs again after Pause.
+func (p *Pipeline) Resume() { p.pause.set(false) }
+
+// pause holds readers back from starting jobs while it is paused. A nil
+// *pause never holds anyone back.
+type pause struct {
+	mu     sync.Mutex
+	paused bool
+	// resumed is closed, and replaced, when a pause ends.
+	resumed chan struct{}
+}
+
+func (p *pause) set(paused bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch {
+	case paused && !p.paused:
+		p.resumed = make(chan struct{})
+	case !paused && p.paused:
+		close(p.resumed)
+	}
+	p.paused = paused
+}
+
+// wait blocks while p is paused. It returns false if ctx is done first.
+func (p *pause) wait(ctx context.Context) bool {
+	if p == nil {
+		return true
+	}
+	p.mu.Lock()
+	paused, resumed := p.paused, p.resumed
+	p.mu.Unlock()
+	if !paused {
+		return true
+	}
+	select {
+	case <-resumed:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+func TestPipeline(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	jobs := fileJobs(client, 30, dataFile)
+	var processed atomic.Int32
+	p := DefaultCfg().NewPipeline(client, func(FileResult) error {
+		processed.Add(1)
+		return nil
+	})
+	if err := p.Submit(FileJob{RemotePath: "/remote/file_0.bin", ID: "early"}); !errors.Is(err, ErrPipelineClosed) {
+		t.Errorf("expected Submit before Start to fail, got %v", err)
+	}
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start(); err == nil {
+		t.Error("expected a second Start to fail")
+	}
+
+	// Three waves, each submitted concurrently, with idle gaps between
+	for wave := 0; wave < 3; wave++ {
+		var wg sync.WaitGroup
+		for i := wave * 10; i < (wave+1)*10; i++ {
+			wg.Go(func() {
+				job := jobs[i]
+				if err := p.Submit(job); err != nil {
+					t.Errorf("Submit %s: %v", job.ID, err)
+				}
+			})
+		}
+		wg.Wait()
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	stats, err := p.Stop(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Transferred != 30 || processed.Load() != 30 {
+		t.Errorf("expected all 30 jobs to complete, got %+v with %d processed", stats, processed.Load())
+	}
+	if err := p.Submit(FileJob{RemotePath: "/remote/file_0.bin", ID: "late"}); !errors.Is(err, ErrPipelineClosed) {
+		t.Errorf("expected Submit after Stop to fail, got %v", err)
+	}
+	if again, err := p.Stop(context.Background()); err != nil || again != stats {
+		t.Errorf("expected a second Stop to return the same stats, got %+v, %v", again, err)
+	}
+}
+
+func TestPipelineStopTimeout(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	client.Add("/remote/hang.bin", hangingFile)
+	p := PipelineCfg{SFTPReaders: 2, Workers: 1, BufferSize: 1}.NewPipeline(client, func(FileResult) error { return nil })
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Submit(FileJob{RemotePath: "/remote/hang.bin", ID: "hang"}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.Stop(ctx)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected the run to be cancelled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop did not return after its context expired")
+	}
+}
+
+func TestPipelinePause(t *testing.T) {
+	client := newFakeClient(map[string][]byte{"/remote/a.bin": []byte("a")})
+	var processed atomic.Int32
+	p := PipelineCfg{SFTPReaders: 2, Workers: 1, BufferSize: 1}.NewPipeline(client, func(FileResult) error {
+		processed.Add(1)
+		return nil
+	})
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	submit := func(from, to int) {
+		for i := from; i < to; i++ {
+			if err := p.Submit(FileJob{RemotePath: "/remote/a.bin", ID: fmt.Sprintf("id_%d", i)}); err != nil {
+				t.Errorf("Submit: %v", err)
+			}
+		}
+	}
+	submit(0, 3)
+	for processed.Load() < 3 {
+		time.Sleep(time.Millisecond)
+	}
+
+	p.Pause()
+	submitted := make(chan struct{})
+	go func() {
+		defer close(submitted)
+		submit(3, 10)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if n := client.Opens("/remote/a.bin"); n != 3 {
+		t.Errorf("expected no opens while paused, got %d past the first 3", n-3)
+	}
+
+	p.Resume()
+	<-submitted
+	stats, err := p.Stop(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Transferred != 10 || client.Opens("/remote/a.bin") != 10 {
+		t.Errorf("expected the remaining jobs to complete after Resume, got %+v", stats)
+	}
+}
+
+func TestPipelineStopWhilePaused(t *testing.T) {
+	client := newFakeClient(map[string][]byte{"/remote/a.bin": []byte("a")})
+	p := DefaultCfg().NewPipeline(client, func(FileResult) error { return nil })
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	p.Pause()
+	if err := p.Submit(FileJob{RemotePath: "/remote/a.bin", ID: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := p.Stop(context.Background())
+	if err != nil || stats.Transferred != 1 {
+		t.Errorf("expected Stop to resume and drain, got %+v, %v", stats, err)
+	}
+}
+
+// keepaliveClient counts its Getwd pings.
+type keepaliveClient struct {
+	*sftptest.FakeClient
+	pings atomic.Int32
+}
+
+func (c *keepaliveClient) Getwd() (string, error) {
+	c.pings.Add(1)
+	return "/", nil
+}
+
+func TestPipelineKeepalive(t *testing.T) {
+	client := &keepaliveClient{FakeClient: newFakeClient(map[string][]byte{"/remote/a.bin": []byte("a")})}
+	cfg := DefaultCfg()
+	cfg.KeepaliveInterval = 20 * time.Millisecond
+	p := cfg.NewPipeline(client, func(FileResult) error { return nil })
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Submit(FileJob{RemotePath: "/remote/a.bin", ID: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(210 * time.Millisecond)
+	if _, err := p.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// About 10 pings in 210ms at one per 20ms
+	n := client.pings.Load()
+	if n < 3 || n > 12 {
+		t.Errorf("expected around 10 pings, got %d", n)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if after := client.pings.Load(); after != n {
+		t.Errorf("pings continued after Stop: %d more", after-n)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// TransferFilesPool is TransferFilesCtx spread over several connections. Each
+// reader goroutine is bound to one client for its lifetime, dealt out
+// round-robin, so with SFTPReaders readers every client serves about
+// SFTPReaders/len(clients) of them. SFTPReaders should be at least
+// len(clients); any clients beyond SFTPReaders go unused.
+func (cfg PipelineCfg) TransferFilesPool(ctx context.Context, clients []SFTPClient, jobs []FileJob, processFunc ProcessFunc) (TransferStats, error) {
+	if len(clients) == 0 {
+		return TransferStats{}, errors.New("no clients in pool")
+	}
+	return cfg.transfer(ctx, clients, fromSlice(jobs), processFunc, hooks{})
+}
+
+// TransferFilesDial is TransferFilesPool over connections it dials itself
+// with cfg.NewClient. Each of the PoolSize dials is retried per the
+// RetryPolicy; slots that still fail are dropped with a warning to the Logger
+// and the run carries on with the connections it has. It fails only if no
+// connection could be made. A connection that is lost during the run is
+// redialed and the calls it failed are retried on the new one. Every dialed
+// client that implements io.Closer is closed before returning.
+func (cfg PipelineCfg) TransferFilesDial(ctx context.Context, jobs []FileJob, processFunc ProcessFunc) (TransferStats, error) {
+	clients, err := cfg.dialPool(ctx)
+	if err != nil {
+		return TransferStats{}, err
+	}
+	// Redials end with the run, Deadline included
+	runCtx, cancel := cfg.deadlineContext(ctx)
+	defer cancel()
+	for i, c := range clients {
+		clients[i] = &reconnectingClient{cfg: cfg, ctx: runCtx, client: c}
+	}
+	defer closeClients(clients)
+	return cfg.transfer(ctx, clients, fromSlice(jobs), processFunc, hooks{})
+}
+
+// dialPool dials PoolSize clients concurrently and returns those that
+// connected.
+func (cfg PipelineCfg) dialPool(ctx context.Context) ([]SFTPClient, error) {
+	if cfg.NewClient == nil {
+		return nil, errors.New("NewClient is not set")
+	}
+	size := max(cfg.PoolSize, 1)
+
+	slots := make([]SFTPClient, size)
+	errs := make([]error, size)
+	var dialWg sync.WaitGroup
+	for i := range size {
+		dialWg.Go(func() {
+			errs[i] = cfg.retry(ctx, func() (err error) {
+				slots[i], err = cfg.NewClient()
+				return err
+			})
+		})
+	}
+	dialWg.Wait()
+
+	var clients []SFTPClient
+	for i, err := range errs {
+		if err != nil {
+			cfg.logger().Printf("dial %d of %d failed: %v\n", i+1, size, err)
+			continue
+		}
+		clients = append(clients, slots[i])
+	}
+	if len(clients) == 0 {
+		return nil, fmt.Errorf("no connections: %w", errors.Join(errs...))
+	}
+	if len(clients) < size {
+		cfg.logger().Printf("continuing with %d of %d connections\n", len(clients), size)
+	}
+	return clients, nil
+}
+
+func closeClients(clients []SFTPClient) {
+	for _, c := range clients {
+		if closer, ok := c.(io.Closer); ok {
+			closer.Close()
+		}
+	}
+}
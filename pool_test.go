@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+func TestTransferFilesPoolSpreadsLoad(t *testing.T) {
+	// Four connections to the same files. Each open takes a little while,
+	// as over a real link, so readers overlap.
+	var jobs []FileJob
+	conns := make([]*sftptest.FakeClient, 4)
+	clients := make([]SFTPClient, len(conns))
+	for i := range conns {
+		conns[i] = sftptest.NewFakeClient()
+		jobs = fileJobs(conns[i], 400, sftptest.File{Data: []byte("data"), OpenLatency: 100 * time.Microsecond})
+		clients[i] = conns[i]
+	}
+
+	cfg := PipelineCfg{SFTPReaders: 8, Workers: 2, BufferSize: 1}
+	stats, err := cfg.TransferFilesPool(context.Background(), clients, jobs, func(FileResult) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Transferred != 400 {
+		t.Fatalf("expected 400 transfers, got %d", stats.Transferred)
+	}
+	var total int32
+	for i, c := range conns {
+		n := opened(c, jobs)
+		if n == 0 {
+			t.Errorf("client %d served no opens", i)
+		}
+		total += n
+	}
+	if total != 400 {
+		t.Errorf("expected 400 opens across clients, got %d", total)
+	}
+}
+
+func TestTransferFilesPoolNeedsClients(t *testing.T) {
+	if _, err := DefaultCfg().TransferFilesPool(context.Background(), nil, nil, nil); err == nil {
+		t.Fatal("expected an error for an empty pool")
+	}
+}
+
+// closableClient records whether it was closed.
+type closableClient struct {
+	*sftptest.FakeClient
+	closed atomic.Bool
+}
+
+func (c *closableClient) Close() error {
+	c.closed.Store(true)
+	return nil
+}
+
+func TestTransferFilesDialDegrades(t *testing.T) {
+	files := sftptest.NewFakeClient()
+	jobs := fileJobs(files, 50, dataFile)
+
+	// The server accepts two connections and refuses the rest
+	var mu sync.Mutex
+	var attempts int
+	var dialed []*closableClient
+	log := &recordingLogger{}
+	cfg := PipelineCfg{SFTPReaders: 6, Workers: 2, BufferSize: 2, PoolSize: 4, Logger: log}
+	cfg.NewClient = func() (SFTPClient, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if len(dialed) >= 2 {
+			return nil, errors.New("too many connections")
+		}
+		c := &closableClient{FakeClient: files}
+		dialed = append(dialed, c)
+		return c, nil
+	}
+	cfg.RetryPolicy = RetryPolicy{MaxRetries: 1}
+
+	stats, err := cfg.TransferFilesDial(context.Background(), jobs, func(FileResult) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Transferred != 50 {
+		t.Errorf("expected 50 transfers, got %d", stats.Transferred)
+	}
+	// Two slots connect; the other two fail their dial and its retry
+	if attempts != 6 {
+		t.Errorf("expected 6 dial attempts, got %d", attempts)
+	}
+	for i, c := range dialed {
+		if !c.closed.Load() {
+			t.Errorf("client %d was not closed", i)
+		}
+	}
+	if !strings.Contains(strings.Join(log.lines, ""), "continuing with 2 of 4 connections") {
+		t.Errorf("expected a degraded-pool warning, got %q", log.lines)
+	}
+}
+
+func TestTransferFilesDialAllFail(t *testing.T) {
+	errRefused := errors.New("connection refused")
+	cfg := DefaultCfg()
+	cfg.PoolSize = 3
+	cfg.NewClient = func() (SFTPClient, error) { return nil, errRefused }
+	if _, err := cfg.TransferFilesDial(context.Background(), nil, nil); !errors.Is(err, errRefused) {
+		t.Fatalf("expected the dial error, got %v", err)
+	}
+}
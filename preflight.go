@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrPreflight is wrapped by the error of a Preflight check that failed.
+var ErrPreflight = errors.New("preflight check failed")
+
+// workingDirer is implemented by clients, such as *sftp.Client, that can
+// report their working directory: the cheapest round trip to the server.
+type workingDirer interface {
+	Getwd() (string, error)
+}
+
+// Preflight checks that sftpClient works before a run is committed to it, so
+// a dead or misconfigured connection fails once with a clear error instead of
+// once per job. It makes one cheap round trip, Getwd if the client has it or
+// else a Stat of ".", then stats each job in sample to confirm its file
+// exists.
+func (cfg PipelineCfg) Preflight(sftpClient SFTPClient, sample []FileJob) error {
+	if err := ping(sftpClient); err != nil {
+		return fmt.Errorf("%w: %w", ErrPreflight, err)
+	}
+	for _, job := range sample {
+		if _, err := statRemote(sftpClient, job.RemotePath); err != nil {
+			return fmt.Errorf("%w: %s (%s): %w", ErrPreflight, job.RemotePath, job.ID, err)
+		}
+	}
+	return nil
+}
+
+// ping makes one round trip to the server behind client.
+func ping(client SFTPClient) error {
+	if wd, ok := client.(workingDirer); ok {
+		_, err := wd.Getwd()
+		return err
+	}
+	_, err := statRemote(client, ".")
+	return err
+}
+
+// preflight runs Preflight without a sample on each client when
+// CheckConnection is set.
+func (cfg PipelineCfg) preflight(clients []SFTPClient) error {
+	if !cfg.CheckConnection {
+		return nil
+	}
+	for _, client := range clients {
+		if err := cfg.Preflight(client, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
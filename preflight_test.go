@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+// pingClient is a FakeClient with a Getwd that fails with err.
+type pingClient struct {
+	*sftptest.FakeClient
+	err error
+}
+
+func (c *pingClient) Getwd() (string, error) { return "/home/user", c.err }
+
+func TestCheckConnectionAborts(t *testing.T) {
+	files := sftptest.NewFakeClient()
+	jobs := fileJobs(files, 50, dataFile)
+	errDead := errors.New("connection refused")
+	client := &pingClient{FakeClient: files, err: errDead}
+
+	cfg := DefaultCfg()
+	cfg.CheckConnection = true
+	stats, err := cfg.TransferFilesStats(context.Background(), client, jobs, func(FileResult) error { return nil })
+	if !errors.Is(err, ErrPreflight) || !errors.Is(err, errDead) {
+		t.Fatalf("expected the preflight to fail, got %v", err)
+	}
+	if opens := opened(files, jobs); opens != 0 || stats.Failed != 0 {
+		t.Errorf("expected no file to be attempted, got %d opens and %+v", opens, stats)
+	}
+
+	client.err = nil
+	if stats, err := cfg.TransferFilesStats(context.Background(), client, jobs, func(FileResult) error { return nil }); err != nil || stats.Transferred != 50 {
+		t.Errorf("expected a healthy client to transfer everything, got %+v, %v", stats, err)
+	}
+}
+
+func TestPreflightSample(t *testing.T) {
+	files := sftptest.NewFakeClient()
+	jobs := fileJobs(files, 10, dataFile)
+	jobs = append(jobs, FileJob{RemotePath: "/remote/missing.bin", ID: "missing"})
+	client := &pingClient{FakeClient: files}
+
+	if err := DefaultCfg().Preflight(client, jobs[:3]); err != nil {
+		t.Errorf("expected the sample to pass, got %v", err)
+	}
+	err := DefaultCfg().Preflight(client, jobs[8:])
+	if !errors.Is(err, ErrPreflight) || !IsNotFound(err) || !strings.Contains(err.Error(), "/remote/missing.bin") {
+		t.Errorf("expected the missing file to fail the preflight, got %v", err)
+	}
+
+	// Without Getwd the connection is checked with a Stat
+	if err := DefaultCfg().Preflight(files, nil); !IsNotFound(err) {
+		t.Errorf("expected the Stat of . to be tried, got %v", err)
+	}
+}
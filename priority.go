@@ -0,0 +1,103 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"slices"
+)
+
+// feed starts feeding a run's jobs to its readers, highest Priority first
+// unless the run is Ordered. Jobs from a slice that sets any Priority are all
+// looked at before the first is dispatched; a slice that sets none is fed in
+// order, SFTPReaders jobs ahead at most. For other sources the dispatcher
+// only sees the SFTPReaders jobs it has pulled ahead.
+func (cfg PipelineCfg) feed(ctx context.Context, jobs source[FileJob], window chan struct{}) *feed[FileJob] {
+	prioritized := jobs.slice == nil || slices.ContainsFunc(jobs.slice, func(job FileJob) bool { return job.Priority != 0 })
+	if cfg.Ordered || !prioritized {
+		return feedJobs(ctx, jobs, cfg.SFTPReaders, window)
+	}
+	// The dispatcher's heap does the buffering
+	f := feedJobs(ctx, jobs, 1, window)
+	lookahead, prime := jobs.total, jobs.total > 0
+	if !prime {
+		lookahead = cfg.SFTPReaders
+	}
+	prioritize(ctx, f, max(lookahead, 1), prime, func(job FileJob) int { return job.Priority })
+	return f
+}
+
+// prioritize puts a dispatcher between f's feeder and its readers that holds
+// up to lookahead jobs in a heap and hands out the one with the highest prio
+// first, ties going to the earliest. With prime set nothing is handed out
+// until the heap is full or the feeder is done.
+func prioritize[T any](ctx context.Context, f *feed[T], lookahead int, prime bool, prio func(T) int) {
+	in, fed := f.jobs, f.done
+	out := make(chan queued[T])
+	done := make(chan struct{})
+	f.jobs, f.done = out, done
+
+	go func() {
+		defer func() {
+			<-fed
+			close(done)
+		}()
+		defer close(out)
+		h := &jobHeap[T]{prio: prio}
+		for {
+			recv, send := in, out
+			if h.Len() >= lookahead {
+				recv = nil
+			}
+			if recv == nil {
+				prime = false
+			}
+			var next queued[T]
+			if h.Len() > 0 && !prime {
+				next = h.items[0]
+			} else {
+				send = nil
+			}
+			if recv == nil && send == nil {
+				return
+			}
+			select {
+			case q, ok := <-recv:
+				if !ok {
+					in = nil
+					continue
+				}
+				heap.Push(h, q)
+			case send <- next:
+				heap.Pop(h)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// jobHeap is a max-heap of queued jobs by prio, then min by index.
+type jobHeap[T any] struct {
+	items []queued[T]
+	prio  func(T) int
+}
+
+func (h *jobHeap[T]) Len() int { return len(h.items) }
+
+func (h *jobHeap[T]) Less(i, j int) bool {
+	a, b := h.items[i], h.items[j]
+	if pa, pb := h.prio(a.job), h.prio(b.job); pa != pb {
+		return pa > pb
+	}
+	return a.index < b.index
+}
+
+func (h *jobHeap[T]) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+
+func (h *jobHeap[T]) Push(x any) { h.items = append(h.items, x.(queued[T])) }
+
+func (h *jobHeap[T]) Pop() any {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"iter"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+func TestPriority(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	jobs := fileJobs(client, 40, slowFile)
+	// The urgent jobs come last in the input
+	for i := 30; i < len(jobs); i++ {
+		jobs[i].Priority = 10
+	}
+	jobs[35].Priority = 20
+
+	var mu sync.Mutex
+	var order []string
+	record := func(id string) {
+		mu.Lock()
+		order = append(order, id)
+		mu.Unlock()
+	}
+
+	check := func(name string) {
+		t.Helper()
+		if len(order) != len(jobs) {
+			t.Fatalf("%s: expected %d results, got %d", name, len(jobs), len(order))
+		}
+		if order[0] != "id_35" {
+			t.Errorf("%s: expected the highest priority first, got %v", name, order[:3])
+		}
+		for i, id := range order[:10] {
+			var n int
+			fmt.Sscanf(id, "id_%d", &n)
+			if n < 30 {
+				t.Errorf("%s: low-priority %s finished at position %d before an urgent job", name, id, i)
+			}
+		}
+		// Equal priorities keep input order
+		for i := 10; i < len(order); i++ {
+			if want := fmt.Sprintf("id_%d", i-10); order[i] != want {
+				t.Errorf("%s: position %d is %s, want %s", name, i, order[i], want)
+			}
+		}
+	}
+
+	cfg := PipelineCfg{SFTPReaders: 1, Workers: 1, BufferSize: 1}
+	cfg.TransferFiles(client, jobs, func(r FileResult) error {
+		record(r.ID)
+		return nil
+	})
+	check("in memory")
+
+	order = nil
+	cfg.stream(context.Background(), client, fromSlice(jobs), nil, func(job FileJob, r io.Reader) error {
+		record(job.ID)
+		return nil
+	}, nil)
+	check("streaming")
+}
+
+func TestPriorityIgnoredWhenOrdered(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	jobs := fileJobs(client, 20, slowFile)
+	jobs[19].Priority = 1
+	var ids []string
+	cfg := PipelineCfg{SFTPReaders: 2, Workers: 1, BufferSize: 1, Ordered: true, ReorderWindow: 2}
+	transferred, _ := cfg.TransferFiles(client, jobs, func(r FileResult) error {
+		ids = append(ids, r.ID)
+		return nil
+	})
+	if transferred != 20 || ids[19] != "id_19" {
+		t.Errorf("expected all 20 in input order, got %d ending with %v", transferred, ids[len(ids)-1:])
+	}
+}
+
+func TestPriorityPrimesOnlyWhenSet(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		priority int
+		bounded  bool
+	}{{"no priorities", 0, true}, {"priorities", 1, false}} {
+		t.Run(c.name, func(t *testing.T) {
+			jobs := make([]FileJob, 1000)
+			jobs[len(jobs)-1].Priority = c.priority
+			var pulled atomic.Int32
+			src := fromSlice(jobs)
+			src.jobs = func(context.Context) iter.Seq[FileJob] {
+				return func(yield func(FileJob) bool) {
+					for _, job := range jobs {
+						pulled.Add(1)
+						if !yield(job) {
+							return
+						}
+					}
+				}
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			cfg := PipelineCfg{SFTPReaders: 4}
+			f := cfg.feed(ctx, src, nil)
+			<-f.jobs
+			time.Sleep(20 * time.Millisecond)
+			n := pulled.Load()
+			cancel()
+			<-f.done
+			if bounded := n <= int32(cfg.SFTPReaders)+2; bounded != c.bounded {
+				t.Errorf("expected bounded=%v, got %d of %d jobs pulled ahead", c.bounded, n, len(jobs))
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import "runtime"
+
+// procSem bounds how many process calls run at once under ProcessSemaphore.
+// A nil procSem never blocks.
+type procSem chan struct{}
+
+func (cfg PipelineCfg) newProcSem() procSem {
+	if cfg.ProcessSemaphore <= 0 {
+		return nil
+	}
+	return make(procSem, cfg.ProcessSemaphore)
+}
+
+func (s procSem) acquire() {
+	if s != nil {
+		s <- struct{}{}
+	}
+}
+
+func (s procSem) release() {
+	if s != nil {
+		<-s
+	}
+}
+
+// DefaultCfgForLink is DefaultCfg sized for a link with the given round-trip
+// latency in milliseconds and for a CPU-bound processFunc. Readers are IO
+// parallelism, so there is roughly one per millisecond of latency to keep the
+// link busy, between 8 and 256. Workers and ProcessSemaphore are CPU
+// parallelism and match GOMAXPROCS.
+func DefaultCfgForLink(latencyMs int) PipelineCfg {
+	cfg := DefaultCfg()
+	cpus := runtime.GOMAXPROCS(0)
+	cfg.SFTPReaders = min(max(latencyMs, 8), 256)
+	cfg.Workers = cpus
+	cfg.ProcessSemaphore = cpus
+	cfg.BufferSize = 2 * cpus
+	return cfg
+}
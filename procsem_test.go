@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestProcessSemaphore(t *testing.T) {
+	client := newFakeClient(map[string][]byte{"/remote/a.bin": []byte("a")})
+	jobs := make([]FileJob, 60)
+	for i := range jobs {
+		jobs[i] = FileJob{RemotePath: "/remote/a.bin", ID: fmt.Sprintf("id_%d", i)}
+	}
+	var running, peak atomic.Int32
+	processFunc := func(FileResult) error {
+		n := running.Add(1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		time.Sleep(2 * time.Millisecond)
+		running.Add(-1)
+		return nil
+	}
+
+	for _, timeout := range []time.Duration{0, time.Second} {
+		running.Store(0)
+		peak.Store(0)
+		cfg := PipelineCfg{SFTPReaders: 16, Workers: 16, BufferSize: 16, ProcessSemaphore: 3, ProcessTimeout: timeout}
+		transferred, failed := cfg.TransferFiles(client, jobs, processFunc)
+		if transferred != 60 || failed != 0 {
+			t.Fatalf("timeout %s: %d transferred, %d failed", timeout, transferred, failed)
+		}
+		if p := peak.Load(); p > 3 {
+			t.Errorf("timeout %s: %d processFunc calls ran at once, want at most 3", timeout, p)
+		}
+	}
+}
+
+func TestDefaultCfgForLink(t *testing.T) {
+	cpus := runtime.GOMAXPROCS(0)
+	for _, tc := range []struct{ latency, readers int }{{0, 8}, {1, 8}, {40, 40}, {150, 150}, {5000, 256}} {
+		cfg := DefaultCfgForLink(tc.latency)
+		if cfg.SFTPReaders != tc.readers {
+			t.Errorf("%dms: %d readers, want %d", tc.latency, cfg.SFTPReaders, tc.readers)
+		}
+		if cfg.Workers != cpus || cfg.ProcessSemaphore != cpus {
+			t.Errorf("%dms: %d workers and a semaphore of %d, want %d", tc.latency, cfg.Workers, cfg.ProcessSemaphore, cpus)
+		}
+	}
+}
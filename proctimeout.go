@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// bounded runs process, giving up on it after ProcessTimeout. A process that
+// overruns is abandoned rather than stopped, since there is no way to stop
+// it: its goroutine carries on in the background and its eventual result is
+// discarded. Under ProcessSemaphore process waits for a slot first, which
+// doesn't count towards the timeout.
+func (r *run) bounded(process func() error) error {
+	r.procSem.acquire()
+	d := r.cfg.ProcessTimeout
+	if d <= 0 {
+		defer r.procSem.release()
+		return process()
+	}
+	done := make(chan error, 1)
+	go func() {
+		defer r.procSem.release()
+		done <- process()
+	}()
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-t.C:
+		return fmt.Errorf("%w (%s)", ErrProcessTimeout, d)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ProgressFunc receives the number of finished jobs, successful or not, out
+// of total, which is 0 when the number of jobs isn't known up front. It runs
+// on pipeline goroutines while holding a lock that serializes progress
+// updates, so it should return quickly.
+type ProgressFunc func(done, total int)
+
+// progress reports monotonically increasing done counts to a ProgressFunc.
+type progress struct {
+	mu    sync.Mutex
+	fn    ProgressFunc
+	done  int
+	total int
+}
+
+// newProgress returns nil when fn is nil; a nil *progress ignores steps.
+func newProgress(fn ProgressFunc, total int) *progress {
+	if fn == nil {
+		return nil
+	}
+	return &progress{fn: fn, total: total}
+}
+
+func (p *progress) step() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	p.fn(p.done, p.total)
+}
+
+// defaultProgressInterval is how often OnProgress is called when
+// ProgressInterval is unset.
+const defaultProgressInterval = time.Second
+
+// etaSmoothing is the weight of the latest interval's rate in the rate an
+// ETA is estimated from.
+const etaSmoothing = 0.3
+
+// Progress is a snapshot of a run for OnProgress. Total is 0 when the number
+// of jobs isn't known, and BytesTotal unless PipelineCfg.TotalBytes is set.
+// ETA is estimated from the recent rate, in bytes if BytesTotal is known and
+// otherwise in jobs, and is 0 when it can't be estimated.
+type Progress struct {
+	Done       int
+	Total      int
+	BytesDone  int64
+	BytesTotal int64
+	Elapsed    time.Duration
+	ETA        time.Duration
+}
+
+// reportProgress calls OnProgress every ProgressInterval until the returned
+// function is called, which stops the reports and sends a final one.
+func (r *run) reportProgress(start time.Time) func() {
+	if r.cfg.OnProgress == nil {
+		return func() {}
+	}
+	interval := r.cfg.ProgressInterval
+	if interval <= 0 {
+		interval = defaultProgressInterval
+	}
+	var rate throughput
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.cfg.OnProgress(r.snapshot(start, &rate))
+			case <-done:
+				return
+			}
+		}
+	})
+	return func() {
+		close(done)
+		wg.Wait()
+		p := r.snapshot(start, &rate)
+		p.ETA = 0
+		r.cfg.OnProgress(p)
+	}
+}
+
+func (r *run) snapshot(start time.Time, rate *throughput) Progress {
+	p := Progress{
+		Done:       int(r.transferred.Load() + r.failed.Load() + r.skipped.Load()),
+		Total:      r.total,
+		BytesDone:  r.bytes.Load(),
+		BytesTotal: r.cfg.TotalBytes,
+		Elapsed:    time.Since(start),
+	}
+	switch {
+	case p.BytesTotal > 0:
+		p.ETA = rate.eta(float64(p.BytesDone), float64(p.BytesTotal), p.Elapsed)
+	case p.Total > 0:
+		p.ETA = rate.eta(float64(p.Done), float64(p.Total), p.Elapsed)
+	}
+	return p
+}
+
+// throughput estimates the time left from successive reports of progress
+// towards a total. The rate is smoothed across reports, so the estimate
+// follows the current pace without jumping with every file.
+type throughput struct {
+	done   float64
+	at     time.Duration
+	rate   float64
+	primed bool
+}
+
+// eta records that done of total is finished at elapsed time at and returns
+// the estimated time left, or 0 if there is no rate to go on yet.
+func (t *throughput) eta(done, total float64, at time.Duration) time.Duration {
+	if dt := at - t.at; dt > 0 {
+		rate := (done - t.done) / dt.Seconds()
+		if t.primed {
+			rate = etaSmoothing*rate + (1-etaSmoothing)*t.rate
+		}
+		t.done, t.at, t.rate, t.primed = done, at, rate, true
+	}
+	if t.rate <= 0 || done >= total {
+		return 0
+	}
+	return time.Duration((total - done) / t.rate * float64(time.Second))
+}
+
+// reportStatus logs a status line every ReportInterval until the returned
+// function is called, which stops the reports and waits for the ticker
+// goroutine to exit. The final summary is logged separately.
+func (r *run) reportStatus(start time.Time) func() {
+	if r.cfg.ReportInterval <= 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		ticker := time.NewTicker(r.cfg.ReportInterval)
+		defer ticker.Stop()
+		lastBytes, lastAt := int64(0), start
+		for {
+			select {
+			case now := <-ticker.C:
+				bytes := r.bytes.Load()
+				rate := float64(bytes-lastBytes) / now.Sub(lastAt).Seconds()
+				lastBytes, lastAt = bytes, now
+				r.cfg.logger().Printf("%s, %d failed, %.1f MB/s\n", r.status(), r.failed.Load(), rate/1e6)
+			case <-done:
+				return
+			}
+		}
+	})
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// status is how many jobs are done, out of the total if it is known.
+func (r *run) status() string {
+	done := r.transferred.Load() + r.failed.Load() + r.skipped.Load()
+	if r.total > 0 {
+		return fmt.Sprintf("%d/%d done", done, r.total)
+	}
+	return fmt.Sprintf("%d done", done)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+func TestProgressIsMonotonic(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	jobs := fileJobs(client, 200, dataFile)
+	for i := 0; i < len(jobs); i += 10 {
+		client.Delete(jobs[i].RemotePath)
+	}
+
+	// Updates are serialized, so the callback needs no locking of its own
+	var calls, last int
+	cfg := DefaultCfg()
+	cfg.Progress = func(done, total int) {
+		calls++
+		if total != len(jobs) {
+			t.Errorf("total = %d, want %d", total, len(jobs))
+		}
+		if done != last+1 {
+			t.Errorf("done jumped from %d to %d", last, done)
+		}
+		last = done
+	}
+
+	cfg.TransferFiles(client, jobs, func(FileResult) error { return nil })
+	if calls != len(jobs) || last != len(jobs) {
+		t.Errorf("expected %d updates ending at %d, got %d ending at %d", len(jobs), len(jobs), calls, last)
+	}
+}
+
+func TestThroughputETA(t *testing.T) {
+	var rate throughput
+	// 100 bytes a second towards 1000
+	for s := 1; s <= 4; s++ {
+		got := rate.eta(float64(100*s), 1000, time.Duration(s)*time.Second)
+		if want := time.Duration(10-s) * time.Second; got != want {
+			t.Errorf("after %ds: ETA %s, want %s", s, got, want)
+		}
+	}
+
+	// The pace halves: the estimate moves towards the new rate rather than
+	// jumping to it
+	done := 400.0
+	for s := 5; s <= 30 && done < 1000; s++ {
+		done += 50
+		got := rate.eta(done, 1000, time.Duration(s)*time.Second)
+		atNewRate := time.Duration((1000 - done) / 50 * float64(time.Second))
+		atOldRate := time.Duration((1000 - done) / 100 * float64(time.Second))
+		if got < atOldRate || got > atNewRate {
+			t.Errorf("after %ds: ETA %s outside [%s, %s]", s, got, atOldRate, atNewRate)
+		}
+	}
+
+	if got := rate.eta(1000, 1000, 31*time.Second); got != 0 {
+		t.Errorf("finished: ETA %s, want 0", got)
+	}
+	var fresh throughput
+	if got := fresh.eta(0, 1000, 0); got != 0 {
+		t.Errorf("no progress yet: ETA %s, want 0", got)
+	}
+}
+
+func TestOnProgress(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	jobs := fileJobs(client, 60, slowFile)
+	var mu sync.Mutex
+	var reports []Progress
+	cfg := PipelineCfg{SFTPReaders: 4, Workers: 2, BufferSize: 2, ProgressInterval: 10 * time.Millisecond, TotalBytes: 60 * 4}
+	cfg.OnProgress = func(p Progress) {
+		mu.Lock()
+		reports = append(reports, p)
+		mu.Unlock()
+	}
+	cfg.TransferFiles(client, jobs, func(FileResult) error { return nil })
+
+	if len(reports) < 3 {
+		t.Fatalf("expected several reports, got %d", len(reports))
+	}
+	var sawETA bool
+	for i, p := range reports {
+		if p.Total != 60 || p.BytesTotal != 240 {
+			t.Errorf("report %d: totals %d jobs, %d bytes", i, p.Total, p.BytesTotal)
+		}
+		if i > 0 && (p.Done < reports[i-1].Done || p.BytesDone < reports[i-1].BytesDone) {
+			t.Errorf("report %d went backwards: %+v after %+v", i, p, reports[i-1])
+		}
+		sawETA = sawETA || p.ETA > 0
+	}
+	if !sawETA {
+		t.Error("expected a report with an ETA")
+	}
+	last := reports[len(reports)-1]
+	if last.Done != 60 || last.BytesDone != 240 || last.ETA != 0 {
+		t.Errorf("final report: %+v", last)
+	}
+}
+
+func TestReportInterval(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	jobs := fileJobs(client, 40, slowFile)
+	log := &recordingLogger{}
+	cfg := PipelineCfg{SFTPReaders: 2, Workers: 2, BufferSize: 1, Logger: log, ReportInterval: 10 * time.Millisecond}
+	cfg.TransferFiles(client, jobs, func(FileResult) error { return nil })
+
+	log.mu.Lock()
+	lines := slices.Clone(log.lines)
+	log.mu.Unlock()
+	var reports int
+	for _, line := range lines {
+		if strings.Contains(line, "/40 done, ") && strings.Contains(line, " failed, ") && strings.Contains(line, " MB/s") {
+			reports++
+		}
+	}
+	if reports < 2 {
+		t.Errorf("expected several interim reports, got %q", lines)
+	}
+
+	// Reports stop with the run
+	time.Sleep(50 * time.Millisecond)
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	if len(log.lines) != len(lines) {
+		t.Errorf("reports continued after the run: %q", log.lines[len(lines):])
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+// outcome is what a randomized job is set up to do.
+type outcome int
+
+const (
+	outcomeSuccess outcome = iota
+	outcomeOpenFail
+	outcomeReadFail
+	outcomeProcessFail
+	outcomeSkip
+	numOutcomes
+)
+
+// randomJobs builds n jobs with random outcomes and a client and process
+// funcs that produce them.
+func randomJobs(seed int64, n int) ([]FileJob, *sftptest.FakeClient, map[string]outcome) {
+	rnd := rand.New(rand.NewSource(seed))
+	client := sftptest.NewFakeClient()
+	outcomes := map[string]outcome{}
+	jobs := make([]FileJob, n)
+	for i := range jobs {
+		o := outcome(rnd.Intn(int(numOutcomes)))
+		path := fmt.Sprintf("/remote/file_%d.bin", i)
+		id := fmt.Sprintf("id_%d", i)
+		switch o {
+		case outcomeOpenFail:
+		case outcomeReadFail:
+			client.Add(path, sftptest.File{Data: []byte(id), ReadErr: errors.New("connection reset"), FailAfter: len(id)})
+		default:
+			client.AddData(path, []byte(id))
+		}
+		outcomes[id] = o
+		jobs[i] = FileJob{RemotePath: path, ID: id}
+	}
+	return jobs, client, outcomes
+}
+
+func outcomeErr(o outcome) error {
+	switch o {
+	case outcomeProcessFail:
+		return errors.New("rejected")
+	case outcomeSkip:
+		return fmt.Errorf("not interesting: %w", ErrSkip)
+	}
+	return nil
+}
+
+func TestOutcomesReconcile(t *testing.T) {
+	for seed := int64(0); seed < 20; seed++ {
+		jobs, client, outcomes := randomJobs(seed, 300)
+		want := map[outcome]int32{}
+		for _, o := range outcomes {
+			want[o]++
+		}
+		wantFailed := want[outcomeOpenFail] + want[outcomeReadFail] + want[outcomeProcessFail]
+
+		processFunc := func(result FileResult) error { return outcomeErr(outcomes[result.ID]) }
+		streamFunc := func(job FileJob, r io.Reader) error {
+			if _, err := io.ReadAll(r); err != nil {
+				return err
+			}
+			return outcomeErr(outcomes[job.ID])
+		}
+
+		cfg := PipelineCfg{SFTPReaders: 8, Workers: 4, BufferSize: 4, Ordered: seed%2 == 0}
+		stats, err := cfg.TransferFilesStats(context.Background(), client, jobs, processFunc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		streamed, err := cfg.stream(context.Background(), client, fromSlice(jobs), nil, streamFunc, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for name, got := range map[string]TransferStats{"memory": stats, "streaming": streamed} {
+			if got.Transferred+got.Failed+got.Skipped != int32(len(jobs)) {
+				t.Errorf("seed %d %s: %d + %d + %d != %d", seed, name, got.Transferred, got.Failed, got.Skipped, len(jobs))
+			}
+			if got.Transferred != want[outcomeSuccess] || got.Failed != wantFailed || got.Skipped != want[outcomeSkip] {
+				t.Errorf("seed %d %s: got %d/%d/%d, want %d/%d/%d", seed, name,
+					got.Transferred, got.Failed, got.Skipped, want[outcomeSuccess], wantFailed, want[outcomeSkip])
+			}
+		}
+	}
+}
+
+func TestEachJobCountsExactlyOnce(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	var jobs []FileJob
+	add := func(kind string, n int) {
+		for i := 0; i < n; i++ {
+			path := fmt.Sprintf("/remote/%s_%d.bin", kind, i)
+			id := fmt.Sprintf("%s_%d", kind, i)
+			f := sftptest.File{Data: []byte(id)}
+			switch kind {
+			case "openfail":
+				f.FailOpens = 100
+			case "readfail":
+				f.ReadErr, f.FailAfter = errors.New("connection reset"), len(id)
+			case "flaky":
+				// Fails once, then succeeds on the retry
+				f.FailOpens = 1
+			}
+			client.Add(path, f)
+			jobs = append(jobs, FileJob{RemotePath: path, ID: id})
+		}
+	}
+	add("ok", 40)
+	add("openfail", 15)
+	add("readfail", 10)
+	add("processfail", 20)
+	add("flaky", 15)
+
+	var mu sync.Mutex
+	calls := map[string]int{}
+	processFunc := func(result FileResult) error {
+		mu.Lock()
+		calls[result.ID]++
+		mu.Unlock()
+		if strings.HasPrefix(result.ID, "processfail") {
+			return errors.New("rejected")
+		}
+		return nil
+	}
+
+	cfg := PipelineCfg{SFTPReaders: 8, Workers: 4, BufferSize: 2, RetryPolicy: RetryPolicy{MaxRetries: 1}}
+	transferred, failed := cfg.TransferFiles(client, jobs, processFunc)
+	if transferred != 55 || failed != 45 {
+		t.Errorf("expected 55 transferred and 45 failed, got %d and %d", transferred, failed)
+	}
+	if transferred+failed != int32(len(jobs)) {
+		t.Errorf("%d + %d != %d", transferred, failed, len(jobs))
+	}
+	for _, job := range jobs {
+		want := 1
+		if strings.HasPrefix(job.ID, "openfail") || strings.HasPrefix(job.ID, "readfail") {
+			want = 0
+		}
+		if calls[job.ID] != want {
+			t.Errorf("%s: processFunc called %d times, want %d", job.ID, calls[job.ID], want)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+
+	"github.com/pkg/sftp"
+)
+
+// connectionLost reports whether err from an SFTP call means the connection
+// itself is gone, rather than a problem with one file such as it not
+// existing. An EOF isn't counted: reading a truncated file ends with one too.
+func connectionLost(err error) bool {
+	for _, target := range []error{
+		sftp.ErrSSHFxConnectionLost,
+		sftp.ErrSSHFxNoConnection,
+		net.ErrClosed,
+		syscall.ECONNRESET,
+		syscall.EPIPE,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestLost is connectionLost for a request such as an Open or Stat, which
+// reads no file data, so an EOF can only mean the connection closed under it.
+func requestLost(err error) bool {
+	return connectionLost(err) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// reconnectingClient is a pool slot of TransferFilesDial. When a call fails
+// because the connection was lost it redials with NewClient, retried per the
+// RetryPolicy, and makes the call again on the new connection, so jobs caught
+// by the loss are retried rather than failed. Readers sharing the slot
+// reconnect once between them.
+type reconnectingClient struct {
+	cfg PipelineCfg
+	// ctx is the run's, which ends any redial still retrying.
+	ctx    context.Context
+	mu     sync.Mutex
+	client SFTPClient
+	// gen counts reconnections, so a reader knows whether the connection it
+	// saw fail has already been replaced.
+	gen int
+	// dialing is the redial in progress, if any.
+	dialing *redial
+}
+
+// redial is a reconnection readers wait on together. client and err are set
+// before done is closed.
+type redial struct {
+	done   chan struct{}
+	client SFTPClient
+	err    error
+}
+
+func (c *reconnectingClient) current() (SFTPClient, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.client, c.gen
+}
+
+// reconnect replaces the connection of generation gen, unless another reader
+// already has, and returns the connection to use. A reader arriving while
+// another redials waits for that redial, or until the run's ctx is done.
+func (c *reconnectingClient) reconnect(gen int) (SFTPClient, error) {
+	c.mu.Lock()
+	if c.gen != gen {
+		defer c.mu.Unlock()
+		return c.client, nil
+	}
+	d := c.dialing
+	if d == nil {
+		d = &redial{done: make(chan struct{})}
+		c.dialing = d
+		c.mu.Unlock()
+		c.dial(d)
+	} else {
+		c.mu.Unlock()
+	}
+	select {
+	case <-d.done:
+		return d.client, d.err
+	case <-c.ctx.Done():
+		return nil, fmt.Errorf("reconnect: %w", c.ctx.Err())
+	}
+}
+
+// dial runs d, dialing with NewClient per the RetryPolicy without holding
+// c.mu, so readers aren't held up by its backoff. The new connection is
+// swapped in only once it is established.
+func (c *reconnectingClient) dial(d *redial) {
+	defer close(d.done)
+	var next SFTPClient
+	err := c.cfg.retry(c.ctx, func() (err error) {
+		next, err = c.cfg.NewClient()
+		return err
+	})
+	c.mu.Lock()
+	c.dialing = nil
+	if err != nil {
+		c.mu.Unlock()
+		d.err = fmt.Errorf("reconnect: %w", err)
+		return
+	}
+	old := c.client
+	c.client = next
+	c.gen++
+	c.mu.Unlock()
+	closeClients([]SFTPClient{old})
+	c.cfg.logger().Printf("reconnected after the connection was lost\n")
+	d.client = next
+}
+
+// call runs fn on the current connection, and once more on a new one if the
+// connection was lost.
+func call[T any](c *reconnectingClient, fn func(SFTPClient) (T, error)) (T, error) {
+	client, gen := c.current()
+	v, err := fn(client)
+	if err == nil || !requestLost(err) {
+		return v, err
+	}
+	if client, err = c.reconnect(gen); err != nil {
+		var zero T
+		return zero, err
+	}
+	return fn(client)
+}
+
+func (c *reconnectingClient) Open(path string) (io.ReadCloser, error) {
+	return call(c, func(client SFTPClient) (io.ReadCloser, error) { return client.Open(path) })
+}
+
+func (c *reconnectingClient) Stat(path string) (os.FileInfo, error) {
+	return call(c, func(client SFTPClient) (os.FileInfo, error) { return statRemote(client, path) })
+}
+
+func (c *reconnectingClient) Remove(path string) error {
+	_, err := call(c, func(client SFTPClient) (struct{}, error) { return struct{}{}, removeRemote(client, path) })
+	return err
+}
+
+func (c *reconnectingClient) Rename(oldname, newname string) error {
+	_, err := call(c, func(client SFTPClient) (struct{}, error) {
+		return struct{}{}, renameRemote(client, oldname, newname)
+	})
+	return err
+}
+
+func (c *reconnectingClient) MkdirAll(path string) error {
+	_, err := call(c, func(client SFTPClient) (struct{}, error) {
+		mk, ok := client.(dirMaker)
+		if !ok {
+			return struct{}{}, nil
+		}
+		return struct{}{}, mk.MkdirAll(path)
+	})
+	return err
+}
+
+func (c *reconnectingClient) Close() error {
+	client, _ := c.current()
+	closeClients([]SFTPClient{client})
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+	"github.com/pkg/sftp"
+)
+
+// dyingClient serves files until its connection drops after opens Opens.
+type dyingClient struct {
+	closableClient
+	opens atomic.Int32
+	after int32
+}
+
+func (d *dyingClient) Open(path string) (io.ReadCloser, error) {
+	if d.opens.Add(1) > d.after {
+		return nil, sftp.ErrSSHFxConnectionLost
+	}
+	return d.closableClient.Open(path)
+}
+
+func TestTransferFilesDialReconnects(t *testing.T) {
+	files := sftptest.NewFakeClient()
+	jobs := fileJobs(files, 40, dataFile)
+	jobs = append(jobs, FileJob{RemotePath: "/remote/missing.bin", ID: "missing"})
+
+	// The first connection drops after 10 files; later ones stay up
+	var mu sync.Mutex
+	var dialed []*dyingClient
+	log := &recordingLogger{}
+	cfg := PipelineCfg{SFTPReaders: 4, Workers: 2, BufferSize: 2, PoolSize: 1, Logger: log}
+	cfg.NewClient = func() (SFTPClient, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		c := &dyingClient{closableClient: closableClient{FakeClient: files}, after: 1 << 30}
+		if len(dialed) == 0 {
+			c.after = 10
+		}
+		dialed = append(dialed, c)
+		return c, nil
+	}
+
+	stats, err := cfg.TransferFilesDial(context.Background(), jobs, func(FileResult) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Transferred != 40 || stats.Failed != 1 {
+		t.Errorf("expected 40 transfers and the missing file failed, got %+v", stats)
+	}
+	if len(dialed) != 2 {
+		t.Fatalf("expected one reconnection, got %d dials", len(dialed))
+	}
+	for i, c := range dialed {
+		if !c.closed.Load() {
+			t.Errorf("client %d was not closed", i)
+		}
+	}
+	if !strings.Contains(strings.Join(log.lines, ""), "reconnected") {
+		t.Errorf("expected a reconnection to be logged, got %q", log.lines)
+	}
+}
+
+func TestReconnectFails(t *testing.T) {
+	errRefused := errors.New("connection refused")
+	cfg := PipelineCfg{NewClient: func() (SFTPClient, error) { return nil, errRefused }}
+	c := &reconnectingClient{cfg: cfg, ctx: context.Background(), client: &dyingClient{}}
+	if _, err := c.Open("/remote/a"); !errors.Is(err, errRefused) {
+		t.Fatalf("expected the dial error, got %v", err)
+	}
+}
+
+func TestReconnectCancelled(t *testing.T) {
+	errRefused := errors.New("connection refused")
+	cfg := PipelineCfg{NewClient: func() (SFTPClient, error) { return nil, errRefused }}
+	cfg.MaxRetries, cfg.BackoffBase = 5, time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &reconnectingClient{cfg: cfg, ctx: ctx, client: &dyingClient{}}
+
+	errs := make(chan error, 2)
+	for range 2 {
+		go func() {
+			_, err := c.Open("/remote/a")
+			errs <- err
+		}()
+	}
+	// The redial backs off without holding the slot
+	time.Sleep(20 * time.Millisecond)
+	got := make(chan struct{})
+	go func() {
+		c.current()
+		close(got)
+	}()
+	select {
+	case <-got:
+	case <-time.After(time.Second):
+		t.Fatal("current blocked behind the redial")
+	}
+	cancel()
+	for range 2 {
+		select {
+		case err := <-errs:
+			if err == nil {
+				t.Error("expected the cancelled reconnect to fail")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("cancelling the run didn't end the redial")
+		}
+	}
+}
+
+func TestConnectionLost(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		lost bool
+	}{
+		{sftp.ErrSSHFxConnectionLost, true},
+		{fmt.Errorf("read: %w", io.ErrUnexpectedEOF), false},
+		{os.ErrNotExist, false},
+		{errors.New("permission denied"), false},
+	} {
+		if got := connectionLost(tc.err); got != tc.lost {
+			t.Errorf("connectionLost(%v) = %v, want %v", tc.err, got, tc.lost)
+		}
+	}
+	if !requestLost(fmt.Errorf("open: %w", io.EOF)) {
+		t.Error("expected an EOF on an open to mean the connection was lost")
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// protect runs process for what, a description of the job or jobs it
+// handles. Under RecoverPanics a panic is logged with its stack and returned
+// as an error wrapping ErrPanic.
+func (r *run) protect(what string, process func() error) (err error) {
+	if !r.cfg.RecoverPanics {
+		return process()
+	}
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("%w: %v", ErrPanic, v)
+			r.cfg.logger().Printf("Recovered panic processing %s: %v\n%s", what, v, debug.Stack())
+		}
+	}()
+	return process()
+}
+
+// describe names job for logs.
+func describe(job FileJob) string {
+	return job.ID + " (" + job.RemotePath + ")"
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+func TestRecoverPanics(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	jobs := fileJobs(client, 20, dataFile)
+	log := &recordingLogger{}
+	cfg := DefaultCfg()
+	cfg.Logger = log
+
+	transferred, errs := cfg.TransferFilesWithErrors(client, jobs, func(r FileResult) error {
+		if r.ID == "id_7" {
+			var m map[string]int
+			m["boom"]++
+		}
+		return nil
+	})
+	if transferred != 19 {
+		t.Errorf("expected the other 19 files to complete, got %d", transferred)
+	}
+	if len(errs) != 1 || errs[0].ID != "id_7" || errs[0].Stage != StageProcess || !errors.Is(errs[0], ErrPanic) {
+		t.Fatalf("expected id_7 to fail with ErrPanic, got %v", errs)
+	}
+	if !strings.Contains(errs[0].Error(), "nil map") {
+		t.Errorf("expected the panic value in the error, got %v", errs[0])
+	}
+
+	var logged bool
+	for _, line := range log.lines {
+		if strings.Contains(line, "id_7") && strings.Contains(line, "goroutine") {
+			logged = true
+		}
+	}
+	if !logged {
+		t.Errorf("expected the panic to be logged with its stack, got %q", log.lines)
+	}
+}
+
+func TestRecoverPanicsStreaming(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	jobs := fileJobs(client, 20, dataFile)
+	transferred, failed := DefaultCfg().TransferFilesStreaming(client, jobs, func(id string, r io.Reader) error {
+		if id == "id_3" {
+			panic(errors.New("malformed file"))
+		}
+		_, err := io.Copy(io.Discard, r)
+		return err
+	})
+	if transferred != 19 || failed != 1 {
+		t.Errorf("expected 19 transferred and 1 failed, got %d and %d", transferred, failed)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// remover is implemented by clients that can delete remote files, which
+// DeleteAfterTransfer needs. *sftp.Client satisfies it.
+type remover interface {
+	Remove(path string) error
+}
+
+// removeRemote deletes path through client, failing with
+// errors.ErrUnsupported if the client can't.
+func removeRemote(client SFTPClient, path string) error {
+	rm, ok := client.(remover)
+	if !ok {
+		return fmt.Errorf("%T has no Remove method: %w", client, errors.ErrUnsupported)
+	}
+	return rm.Remove(path)
+}
+
+// dispose moves the remote file of a job that succeeded into ArchiveDir or,
+// under DeleteAfterTransfer, deletes it. Nothing is touched in a DryRun.
+func (r *run) dispose(read fileRead) {
+	if r.cfg.DryRun || read.client == nil {
+		return
+	}
+	switch {
+	case r.cfg.ArchiveDir != "":
+		r.archiveSource(read)
+	case r.cfg.DeleteAfterTransfer:
+		r.removeSource(read)
+	}
+}
+
+// removeSource deletes the remote file of a job that succeeded. A failed
+// removal leaves the job a success; it is logged and counted in
+// TransferStats.RemoveFailed instead. A file already gone, such as one a
+// duplicate job removed first, counts as removed.
+func (r *run) removeSource(read fileRead) {
+	if err := removeRemote(read.client, read.job.RemotePath); err != nil && !IsNotFound(err) {
+		r.removeFailed.Add(1)
+		r.cfg.logger().Printf("Failed to remove %s after transfer: %v\n", describe(read.job), err)
+	}
+}
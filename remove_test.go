@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+// removingClient records Removes, failing those of paths in denied.
+type removingClient struct {
+	*sftptest.FakeClient
+	mu      sync.Mutex
+	removed []string
+	denied  map[string]bool
+}
+
+func (c *removingClient) Remove(path string) error {
+	if c.denied[path] {
+		return fmt.Errorf("remove %s: %w", path, os.ErrPermission)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removed = append(c.removed, path)
+	return nil
+}
+
+func TestDeleteAfterTransfer(t *testing.T) {
+	files := sftptest.NewFakeClient()
+	jobs := fileJobs(files, 6, dataFile)
+	files.Delete(jobs[1].RemotePath)
+	client := &removingClient{FakeClient: files, denied: map[string]bool{jobs[5].RemotePath: true}}
+	log := &recordingLogger{}
+	cfg := PipelineCfg{SFTPReaders: 2, Workers: 2, BufferSize: 2, DeleteAfterTransfer: true, Logger: log}
+
+	stats, err := cfg.TransferFilesStats(context.Background(), client, jobs, func(res FileResult) error {
+		if res.ID == jobs[2].ID {
+			return errors.New("rejected")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The denied removal still counts as a transfer
+	if stats.Transferred != 4 || stats.Failed != 2 || stats.RemoveFailed != 1 {
+		t.Fatalf("expected 4 transferred, 2 failed and 1 failed removal, got %+v", stats)
+	}
+	sort.Strings(client.removed)
+	want := []string{jobs[0].RemotePath, jobs[3].RemotePath, jobs[4].RemotePath}
+	if fmt.Sprint(client.removed) != fmt.Sprint(want) {
+		t.Errorf("removed %v, want %v", client.removed, want)
+	}
+	if len(log.lines) == 0 {
+		t.Error("expected the failed removal to be logged")
+	}
+}
+
+func TestDeleteAfterTransferStream(t *testing.T) {
+	files := sftptest.NewFakeClient()
+	jobs := fileJobs(files, 3, dataFile)
+	client := &removingClient{FakeClient: files}
+	cfg := PipelineCfg{SFTPReaders: 2, Workers: 2, DeleteAfterTransfer: true}
+	transferred, failed, _ := cfg.TransferFilesToDir(client, jobs, t.TempDir())
+	if transferred != 3 || failed != 0 || len(client.removed) != 3 {
+		t.Fatalf("expected all 3 moved, got %d transferred, %d failed, removed %v", transferred, failed, client.removed)
+	}
+
+	client.removed = nil
+	cfg.DryRun = true
+	if stats, _ := cfg.TransferFilesStats(context.Background(), client, jobs, func(FileResult) error { return nil }); stats.Transferred != 3 || len(client.removed) != 0 {
+		t.Errorf("expected a DryRun to remove nothing, got %+v, removed %v", stats, client.removed)
+	}
+}
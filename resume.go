@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io"
+	"os"
+)
+
+// resumeFile is writeFile for Resume: data goes to dest+".part", which is
+// kept on failure. An existing part file is appended to after seeking r past
+// the bytes it holds, and started over if r can't seek or is shorter.
+func resumeFile(dest string, r io.Reader, fsync bool, attrs func(string) error) error {
+	part := dest + ".part"
+	f, err := os.OpenFile(part, os.O_WRONLY|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	offset, err := resumeOffset(r, info.Size())
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Truncate(offset); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return err
+	}
+
+	if _, err = io.Copy(f, r); err == nil && attrs != nil {
+		err = attrs(part)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if err := closeFile(f, fsync); err != nil {
+		return err
+	}
+	return renameFile(part, dest, fsync)
+}
+
+// resumeOffset seeks r past the have bytes already downloaded and returns
+// where the copy continues from: have, or 0 if r can't seek or is shorter.
+func resumeOffset(r io.Reader, have int64) (int64, error) {
+	s, ok := r.(io.Seeker)
+	if have == 0 || !ok {
+		return 0, nil
+	}
+	size, err := s.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, nil
+	}
+	if size < have {
+		have = 0
+	}
+	_, err = s.Seek(have, io.SeekStart)
+	return have, err
+}
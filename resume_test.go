@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+// rangeFile is a remote file that supports ranged reads, as *sftp.File does.
+func rangeFile(data []byte) sftptest.File {
+	return sftptest.File{Data: data, Seekable: true}
+}
+
+func TestTransferFilesToDirResume(t *testing.T) {
+	dest := t.TempDir()
+	data := bytes.Repeat([]byte("0123456789"), 10_000)
+	client := sftptest.NewFakeClient()
+	client.Add("/remote/big.bin", rangeFile(data))
+	// flaky breaks once, after 40000 bytes
+	flaky := rangeFile(data)
+	flaky.ReadErr, flaky.FailAfter, flaky.FailReads = errors.New("connection reset"), 40_000, 1
+	client.Add("/remote/flaky.bin", flaky)
+	client.Add("/remote/stale.bin", rangeFile([]byte("short")))
+	if err := os.WriteFile(filepath.Join(dest, "big.part"), data[:30_000], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dest, "stale.part"), []byte("longer than the remote file"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	jobs := []FileJob{
+		{RemotePath: "/remote/big.bin", ID: "big"},
+		{RemotePath: "/remote/flaky.bin", ID: "flaky"},
+		{RemotePath: "/remote/stale.bin", ID: "stale"},
+	}
+	cfg := DefaultCfg()
+	cfg.Resume = true
+
+	transferred, failed, _ := cfg.TransferFilesToDir(client, jobs, dest)
+	if transferred != 2 || failed != 1 {
+		t.Fatalf("expected 2 transferred and 1 failed, got %d and %d", transferred, failed)
+	}
+	if got := client.Served("/remote/big.bin"); got != len(data)-30_000 {
+		t.Errorf("big: expected only the missing %d bytes to be read, got %d", len(data)-30_000, got)
+	}
+	part, err := os.ReadFile(filepath.Join(dest, "flaky.part"))
+	if err != nil {
+		t.Fatalf("failed download should leave its part file: %v", err)
+	}
+	if !bytes.Equal(part, data[:40_000]) {
+		t.Errorf("flaky: part file holds %d bytes, want the 40000 read", len(part))
+	}
+
+	before := client.Served("/remote/flaky.bin")
+	transferred, failed, _ = cfg.TransferFilesToDir(client, jobs[1:2], dest)
+	if transferred != 1 || failed != 0 {
+		t.Fatalf("resumed run: expected 1 transferred, got %d and %d failed", transferred, failed)
+	}
+	if got := client.Served("/remote/flaky.bin") - before; got != len(data)-40_000 {
+		t.Errorf("flaky: expected the resumed run to read %d bytes, got %d", len(data)-40_000, got)
+	}
+
+	for id, want := range map[string][]byte{"big": data, "flaky": data, "stale": []byte("short")} {
+		got, err := os.ReadFile(filepath.Join(dest, id))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: content mismatch, got %d bytes want %d", id, len(got), len(want))
+		}
+		if _, err := os.Stat(filepath.Join(dest, id+".part")); err == nil {
+			t.Errorf("%s: part file left behind", id)
+		}
+	}
+}
+
+func TestTransferFilesToDirResumeUnseekable(t *testing.T) {
+	dest := t.TempDir()
+	client := newFakeClient(map[string][]byte{"/remote/a.bin": []byte("fresh content")})
+	if err := os.WriteFile(filepath.Join(dest, "a.part"), []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultCfg()
+	cfg.Resume = true
+
+	if transferred, _, _ := cfg.TransferFilesToDir(client, []FileJob{{RemotePath: "/remote/a.bin", ID: "a"}}, dest); transferred != 1 {
+		t.Fatalf("expected 1 transferred, got %d", transferred)
+	}
+	got, err := os.ReadFile(filepath.Join(dest, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "fresh content" {
+		t.Errorf("expected the download to start over, got %q", got)
+	}
+}
+
+func TestTransferFilesToDirResumeSection(t *testing.T) {
+	data := []byte("AAAAAAAAAABBBBBBBBBBCCCCCCCCCC")
+	for _, c := range []struct {
+		name   string
+		length int64
+		want   string
+	}{
+		{"offset", 0, "BBBBBBBBBBCCCCCCCCCC"},
+		{"offset and length", 10, "BBBBBBBBBB"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			dest := t.TempDir()
+			client := sftptest.NewFakeClient()
+			client.Add("/remote/a.bin", rangeFile(data))
+			if err := os.WriteFile(filepath.Join(dest, "a.part"), []byte("BBBBB"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			cfg := DefaultCfg()
+			cfg.Resume = true
+			job := FileJob{RemotePath: "/remote/a.bin", ID: "a", Offset: 10, Length: c.length}
+			if transferred, _, _ := cfg.TransferFilesToDir(client, []FileJob{job}, dest); transferred != 1 {
+				t.Fatalf("expected 1 transferred, got %d", transferred)
+			}
+			got, err := os.ReadFile(filepath.Join(dest, "a"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != c.want {
+				t.Errorf("expected %q, got %q", c.want, got)
+			}
+			if served, want := client.Served("/remote/a.bin"), len(c.want)-5; served != want {
+				t.Errorf("expected only the missing %d bytes to be read, got %d", want, served)
+			}
+		})
+	}
+}
+
+func TestTransferFilesToDirResumeWrapped(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 100)
+	for name, set := range map[string]func(*PipelineCfg){
+		"throttled": func(c *PipelineCfg) { c.MaxBytesPerSec = 1 << 30 },
+		"sniffed":   func(c *PipelineCfg) { c.SniffContentType = true },
+		"head":      func(c *PipelineCfg) { c.HeadBytes = 600 },
+	} {
+		t.Run(name, func(t *testing.T) {
+			dest := t.TempDir()
+			client := sftptest.NewFakeClient()
+			client.Add("/remote/a.bin", rangeFile(data))
+			if err := os.WriteFile(filepath.Join(dest, "a.part"), data[:500], 0o644); err != nil {
+				t.Fatal(err)
+			}
+			cfg := DefaultCfg()
+			cfg.Resume = true
+			set(&cfg)
+			if transferred, _, _ := cfg.TransferFilesToDir(client, []FileJob{{RemotePath: "/remote/a.bin", ID: "a"}}, dest); transferred != 1 {
+				t.Fatalf("expected 1 transferred, got %d", transferred)
+			}
+			want := data
+			if cfg.HeadBytes > 0 {
+				want = data[:cfg.HeadBytes]
+			}
+			got, err := os.ReadFile(filepath.Join(dest, "a"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("expected %d bytes matching the remote file, got %d", len(want), len(got))
+			}
+			// Sniffing reads the start of the file before it is resumed
+			missing := len(want) - 500
+			if cfg.SniffContentType {
+				missing += sniffLen
+			}
+			if served := client.Served("/remote/a.bin"); served != missing {
+				t.Errorf("expected only the missing %d bytes to be read, got %d", missing, served)
+			}
+		})
+	}
+}
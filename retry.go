@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy controls how often a failed Open or read is retried before the
+// job counts as failed. The zero value never retries.
+type RetryPolicy struct {
+	MaxRetries  int
+	BackoffBase time.Duration
+	// MaxBackoff caps a single wait so one flaky file can't hold its reader
+	// for long. Zero means no cap.
+	MaxBackoff time.Duration
+	// JitterFactor randomizes each wait so files that failed together don't
+	// retry in lockstep: a wait of d becomes a random one between
+	// d*(1-JitterFactor) and d. 1 is full jitter; zero waits exactly d.
+	JitterFactor float64
+	// Rand returns the random numbers in [0, 1) that jitter is drawn from,
+	// and must be safe for concurrent use. Nil uses math/rand/v2; set it to a
+	// seeded source for reproducible waits.
+	Rand func() float64
+	// MaxRetryElapsed caps the time spent on one file's attempts, waits
+	// included: no retry is started that would begin after this long. It
+	// bounds how long a doomed file holds its reader whatever MaxRetries
+	// allows. Zero means no cap.
+	MaxRetryElapsed time.Duration
+}
+
+// backoff returns the wait before retry number attempt (starting at 0):
+// BackoffBase doubled per attempt.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.BackoffBase
+	for i := 0; i < attempt && d > 0; i++ {
+		if p.MaxBackoff > 0 && d >= p.MaxBackoff {
+			break
+		}
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+// wait is the jittered backoff before retry number attempt.
+func (p RetryPolicy) wait(attempt int) time.Duration {
+	d := p.backoff(attempt)
+	f := min(max(p.JitterFactor, 0), 1)
+	if f == 0 || d <= 0 {
+		return d
+	}
+	random := p.Rand
+	if random == nil {
+		random = rand.Float64
+	}
+	return d - time.Duration(f*random()*float64(d))
+}
+
+// retry calls fn until it succeeds, retries run out or ctx is done, and
+// returns the last error.
+func (p RetryPolicy) retry(ctx context.Context, fn func() error) error {
+	return p.retryIf(ctx, func(error) bool { return true }, fn)
+}
+
+// retryIf is retry for errors that retriable accepts; any other error is
+// returned at once.
+func (p RetryPolicy) retryIf(ctx context.Context, retriable func(error) bool, fn func() error) error {
+	start := time.Now()
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || !retriable(err) || attempt >= p.MaxRetries || ctx.Err() != nil {
+			return err
+		}
+		wait := p.wait(attempt)
+		if p.MaxRetryElapsed > 0 && time.Since(start)+wait > p.MaxRetryElapsed {
+			return err
+		}
+		if !sleepCtx(ctx, wait) {
+			return err
+		}
+	}
+}
+
+// sleepCtx waits for d or until ctx is done, reporting whether the full wait
+// elapsed.
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func isRetryProcess(err error) bool {
+	return errors.Is(err, ErrRetryProcess)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+func TestRetryRecoversTransientOpenFailures(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	var jobs []FileJob
+	for i := 0; i < 10; i++ {
+		path := fmt.Sprintf("/remote/file_%d.bin", i)
+		client.Add(path, sftptest.File{Data: []byte("data"), FailOpens: i % 3})
+		jobs = append(jobs, FileJob{RemotePath: path, ID: fmt.Sprintf("id_%d", i)})
+	}
+	jobs = append(jobs, FileJob{RemotePath: "/remote/hopeless.bin", ID: "hopeless"})
+	client.Add("/remote/hopeless.bin", sftptest.File{FailOpens: 100})
+
+	cfg := DefaultCfg()
+	cfg.RetryPolicy = RetryPolicy{MaxRetries: 2, BackoffBase: time.Millisecond}
+	transferred, errs := cfg.TransferFilesWithErrors(client, jobs, func(FileResult) error { return nil })
+
+	if transferred != 10 {
+		t.Errorf("expected 10 transfers, got %d", transferred)
+	}
+	if len(errs) != 1 || errs[0].ID != "hopeless" {
+		t.Fatalf("expected only hopeless to fail, got %v", errs)
+	}
+	if got := client.Opens("/remote/hopeless.bin"); got != 3 {
+		t.Errorf("expected 1 attempt plus 2 retries, got %d opens", got)
+	}
+	for i := 0; i < 10; i++ {
+		path := fmt.Sprintf("/remote/file_%d.bin", i)
+		if got, want := client.Opens(path), i%3+1; got != want {
+			t.Errorf("%s: expected %d opens, got %d", path, want, got)
+		}
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := RetryPolicy{BackoffBase: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+	want := []time.Duration{10, 20, 40, 50, 50}
+	for attempt, w := range want {
+		if got := p.backoff(attempt); got != w*time.Millisecond {
+			t.Errorf("backoff(%d) = %s, want %s", attempt, got, w*time.Millisecond)
+		}
+	}
+}
+
+// seededRand is a RetryPolicy.Rand from a fixed seed, safe for concurrent
+// use.
+func seededRand(seed uint64) func() float64 {
+	var mu sync.Mutex
+	r := rand.New(rand.NewPCG(seed, seed))
+	return func() float64 {
+		mu.Lock()
+		defer mu.Unlock()
+		return r.Float64()
+	}
+}
+
+func TestRetryJitter(t *testing.T) {
+	p := RetryPolicy{BackoffBase: 10 * time.Millisecond, JitterFactor: 0.5, Rand: seededRand(1)}
+	// Waits for many files that failed at once, all on their third attempt
+	waits := map[time.Duration]bool{}
+	var first []time.Duration
+	for i := 0; i < 100; i++ {
+		w := p.wait(2)
+		if w < 20*time.Millisecond || w > 40*time.Millisecond {
+			t.Fatalf("wait %s outside [20ms, 40ms]", w)
+		}
+		waits[w] = true
+		first = append(first, w)
+	}
+	if len(waits) < 90 {
+		t.Errorf("expected the waits to be spread out, got %d distinct of 100", len(waits))
+	}
+
+	// The same seed gives the same waits
+	p.Rand = seededRand(1)
+	for i, w := range first {
+		if got := p.wait(2); got != w {
+			t.Fatalf("wait %d = %s with the same seed, want %s", i, got, w)
+		}
+	}
+
+	if got := (RetryPolicy{BackoffBase: 10 * time.Millisecond}).wait(2); got != 40*time.Millisecond {
+		t.Errorf("expected no jitter by default, got %s", got)
+	}
+}
+
+func TestRetryProcess(t *testing.T) {
+	client := newFakeClient(map[string][]byte{
+		"/remote/busy.bin":     []byte("busy"),
+		"/remote/broken.bin":   []byte("broken"),
+		"/remote/hopeless.bin": []byte("hopeless"),
+	})
+	jobs := []FileJob{
+		{RemotePath: "/remote/busy.bin", ID: "busy"},
+		{RemotePath: "/remote/broken.bin", ID: "broken"},
+		{RemotePath: "/remote/hopeless.bin", ID: "hopeless"},
+	}
+
+	var mu sync.Mutex
+	calls := map[string]int{}
+	cfg := DefaultCfg()
+	cfg.RetryPolicy = RetryPolicy{MaxRetries: 3, BackoffBase: time.Millisecond}
+	transferred, errs := cfg.TransferFilesWithErrors(client, jobs, func(r FileResult) error {
+		mu.Lock()
+		calls[r.ID]++
+		n := calls[r.ID]
+		mu.Unlock()
+		switch {
+		case r.ID == "busy" && n <= 2, r.ID == "hopeless":
+			return fmt.Errorf("queue full: %w", ErrRetryProcess)
+		case r.ID == "broken":
+			return errors.New("bad record")
+		}
+		return nil
+	})
+
+	if transferred != 1 || len(errs) != 2 {
+		t.Fatalf("expected busy to succeed and 2 failures, got %d transferred and %v", transferred, errs)
+	}
+	for id, want := range map[string]int{"busy": 3, "broken": 1, "hopeless": 4} {
+		if calls[id] != want {
+			t.Errorf("%s: expected %d processFunc calls, got %d", id, want, calls[id])
+		}
+	}
+	for _, job := range jobs {
+		if n := client.Opens(job.RemotePath); n != 1 {
+			t.Errorf("%s: expected the file to be read once, got %d opens", job.RemotePath, n)
+		}
+	}
+}
+
+func TestRetryFakeClient(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	client.Add("/remote/flaky.bin", sftptest.File{Data: []byte("flaky"), FailOpens: 2, OpenLatency: time.Millisecond})
+	client.Add("/remote/broken.bin", sftptest.File{Data: []byte("broken"), ReadErr: errors.New("connection reset"), FailAfter: 3})
+	client.AddData("/remote/ok.bin", []byte("ok"))
+	jobs := []FileJob{
+		{RemotePath: "/remote/flaky.bin", ID: "flaky"},
+		{RemotePath: "/remote/broken.bin", ID: "broken"},
+		{RemotePath: "/remote/ok.bin", ID: "ok"},
+	}
+
+	cfg := PipelineCfg{SFTPReaders: 2, Workers: 2, RetryPolicy: RetryPolicy{MaxRetries: 2}}
+	transferred, errs := cfg.TransferFilesWithErrors(client, jobs, func(FileResult) error { return nil })
+	if transferred != 2 || len(errs) != 1 || errs[0].ID != "broken" || errs[0].Stage != StageRead {
+		t.Fatalf("expected flaky to recover and broken to fail its read, got %d transferred, %v", transferred, errs)
+	}
+	if n := client.Opens("/remote/flaky.bin"); n != 3 {
+		t.Errorf("expected 3 opens of flaky, got %d", n)
+	}
+	if n := client.Opens("/remote/broken.bin"); n != 3 {
+		t.Errorf("expected 3 attempts at broken, got %d", n)
+	}
+}
+
+func TestMaxRetryElapsed(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	client.Add("/remote/doomed.bin", sftptest.File{OpenErr: errors.New("connection reset")})
+	jobs := []FileJob{{RemotePath: "/remote/doomed.bin", ID: "doomed"}}
+
+	cfg := PipelineCfg{SFTPReaders: 1, Workers: 1, RetryPolicy: RetryPolicy{
+		MaxRetries:      1000,
+		BackoffBase:     10 * time.Millisecond,
+		MaxBackoff:      10 * time.Millisecond,
+		MaxRetryElapsed: 100 * time.Millisecond,
+	}}
+	start := time.Now()
+	transferred, failed := cfg.TransferFiles(client, jobs, func(FileResult) error { return nil })
+	elapsed := time.Since(start)
+	if transferred != 0 || failed != 1 {
+		t.Fatalf("expected the file to fail, got %d transferred, %d failed", transferred, failed)
+	}
+	if elapsed > time.Second {
+		t.Errorf("retries ran for %s past a 100ms cap", elapsed)
+	}
+	// About one attempt per 10ms wait fits under the cap, far short of 1000
+	if n := client.Opens("/remote/doomed.bin"); n < 2 || n > 12 {
+		t.Errorf("expected around 10 attempts within the cap, got %d", n)
+	}
+}
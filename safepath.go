@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// SafeJoin joins name onto root for writing a file locally, failing with
+// ErrUnsafePath if the result would not lie inside root. Both "/" and "\"
+// separate components of name, whatever the platform, and absolute names,
+// drive letters and ".." components that climb out of root are rejected.
+func SafeJoin(root, name string) (string, error) {
+	clean, err := safeName(name)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(root, filepath.FromSlash(clean)), nil
+}
+
+// safeName is name cleaned to a relative, slash-separated path, under the
+// rules of SafeJoin.
+func safeName(name string) (string, error) {
+	slashed := strings.ReplaceAll(name, `\`, "/")
+	if len(slashed) >= 2 && slashed[1] == ':' {
+		return "", fmt.Errorf("%w: %q has a drive letter", ErrUnsafePath, name)
+	}
+	if path.IsAbs(slashed) {
+		return "", fmt.Errorf("%w: %q is absolute", ErrUnsafePath, name)
+	}
+	clean := path.Clean(slashed)
+	if clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("%w: %q escapes the destination", ErrUnsafePath, name)
+	}
+	return clean, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestSafeJoin(t *testing.T) {
+	root := filepath.FromSlash("/data/out")
+	for name, want := range map[string]string{
+		"a.csv":            "a.csv",
+		"2024/01/a.csv":    "2024/01/a.csv",
+		`2024\01\a.csv`:    "2024/01/a.csv",
+		"./x/../a.csv":     "a.csv",
+		"x/./y//a.csv":     "x/y/a.csv",
+		`x\..\a.csv`:       "a.csv",
+		"..a.csv":          "..a.csv",
+		"dir/..hidden/a.c": "dir/..hidden/a.c",
+	} {
+		got, err := SafeJoin(root, name)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", name, err)
+			continue
+		}
+		if want := filepath.Join(root, filepath.FromSlash(want)); got != want {
+			t.Errorf("%q: expected %s, got %s", name, want, got)
+		}
+	}
+
+	for _, name := range []string{
+		"",
+		".",
+		"..",
+		"../passwd",
+		"../../etc/passwd",
+		"a/../../passwd",
+		`..\..\windows\system32`,
+		`a\..\..\passwd`,
+		"/etc/passwd",
+		`\windows\system32`,
+		`C:\windows\system32`,
+		"c:passwd",
+	} {
+		if got, err := SafeJoin(root, name); !errors.Is(err, ErrUnsafePath) {
+			t.Errorf("%q: expected ErrUnsafePath, got %q, %v", name, got, err)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+)
+
+// smallestFirst forwards reads from in to its workers smallest first, among
+// up to size reads held back while the workers are busy, so a huge file
+// doesn't hold up the small ones that arrive with it. Ties go to the earliest
+// job. Once ctx is done, the reads held back and any still coming in on in
+// are passed to drop.
+func smallestFirst(ctx context.Context, in <-chan fileRead, size int, drop func(fileRead)) <-chan fileRead {
+	out := make(chan fileRead)
+	go func() {
+		defer close(out)
+		h := &jobHeap[fileRead]{prio: func(read fileRead) int { return -int(read.size) }}
+		defer func() {
+			for _, item := range h.items {
+				drop(item.job)
+			}
+			if in != nil {
+				for read := range in {
+					drop(read)
+				}
+			}
+		}()
+		for {
+			recv, send := in, out
+			if h.Len() >= size {
+				recv = nil
+			}
+			var next fileRead
+			if h.Len() > 0 {
+				next = h.items[0].job
+			} else {
+				send = nil
+			}
+			if recv == nil && send == nil {
+				return
+			}
+			select {
+			case read, ok := <-recv:
+				if !ok {
+					in = nil
+					continue
+				}
+				heap.Push(h, queued[fileRead]{index: read.index, job: read})
+			case send <- next:
+				heap.Pop(h)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
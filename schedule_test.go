@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+func TestSizeAwareScheduling(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	client.AddData("/remote/first.bin", []byte("first"))
+	client.Add("/remote/giant.bin", sftptest.File{Data: bytes.Repeat([]byte("g"), 8<<20), OpenLatency: 2 * time.Millisecond})
+	jobs := []FileJob{{RemotePath: "/remote/first.bin", ID: "first"}, {RemotePath: "/remote/giant.bin", ID: "giant"}}
+	// The small files are read after the giant one, while the worker is
+	// still busy with the first file
+	for i := 0; i < 30; i++ {
+		path := fmt.Sprintf("/remote/small_%d.bin", i)
+		client.Add(path, sftptest.File{Data: []byte("small"), OpenLatency: 10 * time.Millisecond})
+		jobs = append(jobs, FileJob{RemotePath: path, ID: fmt.Sprintf("small_%d", i)})
+	}
+
+	var mu sync.Mutex
+	var order []string
+	cfg := PipelineCfg{SFTPReaders: 8, Workers: 1, BufferSize: 40, SizeAwareScheduling: true}
+	transferred, _ := cfg.TransferFiles(client, jobs, func(r FileResult) error {
+		if r.ID == "first" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		mu.Lock()
+		order = append(order, r.ID)
+		mu.Unlock()
+		return nil
+	})
+	if transferred != int32(len(jobs)) {
+		t.Fatalf("expected %d transferred, got %d", len(jobs), transferred)
+	}
+	if order[len(order)-1] != "giant" {
+		t.Errorf("expected the giant file to be processed after every small one, got %v", order)
+	}
+}
@@ -0,0 +1,258 @@
+// Package sftptest provides a fake SFTP client for testing code built on the
+// pipeline, with per-file content, attributes, latency and injected failures.
+package sftptest
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+// File is the content and behaviour of one fake remote file.
+type File struct {
+	Data    []byte
+	ModTime time.Time
+	// Mode is the file's permission bits as Stat reports them. Zero means
+	// 0o644.
+	Mode os.FileMode
+	// StatErr, if set, fails every Stat of the file.
+	StatErr error
+	// Seekable makes the opened file an io.Seeker and io.ReaderAt, as a
+	// remote file that supports ranged reads is.
+	Seekable bool
+	// OpenLatency delays each Open of the file.
+	OpenLatency time.Duration
+	// ReadLatency delays each Read.
+	ReadLatency time.Duration
+	// OpenErr, if set, fails every Open of the file.
+	OpenErr error
+	// FailOpens fails the first FailOpens Opens with ErrInjected, for
+	// testing retries.
+	FailOpens int
+	// ReadErr, if set, is returned by Read once FailAfter bytes have been
+	// read, in place of the rest of the file. FailReads limits it to the
+	// first FailReads files opened after FailOpens; zero means all of them.
+	ReadErr   error
+	FailAfter int
+	FailReads int
+	// MaxRead, when positive, caps the bytes each Read returns, for testing
+	// short reads.
+	MaxRead int
+}
+
+// ErrInjected is the error of an Open failed by File.FailOpens.
+var ErrInjected = errors.New("sftptest: injected failure")
+
+// FakeClient serves Files by path. It satisfies the pipeline's SFTPClient
+// and can Stat. It is safe for concurrent use, and files may be added while
+// it is in use.
+type FakeClient struct {
+	mu     sync.Mutex
+	files  map[string]*File
+	opens  map[string]int
+	closes map[string]int
+	served map[string]int
+	// open counts files from the start of their Open to their Close, and
+	// peak is the most there have been.
+	open, peak int
+}
+
+// NewFakeClient returns a FakeClient with no files.
+func NewFakeClient() *FakeClient {
+	return &FakeClient{files: map[string]*File{}, opens: map[string]int{}, closes: map[string]int{}, served: map[string]int{}}
+}
+
+// Add serves f at path, replacing any file already there.
+func (c *FakeClient) Add(path string, f File) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.files[path] = &f
+}
+
+// AddData serves data at path as a plain file.
+func (c *FakeClient) AddData(path string, data []byte) {
+	c.Add(path, File{Data: data})
+}
+
+// Delete stops serving path, as if the remote file had been removed.
+func (c *FakeClient) Delete(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.files, path)
+}
+
+// Opens returns how many times path has been opened, including failed
+// attempts.
+func (c *FakeClient) Opens(path string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.opens[path]
+}
+
+// Closes returns how many times files opened at path have been closed.
+func (c *FakeClient) Closes(path string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closes[path]
+}
+
+// PeakOpen returns the most files that have been open at once, counting
+// each from the start of its Open to its Close.
+func (c *FakeClient) PeakOpen() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.peak
+}
+
+// Served returns how many bytes have been read from path, over all its
+// Opens.
+func (c *FakeClient) Served(path string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.served[path]
+}
+
+// Open opens the file at path, after its OpenLatency.
+func (c *FakeClient) Open(name string) (io.ReadCloser, error) {
+	c.mu.Lock()
+	f, ok := c.files[name]
+	c.opens[name]++
+	n := c.opens[name]
+	if ok {
+		c.open++
+		c.peak = max(c.peak, c.open)
+	}
+	c.mu.Unlock()
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	time.Sleep(f.OpenLatency)
+	var err error
+	switch {
+	case f.OpenErr != nil:
+		err = f.OpenErr
+	case n <= f.FailOpens:
+		err = ErrInjected
+	}
+	if err != nil {
+		c.mu.Lock()
+		c.open--
+		c.mu.Unlock()
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	r := &reader{c: c, path: name, f: f, r: bytes.NewReader(f.Data), closed: make(chan struct{})}
+	r.failRead = f.ReadErr != nil && (f.FailReads == 0 || n <= f.FailOpens+f.FailReads)
+	if f.Seekable {
+		return seekReader{r}, nil
+	}
+	return r, nil
+}
+
+// Stat describes the file at path.
+func (c *FakeClient) Stat(name string) (os.FileInfo, error) {
+	c.mu.Lock()
+	f, ok := c.files[name]
+	c.mu.Unlock()
+	switch {
+	case !ok:
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	case f.StatErr != nil:
+		return nil, &os.PathError{Op: "stat", Path: name, Err: f.StatErr}
+	}
+	mode := f.Mode
+	if mode == 0 {
+		mode = 0o644
+	}
+	return fileInfo{name: path.Base(name), size: int64(len(f.Data)), mode: mode, modTime: f.ModTime}, nil
+}
+
+// reader is an open File. Closing it interrupts a Read waiting out its
+// latency.
+type reader struct {
+	c    *FakeClient
+	path string
+	f    *File
+	r    *bytes.Reader
+	read int
+	// failRead is whether this Open fails with ReadErr.
+	failRead  bool
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if r.f.ReadLatency > 0 {
+		t := time.NewTimer(r.f.ReadLatency)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-r.closed:
+		}
+	}
+	select {
+	case <-r.closed:
+		return 0, os.ErrClosed
+	default:
+	}
+	if r.failRead {
+		left := r.f.FailAfter - r.read
+		if left <= 0 {
+			return 0, r.f.ReadErr
+		}
+		p = p[:min(len(p), left)]
+	}
+	if r.f.MaxRead > 0 {
+		p = p[:min(len(p), r.f.MaxRead)]
+	}
+	n, err := r.r.Read(p)
+	r.read += n
+	r.c.mu.Lock()
+	r.c.served[r.path] += n
+	r.c.mu.Unlock()
+	return n, err
+}
+
+func (r *reader) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.closed)
+		r.c.mu.Lock()
+		r.c.closes[r.path]++
+		r.c.open--
+		r.c.mu.Unlock()
+	})
+	return nil
+}
+
+// seekReader is an open Seekable File. ReadAt, like a ranged read, has no
+// latency and doesn't fail.
+type seekReader struct{ *reader }
+
+func (r seekReader) Seek(offset int64, whence int) (int64, error) {
+	return r.r.Seek(offset, whence)
+}
+
+func (r seekReader) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.r.ReadAt(p, off)
+	r.c.mu.Lock()
+	r.c.served[r.path] += n
+	r.c.mu.Unlock()
+	return n, err
+}
+
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (fi fileInfo) Name() string       { return fi.name }
+func (fi fileInfo) Size() int64        { return fi.size }
+func (fi fileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi fileInfo) IsDir() bool        { return false }
+func (fi fileInfo) Sys() any           { return nil }
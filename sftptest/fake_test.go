@@ -0,0 +1,160 @@
+package sftptest
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestFakeClientContent(t *testing.T) {
+	c := NewFakeClient()
+	c.AddData("/a.txt", []byte("hello"))
+
+	f, err := c.Open("/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if data, err := io.ReadAll(f); err != nil || string(data) != "hello" {
+		t.Fatalf("got %q, %v", data, err)
+	}
+	if info, err := c.Stat("/a.txt"); err != nil || info.Size() != 5 || info.Name() != "a.txt" {
+		t.Errorf("got %v, %v", info, err)
+	}
+	if _, err := c.Open("/missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected ErrNotExist, got %v", err)
+	}
+	if _, err := c.Stat("/missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected ErrNotExist, got %v", err)
+	}
+	c.Delete("/a.txt")
+	if _, err := c.Open("/a.txt"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected ErrNotExist once deleted, got %v", err)
+	}
+}
+
+func TestFakeClientLatency(t *testing.T) {
+	c := NewFakeClient()
+	c.Add("/slow", File{Data: []byte("ab"), OpenLatency: 30 * time.Millisecond, ReadLatency: 20 * time.Millisecond, MaxRead: 1})
+
+	start := time.Now()
+	f, err := c.Open("/slow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 30*time.Millisecond {
+		t.Errorf("Open took %s, want at least 30ms", d)
+	}
+	start = time.Now()
+	data, err := io.ReadAll(f)
+	// Reads of one byte each: a, b, then EOF
+	if err != nil || string(data) != "ab" {
+		t.Fatalf("got %q, %v", data, err)
+	}
+	if d := time.Since(start); d < 60*time.Millisecond {
+		t.Errorf("reads took %s, want at least 60ms", d)
+	}
+
+	// Close interrupts a Read waiting out its latency
+	c.Add("/slower", File{Data: []byte("x"), ReadLatency: time.Hour})
+	f, _ = c.Open("/slower")
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		f.Close()
+	}()
+	if _, err := f.Read(make([]byte, 1)); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+}
+
+func TestFakeClientErrors(t *testing.T) {
+	errDenied := errors.New("denied")
+	errReset := errors.New("connection reset")
+	c := NewFakeClient()
+	c.Add("/denied", File{OpenErr: errDenied})
+	c.Add("/flaky", File{Data: []byte("ok"), FailOpens: 2})
+	c.Add("/broken", File{Data: []byte("0123456789"), ReadErr: errReset, FailAfter: 4})
+
+	if _, err := c.Open("/denied"); !errors.Is(err, errDenied) {
+		t.Errorf("expected the open error, got %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := c.Open("/flaky"); !errors.Is(err, ErrInjected) {
+			t.Errorf("open %d: expected ErrInjected, got %v", i, err)
+		}
+	}
+	if _, err := c.Open("/flaky"); err != nil {
+		t.Errorf("expected the third open to succeed, got %v", err)
+	}
+	if n := c.Opens("/flaky"); n != 3 {
+		t.Errorf("expected 3 opens, got %d", n)
+	}
+
+	f, err := c.Open("/broken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(f)
+	if !errors.Is(err, errReset) || string(data) != "0123" {
+		t.Errorf("expected 4 bytes then the read error, got %q, %v", data, err)
+	}
+}
+
+func TestFakeClientAttributes(t *testing.T) {
+	mtime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	errStat := errors.New("stat unsupported")
+	c := NewFakeClient()
+	c.Add("/run.sh", File{Data: []byte("#!/bin/sh\n"), Mode: 0o751, ModTime: mtime})
+	c.Add("/plain", File{})
+	c.Add("/nostat", File{StatErr: errStat})
+
+	if info, err := c.Stat("/run.sh"); err != nil || info.Mode() != 0o751 || !info.ModTime().Equal(mtime) {
+		t.Errorf("expected mode 0751 and the mtime, got %v, %v", info, err)
+	}
+	if info, err := c.Stat("/plain"); err != nil || info.Mode() != 0o644 {
+		t.Errorf("expected the default mode 0644, got %v, %v", info, err)
+	}
+	if _, err := c.Stat("/nostat"); !errors.Is(err, errStat) {
+		t.Errorf("expected the stat error, got %v", err)
+	}
+}
+
+func TestFakeClientSeekAndCounters(t *testing.T) {
+	errReset := errors.New("connection reset")
+	c := NewFakeClient()
+	c.Add("/flat", File{Data: []byte("0123456789")})
+	c.Add("/ranged", File{Data: []byte("0123456789"), Seekable: true, ReadErr: errReset, FailAfter: 4, FailReads: 1})
+
+	f, _ := c.Open("/flat")
+	if _, ok := f.(io.Seeker); ok {
+		t.Error("expected a file that isn't Seekable not to seek")
+	}
+	f.Close()
+	f.Close()
+	if n := c.Closes("/flat"); n != 1 {
+		t.Errorf("expected 1 close, got %d", n)
+	}
+
+	// The first open breaks after 4 bytes; the second resumes from there
+	f, _ = c.Open("/ranged")
+	if data, err := io.ReadAll(f); !errors.Is(err, errReset) || string(data) != "0123" {
+		t.Fatalf("expected 4 bytes then the read error, got %q, %v", data, err)
+	}
+	f.Close()
+	f, _ = c.Open("/ranged")
+	defer f.Close()
+	if _, err := f.(io.Seeker).Seek(4, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := io.ReadAll(f); err != nil || string(data) != "456789" {
+		t.Errorf("expected the rest of the file, got %q, %v", data, err)
+	}
+	if n := c.Served("/ranged"); n != 10 {
+		t.Errorf("expected 10 bytes served over both opens, got %d", n)
+	}
+	if n := c.PeakOpen(); n != 1 {
+		t.Errorf("expected one file open at a time, got a peak of %d", n)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+// shuffle returns src's jobs in a random order for Shuffle, drawn from
+// ShuffleSeed, or from the clock if that is zero. Each job keeps its input
+// index, so results placed by index still come back in input order. The
+// caller's slice is left as it is.
+func (cfg PipelineCfg) shuffle(src source[FileJob]) (source[FileJob], error) {
+	if !cfg.Shuffle {
+		return src, nil
+	}
+	if cfg.Ordered {
+		return src, errors.New("Shuffle can't be combined with Ordered")
+	}
+	if src.slice == nil {
+		return src, errors.New("Shuffle needs a slice of jobs")
+	}
+	seed := uint64(cfg.ShuffleSeed)
+	if seed == 0 {
+		seed = uint64(time.Now().UnixNano())
+	}
+	order := make([]int, len(src.slice))
+	for i := range order {
+		order[i] = i
+	}
+	rand.New(rand.NewPCG(seed, seed)).Shuffle(len(order), func(i, j int) {
+		order[i], order[j] = order[j], order[i]
+	})
+	jobs := make([]FileJob, len(order))
+	for i, index := range order {
+		jobs[i] = src.slice[index]
+	}
+	shuffled := fromSlice(jobs)
+	shuffled.order = order
+	return shuffled, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+func TestShuffle(t *testing.T) {
+	client := newFakeClient(map[string][]byte{"/remote/a.bin": []byte("a")})
+	jobs := make([]FileJob, 50)
+	for i := range jobs {
+		jobs[i] = FileJob{RemotePath: "/remote/a.bin", ID: fmt.Sprintf("id_%02d", i)}
+	}
+
+	run := func(seed int64) []string {
+		cfg := PipelineCfg{SFTPReaders: 1, Workers: 1, BufferSize: 1, Shuffle: true, ShuffleSeed: seed}
+		var ids []string
+		cfg.OnFileStart = func(job FileJob) { ids = append(ids, job.ID) }
+		stats, err := cfg.TransferFilesStats(context.Background(), client, jobs, func(FileResult) error { return nil })
+		if err != nil || stats.Transferred != 50 {
+			t.Fatalf("seed %d: %+v, %v", seed, stats, err)
+		}
+		return ids
+	}
+	first, again, other := run(42), run(42), run(7)
+	if !slices.Equal(first, again) {
+		t.Errorf("the same seed gave different orders:\n%v\n%v", first, again)
+	}
+	if slices.Equal(first, other) {
+		t.Error("different seeds gave the same order")
+	}
+	var ids []string
+	for _, job := range jobs {
+		ids = append(ids, job.ID)
+	}
+	if slices.Equal(first, ids) {
+		t.Error("expected the jobs out of input order")
+	}
+	sorted := slices.Sorted(slices.Values(first))
+	if !slices.Equal(sorted, ids) {
+		t.Errorf("expected a permutation of the jobs, got %v", first)
+	}
+	if !slices.IsSortedFunc(jobs, func(a, b FileJob) int { return strings.Compare(a.ID, b.ID) }) {
+		t.Error("Shuffle reordered the caller's slice")
+	}
+}
+
+func TestShuffleErrors(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	cfg := DefaultCfg()
+	cfg.Shuffle, cfg.Ordered = true, true
+	if _, err := cfg.TransferFilesStats(context.Background(), client, nil, func(FileResult) error { return nil }); err == nil {
+		t.Error("expected Shuffle with Ordered to fail")
+	}
+	cfg.Ordered = false
+	jobsChan := make(chan FileJob)
+	close(jobsChan)
+	if _, err := cfg.TransferFilesChan(context.Background(), client, jobsChan, func(FileResult) error { return nil }); err == nil {
+		t.Error("expected Shuffle of a channel to fail")
+	}
+	if _, err := cfg.TransferFilesStats(context.Background(), client, nil, func(FileResult) error { return nil }); err != nil {
+		t.Errorf("expected an empty slice to shuffle, got %v", err)
+	}
+}
+
+func TestShuffleCollectFiles(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	jobs := fileJobs(client, 20, dataFile)
+	cfg := DefaultCfg()
+	cfg.SFTPReaders = 1
+	cfg.Shuffle, cfg.ShuffleSeed = true, 42
+	var started []string
+	cfg.OnFileStart = func(job FileJob) { started = append(started, job.ID) }
+	results, errs := cfg.CollectFiles(client, jobs)
+	if len(errs) != 0 || len(results) != len(jobs) {
+		t.Fatalf("expected %d results, got %d, %v", len(jobs), len(results), errs)
+	}
+	for i, result := range results {
+		if result.ID != jobs[i].ID {
+			t.Fatalf("expected results in input order, got %s at %d", result.ID, i)
+		}
+	}
+	var ids []string
+	for _, job := range jobs {
+		ids = append(ids, job.ID)
+	}
+	if slices.Equal(started, ids) {
+		t.Error("expected the jobs to start out of input order")
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+func TestStopDrainsInFlightWork(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	jobs := fileJobs(client, 500, slowFile)
+	stop := make(chan struct{})
+	var processed atomic.Int32
+	processFunc := func(FileResult) error {
+		if processed.Add(1) == 50 {
+			close(stop)
+		}
+		return nil
+	}
+
+	cfg := PipelineCfg{SFTPReaders: 16, Workers: 4, BufferSize: 8, Stop: stop}
+	stats, err := cfg.TransferFilesStats(context.Background(), client, jobs, processFunc)
+	if !errors.Is(err, ErrStopped) {
+		t.Fatalf("expected ErrStopped, got %v", err)
+	}
+	if stats.Transferred >= int32(len(jobs)) {
+		t.Fatalf("stop had no effect: %d transferred", stats.Transferred)
+	}
+	// Every file that was opened must have been read and processed
+	if n := opened(client, jobs); stats.Transferred != n || processed.Load() != n {
+		t.Errorf("lost in-flight work: %d opened, %d processed, %d transferred", n, processed.Load(), stats.Transferred)
+	}
+}
+
+func TestCancelAbandonsInFlightWork(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	jobs := fileJobs(client, 500, slowFile)
+	ctx, cancel := context.WithCancel(context.Background())
+	var processed atomic.Int32
+	processFunc := func(FileResult) error {
+		if processed.Add(1) == 50 {
+			cancel()
+		}
+		return nil
+	}
+
+	cfg := PipelineCfg{SFTPReaders: 16, Workers: 4, BufferSize: 8}
+	stats, err := cfg.TransferFilesStats(ctx, client, jobs, processFunc)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if n := opened(client, jobs); stats.Transferred >= n {
+		t.Errorf("expected cancellation to drop in-flight files: %d opened, %d transferred", n, stats.Transferred)
+	}
+}
+
+func TestStopAfterCompletionIsNotAnError(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	jobs := fileJobs(client, 5, slowFile)
+	stop := make(chan struct{})
+	cfg := PipelineCfg{SFTPReaders: 4, Workers: 2, BufferSize: 2, Stop: stop}
+	stats, err := cfg.TransferFilesStats(context.Background(), client, jobs, func(FileResult) error { return nil })
+	close(stop)
+	if err != nil || stats.Transferred != 5 {
+		t.Fatalf("expected a clean run, got %d transferred and %v", stats.Transferred, err)
+	}
+}
+
+func TestDeadline(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	jobs := fileJobs(client, 500, slowFile)
+	cfg := PipelineCfg{SFTPReaders: 4, Workers: 2, BufferSize: 2, Deadline: 30 * time.Millisecond}
+
+	start := time.Now()
+	stats, err := cfg.TransferFilesStats(context.Background(), client, jobs, func(FileResult) error { return nil })
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("run took %s despite a %s deadline", elapsed, cfg.Deadline)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if !stats.DeadlineExceeded {
+		t.Error("expected DeadlineExceeded to be set")
+	}
+	if stats.Transferred == 0 || stats.Transferred >= int32(len(jobs)) {
+		t.Errorf("expected a partial run, got %d of %d transferred", stats.Transferred, len(jobs))
+	}
+	if stats.Failed != 0 {
+		t.Errorf("reads cut off by the deadline should not count as failed, got %d", stats.Failed)
+	}
+
+	stats, err = cfg.stream(context.Background(), client, fromSlice(jobs), nil, func(job FileJob, r io.Reader) error {
+		_, err := io.Copy(io.Discard, r)
+		return err
+	}, nil)
+	if !errors.Is(err, context.DeadlineExceeded) || !stats.DeadlineExceeded {
+		t.Errorf("streaming: expected the deadline to end the run, got %v, %+v", err, stats)
+	}
+}
+
+func TestDeadlineNotReached(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	jobs := fileJobs(client, 10, slowFile)
+	cfg := PipelineCfg{SFTPReaders: 10, Workers: 2, BufferSize: 2, Deadline: time.Minute}
+	stats, err := cfg.TransferFilesStats(context.Background(), client, jobs, func(FileResult) error { return nil })
+	if err != nil || stats.DeadlineExceeded || stats.Transferred != 10 {
+		t.Errorf("expected a complete run, got %v, %+v", err, stats)
+	}
+
+	// The caller's own deadline isn't PipelineCfg.Deadline
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	stats, _ = cfg.TransferFilesStats(ctx, client, jobs, func(FileResult) error { return nil })
+	if stats.DeadlineExceeded {
+		t.Error("DeadlineExceeded set for a context deadline")
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import "context"
+
+// ResultSink is a destination for a run's results. Write is called for each
+// result, concurrently from the Workers like a ProcessFunc, and its error
+// fails the file. Once the run has drained, Flush and then Close are called
+// exactly once each, whatever the run's outcome.
+type ResultSink interface {
+	Write(result FileResult) error
+	Flush() error
+	Close() error
+}
+
+// FuncSink is a ResultSink that passes each result to a ProcessFunc. Its
+// Flush and Close do nothing.
+type FuncSink ProcessFunc
+
+func (f FuncSink) Write(result FileResult) error { return f(result) }
+func (FuncSink) Flush() error                    { return nil }
+func (FuncSink) Close() error                    { return nil }
+
+// DirSink is a ResultSink that writes each result to a file in Dir named by
+// its ID, via a ".tmp" file renamed into place. IDs that SafeJoin rejects
+// fail their file.
+type DirSink struct {
+	Dir string
+	// Fsync syncs each file before it is renamed into place, and its
+	// directory after, as PipelineCfg.Fsync does.
+	Fsync bool
+}
+
+func (s DirSink) Write(result FileResult) error {
+	dest, err := SafeJoin(s.Dir, result.ID)
+	if err != nil {
+		return err
+	}
+	rd, err := result.Reader()
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
+	return writeFile(dest, rd, s.Fsync, nil)
+}
+
+func (DirSink) Flush() error { return nil }
+func (DirSink) Close() error { return nil }
+
+// TransferFilesToSink is TransferFilesStats writing results to sink. The
+// run's error is returned if there is one, otherwise Flush's, then Close's.
+func (cfg PipelineCfg) TransferFilesToSink(ctx context.Context, sftpClient SFTPClient, jobs []FileJob, sink ResultSink) (TransferStats, error) {
+	stats, err := cfg.transfer(ctx, []SFTPClient{sftpClient}, fromSlice(jobs), sink.Write, hooks{})
+	if flushErr := sink.Flush(); err == nil {
+		err = flushErr
+	}
+	if closeErr := sink.Close(); err == nil {
+		err = closeErr
+	}
+	return stats, err
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+// recordingSink counts the calls made to it and fails the Write of IDs in
+// fail.
+type recordingSink struct {
+	mu      sync.Mutex
+	writes  int
+	flushes int
+	closes  int
+	// writesAtFlush is writes when Flush was first called.
+	writesAtFlush int
+	fail          map[string]bool
+	flushErr      error
+}
+
+func (s *recordingSink) Write(r FileResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail[r.ID] {
+		return errors.New("rejected")
+	}
+	s.writes++
+	return nil
+}
+
+func (s *recordingSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.flushes == 0 {
+		s.writesAtFlush = s.writes
+	}
+	s.flushes++
+	return s.flushErr
+}
+
+func (s *recordingSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.flushes == 0 {
+		return errors.New("closed before flush")
+	}
+	s.closes++
+	return nil
+}
+
+func TestResultSink(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	jobs := fileJobs(client, 50, dataFile)
+	sink := &recordingSink{fail: map[string]bool{"id_7": true}}
+	stats, err := DefaultCfg().TransferFilesToSink(context.Background(), client, jobs, sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Transferred != 49 || stats.Failed != 1 {
+		t.Errorf("expected a failed Write to fail its file, got %+v", stats)
+	}
+	if sink.flushes != 1 || sink.closes != 1 {
+		t.Errorf("expected Flush and Close once each, got %d and %d", sink.flushes, sink.closes)
+	}
+	if sink.writesAtFlush != 49 {
+		t.Errorf("expected Flush after every Write, got it after %d", sink.writesAtFlush)
+	}
+
+	// A Flush error is returned, and Close still runs
+	sink = &recordingSink{flushErr: errors.New("disk full")}
+	_, err = DefaultCfg().TransferFilesToSink(context.Background(), client, jobs, sink)
+	if err == nil || err.Error() != "disk full" {
+		t.Errorf("expected the Flush error, got %v", err)
+	}
+	if sink.closes != 1 {
+		t.Errorf("expected Close after a failed Flush, got %d", sink.closes)
+	}
+}
+
+func TestDirSink(t *testing.T) {
+	client := newFakeClient(map[string][]byte{"/remote/a.bin": []byte("alpha")})
+	dir := t.TempDir()
+	jobs := []FileJob{
+		{RemotePath: "/remote/a.bin", ID: "a.txt"},
+		{RemotePath: "/remote/a.bin", ID: "../escape.txt"},
+	}
+	var sink ResultSink = DirSink{Dir: dir}
+	stats, err := DefaultCfg().TransferFilesToSink(context.Background(), client, jobs, sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Transferred != 1 || stats.Failed != 1 {
+		t.Errorf("expected the unsafe ID to fail, got %+v", stats)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "a.txt"))
+	if err != nil || string(data) != "alpha" {
+		t.Errorf("expected a.txt to hold the file, got %q, %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "escape.txt")); err == nil {
+		t.Error("DirSink wrote outside its directory")
+	}
+
+	var calls int
+	sink = FuncSink(func(FileResult) error { calls++; return nil })
+	cfg := DefaultCfg()
+	cfg.Workers = 1
+	if _, err := cfg.TransferFilesToSink(context.Background(), client, jobs[:1], sink); err != nil || calls != 1 {
+		t.Errorf("FuncSink: %d calls, %v", calls, err)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// checkStat stats job's file when MinBytes, MaxBytes or ModifiedAfter is
+// set, returning ErrSkip if its size is out of range or it hasn't been
+// modified since ModifiedAfter.
+func (r *run) checkStat(client SFTPClient, job FileJob) error {
+	if r.cfg.MinBytes <= 0 && r.cfg.MaxBytes <= 0 && r.cfg.ModifiedAfter.IsZero() {
+		return nil
+	}
+	fi, err := statRemote(client, job.RemotePath)
+	if err != nil {
+		return err
+	}
+	size := fi.Size()
+	if size < r.cfg.MinBytes || (r.cfg.MaxBytes > 0 && size > r.cfg.MaxBytes) {
+		return fmt.Errorf("%w: %s is %d bytes", ErrSkip, job.RemotePath, size)
+	}
+	if after := r.cfg.ModifiedAfter; !after.IsZero() && !fi.ModTime().After(after) {
+		return fmt.Errorf("%w: %s last modified %s", ErrSkip, job.RemotePath, fi.ModTime().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// skipEmpty returns ErrSkip for a successful read of an empty file under
+// SkipEmpty, and err otherwise.
+func (r *run) skipEmpty(job FileJob, size int64, err error) error {
+	if err == nil && size == 0 && r.cfg.SkipEmpty {
+		return fmt.Errorf("%w: %s is empty", ErrSkip, job.RemotePath)
+	}
+	return err
+}
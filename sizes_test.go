@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+func TestSizeLimits(t *testing.T) {
+	client := newFakeClient(map[string][]byte{
+		"/remote/tiny.bin":  make([]byte, 9),
+		"/remote/min.bin":   make([]byte, 10),
+		"/remote/max.bin":   make([]byte, 100),
+		"/remote/huge.bin":  make([]byte, 101),
+		"/remote/empty.bin": {},
+	})
+	jobs := []FileJob{
+		{RemotePath: "/remote/tiny.bin", ID: "tiny"},
+		{RemotePath: "/remote/min.bin", ID: "min"},
+		{RemotePath: "/remote/max.bin", ID: "max"},
+		{RemotePath: "/remote/huge.bin", ID: "huge"},
+		{RemotePath: "/remote/empty.bin", ID: "empty"},
+	}
+
+	cfg := DefaultCfg()
+	cfg.MinBytes, cfg.MaxBytes = 10, 100
+	cfg.Ordered = true
+	var ids []string
+	stats, err := cfg.TransferFilesStats(context.Background(), client, jobs, func(r FileResult) error {
+		ids = append(ids, r.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Transferred != 2 || stats.Skipped != 3 || stats.Failed != 0 {
+		t.Errorf("expected 2 transferred and 3 skipped, got %+v", stats)
+	}
+	if len(ids) != 2 || ids[0] != "min" || ids[1] != "max" {
+		t.Errorf("expected the boundary files to be processed, got %v", ids)
+	}
+	if n := opened(client, jobs); n != 2 {
+		t.Errorf("files out of range should not be opened, got %d opens", n)
+	}
+
+	// MaxBytes alone leaves no lower bound
+	cfg = DefaultCfg()
+	cfg.MaxBytes = 100
+	transferred, failed, skipped := cfg.TransferFilesToDir(client, jobs, t.TempDir())
+	if transferred != 4 || failed != 0 || skipped != 1 {
+		t.Errorf("TransferFilesToDir: %d transferred, %d failed, %d skipped", transferred, failed, skipped)
+	}
+}
+
+func TestSizeLimitsNeedStat(t *testing.T) {
+	client := struct{ SFTPClient }{newFakeClient(map[string][]byte{"/remote/a.bin": []byte("a")})}
+	cfg := DefaultCfg()
+	cfg.MaxBytes = 100
+	_, errs := cfg.TransferFilesWithErrors(client, []FileJob{{RemotePath: "/remote/a.bin", ID: "a"}}, func(FileResult) error { return nil })
+	if len(errs) != 1 || errs[0].Stage != StageStat || !errors.Is(errs[0], errors.ErrUnsupported) {
+		t.Errorf("expected a stat-stage ErrUnsupported, got %v", errs)
+	}
+}
+
+func TestModifiedAfter(t *testing.T) {
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	client := sftptest.NewFakeClient()
+	client.Add("/remote/old.bin", sftptest.File{Data: []byte("old"), ModTime: since.Add(-time.Hour)})
+	client.Add("/remote/same.bin", sftptest.File{Data: []byte("same"), ModTime: since})
+	client.Add("/remote/new.bin", sftptest.File{Data: []byte("new"), ModTime: since.Add(time.Second)})
+	client.Add("/remote/newer.bin", sftptest.File{Data: []byte("newer"), ModTime: since.Add(24 * time.Hour)})
+	jobs := []FileJob{
+		{RemotePath: "/remote/old.bin", ID: "old"},
+		{RemotePath: "/remote/same.bin", ID: "same"},
+		{RemotePath: "/remote/new.bin", ID: "new"},
+		{RemotePath: "/remote/newer.bin", ID: "newer"},
+	}
+
+	cfg := DefaultCfg()
+	cfg.ModifiedAfter = since
+	cfg.Ordered = true
+	var ids []string
+	stats, err := cfg.TransferFilesStats(context.Background(), client, jobs, func(r FileResult) error {
+		ids = append(ids, r.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Transferred != 2 || stats.Skipped != 2 || stats.Failed != 0 {
+		t.Errorf("expected 2 transferred and 2 skipped, got %+v", stats)
+	}
+	if len(ids) != 2 || ids[0] != "new" || ids[1] != "newer" {
+		t.Errorf("expected only files modified after the cutoff, got %v", ids)
+	}
+}
+
+func TestSkipEmpty(t *testing.T) {
+	client := newFakeClient(map[string][]byte{
+		"/remote/full.bin":  []byte("data"),
+		"/remote/empty.bin": {},
+	})
+	jobs := []FileJob{
+		{RemotePath: "/remote/full.bin", ID: "full"},
+		{RemotePath: "/remote/empty.bin", ID: "empty"},
+	}
+	// The benchmark's processFunc, which fails empty data
+	processFunc := func(r FileResult) error {
+		if len(r.Data) == 0 {
+			return errors.New("empty data")
+		}
+		return nil
+	}
+
+	cfg := DefaultCfg()
+	cfg.SkipEmpty = true
+	stats, err := cfg.TransferFilesStats(context.Background(), client, jobs, processFunc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Transferred != 1 || stats.Skipped != 1 || stats.Failed != 0 {
+		t.Errorf("expected the empty file skipped, got %+v", stats)
+	}
+
+	cfg.SkipEmpty = false
+	if _, failed := cfg.TransferFiles(client, jobs, processFunc); failed != 1 {
+		t.Errorf("without SkipEmpty the empty file should reach processFunc and fail, got %d failed", failed)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// sniffLen is how many bytes http.DetectContentType looks at.
+const sniffLen = 512
+
+// SniffedReader is the reader the streaming variants pass to their process
+// function under SniffContentType. It reads the whole file, the sniffed
+// bytes included.
+type SniffedReader struct {
+	r           *bufio.Reader
+	src         io.Reader
+	contentType string
+}
+
+// newSniffedReader peeks at the start of r to sniff its content type. Peek
+// errors are left for Read to return.
+func newSniffedReader(r io.Reader) *SniffedReader {
+	br := bufio.NewReaderSize(r, sniffLen)
+	head, _ := br.Peek(sniffLen)
+	return &SniffedReader{r: br, src: r, contentType: http.DetectContentType(head)}
+}
+
+func (s *SniffedReader) Read(p []byte) (int, error) { return s.r.Read(p) }
+
+// Seek seeks the file, dropping the bytes buffered by the sniff, and fails
+// with errors.ErrUnsupported if the file can't seek.
+func (s *SniffedReader) Seek(offset int64, whence int) (int64, error) {
+	seeker, ok := s.src.(io.Seeker)
+	if !ok {
+		return 0, errors.ErrUnsupported
+	}
+	if whence == io.SeekCurrent {
+		offset -= int64(s.r.Buffered())
+	}
+	pos, err := seeker.Seek(offset, whence)
+	if err != nil {
+		return pos, err
+	}
+	s.r.Reset(s.src)
+	return pos, nil
+}
+
+// ContentType is the file's MIME type as sniffed by http.DetectContentType.
+func (s *SniffedReader) ContentType() string { return s.contentType }
+
+// contentType sniffs data's MIME type under SniffContentType.
+func (r *run) contentType(data []byte) string {
+	if !r.cfg.SniffContentType {
+		return ""
+	}
+	return http.DetectContentType(data)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+)
+
+func TestSniffContentType(t *testing.T) {
+	png := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 600)...)
+	files := map[string][]byte{
+		"/remote/image":  png,
+		"/remote/notes":  []byte("just some notes\n"),
+		"/remote/binary": {0x00, 0x01, 0x02},
+	}
+	client := newFakeClient(files)
+	jobs := []FileJob{
+		{RemotePath: "/remote/image", ID: "image"},
+		{RemotePath: "/remote/notes", ID: "notes"},
+		{RemotePath: "/remote/binary", ID: "binary"},
+	}
+	want := map[string]string{
+		"image":  "image/png",
+		"notes":  "text/plain; charset=utf-8",
+		"binary": "application/octet-stream",
+	}
+
+	cfg := DefaultCfg()
+	cfg.SniffContentType = true
+	var mu sync.Mutex
+	got := map[string]string{}
+	cfg.TransferFiles(client, jobs, func(r FileResult) error {
+		mu.Lock()
+		got[r.ID] = r.ContentType
+		mu.Unlock()
+		return nil
+	})
+	for id, ct := range want {
+		if got[id] != ct {
+			t.Errorf("%s: content type %q, want %q", id, got[id], ct)
+		}
+	}
+
+	// Streaming peeks without consuming
+	got = map[string]string{}
+	transferred, _ := cfg.TransferFilesStreaming(client, jobs, func(id string, r io.Reader) error {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(data, files["/remote/"+id]) {
+			t.Errorf("%s: streamed %d bytes, want the whole file", id, len(data))
+		}
+		mu.Lock()
+		got[id] = r.(*SniffedReader).ContentType()
+		mu.Unlock()
+		return nil
+	})
+	if transferred != 3 {
+		t.Fatalf("expected 3 streamed, got %d", transferred)
+	}
+	for id, ct := range want {
+		if got[id] != ct {
+			t.Errorf("streaming %s: content type %q, want %q", id, got[id], ct)
+		}
+	}
+
+	cfg.SniffContentType = false
+	cfg.TransferFiles(client, jobs[:1], func(r FileResult) error {
+		if r.ContentType != "" {
+			t.Errorf("expected no content type by default, got %q", r.ContentType)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"iter"
+	"slices"
+)
+
+// source is where a run pulls its jobs from. total is the number of jobs, or
+// 0 if it isn't known up front. slice holds the jobs of a source made from a
+// slice, and is nil for a streamed one. order, if set, holds the input index
+// of each job of a reordered slice.
+type source[T any] struct {
+	jobs  func(ctx context.Context) iter.Seq[T]
+	total int
+	slice []T
+	order []int
+}
+
+// index returns the input index of the ith job src yields.
+func (src source[T]) index(i int) int {
+	if src.order == nil {
+		return i
+	}
+	return src.order[i]
+}
+
+func fromSlice[T any](jobs []T) source[T] {
+	if jobs == nil {
+		jobs = []T{}
+	}
+	return source[T]{
+		jobs:  func(context.Context) iter.Seq[T] { return slices.Values(jobs) },
+		total: len(jobs),
+		slice: jobs,
+	}
+}
+
+// fromChan is a source that receives from jobs until it is closed or ctx is
+// done.
+func fromChan[T any](jobs <-chan T) source[T] {
+	return source[T]{jobs: func(ctx context.Context) iter.Seq[T] {
+		return func(yield func(T) bool) {
+			for {
+				select {
+				case job, ok := <-jobs:
+					if !ok || !yield(job) {
+						return
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}}
+}
+
+func fromSeq[T any](jobs iter.Seq[T]) source[T] {
+	return source[T]{jobs: func(context.Context) iter.Seq[T] { return jobs }}
+}
+
+// TransferFilesChan is TransferFilesStats taking jobs from a channel, so they
+// can come from an unbounded source. Jobs are received only as readers free
+// up, and the run ends once jobs is closed and everything received has
+// finished. After cancellation or Stop no more jobs are received, so the
+// sender must not block forever on a run that has returned. Progress is
+// reported with a total of 0.
+func (cfg PipelineCfg) TransferFilesChan(ctx context.Context, sftpClient SFTPClient, jobs <-chan FileJob, processFunc ProcessFunc) (TransferStats, error) {
+	return cfg.transfer(ctx, []SFTPClient{sftpClient}, fromChan(jobs), processFunc, hooks{})
+}
+
+// TransferFilesSeq is TransferFilesChan pulling jobs from an iterator, one at
+// a time as readers free up. Totals count only the jobs actually pulled. In
+// Ordered mode jobs are numbered in the order jobs yields them, and no more
+// than ReorderWindow are pulled ahead of the oldest unfinished one. The
+// iterator is not interrupted while it blocks, so a cancelled run returns
+// only once it next yields or returns.
+func (cfg PipelineCfg) TransferFilesSeq(ctx context.Context, sftpClient SFTPClient, jobs iter.Seq[FileJob], processFunc ProcessFunc) (TransferStats, error) {
+	return cfg.transfer(ctx, []SFTPClient{sftpClient}, fromSeq(jobs), processFunc, hooks{})
+}
+
+// limit returns src cut off after its first n jobs, or src itself if n isn't
+// positive. Nothing is pulled from src past the nth job.
+func limit[T any](src source[T], n int) source[T] {
+	if n <= 0 {
+		return src
+	}
+	if src.slice != nil {
+		return fromSlice(src.slice[:min(n, len(src.slice))])
+	}
+	return source[T]{
+		jobs: func(ctx context.Context) iter.Seq[T] {
+			return func(yield func(T) bool) {
+				i := 0
+				for job := range src.jobs(ctx) {
+					if !yield(job) {
+						return
+					}
+					if i++; i == n {
+						return
+					}
+				}
+			}
+		},
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+func TestTransferFilesChan(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	jobs := fileJobs(client, 200, slowFile)
+	cfg := PipelineCfg{SFTPReaders: 4, Workers: 2, BufferSize: 2}
+
+	jobsChan := make(chan FileJob)
+	var ahead int32
+	go func() {
+		defer close(jobsChan)
+		for i, job := range jobs {
+			jobsChan <- job
+			ahead = max(ahead, int32(i+1)-opened(client, jobs))
+		}
+	}()
+
+	stats, err := cfg.TransferFilesChan(context.Background(), client, jobsChan, func(FileResult) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Transferred != int32(len(jobs)) {
+		t.Errorf("expected %d transfers, got %d", len(jobs), stats.Transferred)
+	}
+	// Each reader may hold one job it hasn't opened yet, on top of the
+	// dispatcher's lookahead, the feeder's buffer and the job in its hand
+	if limit := int32(2*cfg.SFTPReaders + 2); ahead > limit {
+		t.Errorf("sender got %d jobs ahead of the readers, want at most %d", ahead, limit)
+	}
+}
+
+func TestTransferFilesChanCancel(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	jobs := fileJobs(client, 20, slowFile)
+	jobsChan := make(chan FileJob, len(jobs))
+	for _, job := range jobs {
+		jobsChan <- job
+	}
+	// jobsChan is never closed, so only cancellation ends the run
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	stats, err := PipelineCfg{SFTPReaders: 4, Workers: 2, BufferSize: 2}.TransferFilesChan(ctx, client, jobsChan, func(FileResult) error { return nil })
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if stats.Transferred != int32(len(jobs)) {
+		t.Errorf("expected %d transfers before the run ended, got %d", len(jobs), stats.Transferred)
+	}
+}
+
+func TestTransferFilesChanStop(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	jobs := fileJobs(client, 20, slowFile)
+	jobsChan := make(chan FileJob, len(jobs))
+	for _, job := range jobs {
+		jobsChan <- job
+	}
+	close(jobsChan)
+
+	stop := make(chan struct{})
+	close(stop)
+	cfg := PipelineCfg{SFTPReaders: 4, Workers: 2, BufferSize: 2, Stop: stop}
+	if _, err := cfg.TransferFilesChan(context.Background(), client, jobsChan, func(FileResult) error { return nil }); !errors.Is(err, ErrStopped) {
+		t.Errorf("expected ErrStopped, got %v", err)
+	}
+}
+
+func TestTransferFilesSeq(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	jobs := fileJobs(client, 100, slowFile)
+	var pulled, ahead int32
+	seq := func(yield func(FileJob) bool) {
+		for _, job := range jobs {
+			pulled++
+			ahead = max(ahead, pulled-opened(client, jobs))
+			if !yield(job) {
+				return
+			}
+		}
+	}
+
+	cfg := PipelineCfg{SFTPReaders: 4, Workers: 2, BufferSize: 2, Ordered: true, ReorderWindow: 4}
+	var ids []string
+	stats, err := cfg.TransferFilesSeq(context.Background(), client, seq, func(r FileResult) error {
+		ids = append(ids, r.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Transferred != int32(len(jobs)) || pulled != int32(len(jobs)) {
+		t.Errorf("expected %d pulled and transferred, got %d and %d", len(jobs), pulled, stats.Transferred)
+	}
+	if limit := int32(cfg.ReorderWindow + 1); ahead > limit {
+		t.Errorf("pulled %d jobs ahead of the readers, want at most %d", ahead, limit)
+	}
+	for i, id := range ids {
+		if id != jobs[i].ID {
+			t.Fatalf("result %d is %s, want %s", i, id, jobs[i].ID)
+		}
+	}
+}
+
+func TestTransferFilesSeqStopsPulling(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	fileJobs(client, 1, slowFile)
+	var pulled int
+	// An endless source, cut off by cancellation
+	seq := func(yield func(FileJob) bool) {
+		for {
+			pulled++
+			if !yield(FileJob{RemotePath: "/remote/file_0.bin", ID: "id"}) {
+				return
+			}
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	stats, err := PipelineCfg{SFTPReaders: 2, Workers: 1, BufferSize: 1}.TransferFilesSeq(ctx, client, seq, func(FileResult) error { return nil })
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if stats.Transferred == 0 || int(stats.Transferred) > pulled {
+		t.Errorf("transferred %d of %d pulled", stats.Transferred, pulled)
+	}
+}
+
+func TestLimit(t *testing.T) {
+	client := newFakeClient(map[string][]byte{"/remote/a.bin": []byte("a")})
+	jobs := make([]FileJob, 1000)
+	for i := range jobs {
+		jobs[i] = FileJob{RemotePath: "/remote/a.bin", ID: fmt.Sprintf("id_%d", i)}
+	}
+	cfg := DefaultCfg()
+	cfg.Limit = 10
+	var mu sync.Mutex
+	var last, total int
+	cfg.Progress = func(done, n int) {
+		mu.Lock()
+		last, total = done, n
+		mu.Unlock()
+	}
+
+	seen := map[string]bool{}
+	stats, err := cfg.TransferFilesStats(context.Background(), client, jobs, func(r FileResult) error {
+		mu.Lock()
+		seen[r.ID] = true
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := client.Opens("/remote/a.bin"); stats.Transferred != 10 || n != 10 {
+		t.Errorf("expected exactly 10 attempted, got %+v after %d opens", stats, n)
+	}
+	if last != 10 || total != 10 {
+		t.Errorf("expected progress against the limit, ended at %d of %d", last, total)
+	}
+	for i := 0; i < 10; i++ {
+		if !seen[jobs[i].ID] {
+			t.Errorf("expected the first 10 jobs, missing %s", jobs[i].ID)
+		}
+	}
+
+	// A channel source, and the streaming variants, stop after Limit too
+	cfg.Progress = nil
+	jobsChan := make(chan FileJob, len(jobs))
+	for _, job := range jobs {
+		jobsChan <- job
+	}
+	close(jobsChan)
+	stats, err = cfg.TransferFilesChan(context.Background(), client, jobsChan, func(FileResult) error { return nil })
+	if err != nil || stats.Transferred != 10 {
+		t.Errorf("TransferFilesChan: %+v, %v", stats, err)
+	}
+	if n := len(jobsChan); n != len(jobs)-10 {
+		t.Errorf("expected 10 jobs received from the channel, %d are left", n)
+	}
+	transferred, _ := cfg.TransferFilesStreaming(client, jobs, func(string, io.Reader) error { return nil })
+	if transferred != 10 {
+		t.Errorf("TransferFilesStreaming: %d transferred", transferred)
+	}
+}
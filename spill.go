@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+)
+
+// Reader returns a reader over the result's data, opening SpillPath if the
+// file was spilled to disk under SpillThreshold.
+func (r FileResult) Reader() (io.ReadCloser, error) {
+	if r.SpillPath != "" {
+		return os.Open(r.SpillPath)
+	}
+	return io.NopCloser(bytes.NewReader(r.Data)), nil
+}
+
+// size is the length of the result's data, in memory or spilled.
+func (r FileResult) size() int64 {
+	if r.SpillPath != "" {
+		return r.spillSize
+	}
+	return int64(len(r.Data))
+}
+
+// spillThreshold is SpillThreshold, except in batch runs, whose results
+// outlive the delivery that would remove their temp files.
+func (r *run) spillThreshold() int64 {
+	if r.batch != nil {
+		return 0
+	}
+	return r.cfg.SpillThreshold
+}
+
+// readData reads rd to the end into the result's Data, or, once more than
+// the spill threshold has come in, into a temp file in SpillDir. A spilled
+// result's ContentType is sniffed from the bytes read before it spilled.
+func (r *run) readData(rd io.Reader) (FileResult, error) {
+	threshold := r.spillThreshold()
+	if threshold <= 0 {
+		data, err := io.ReadAll(rd)
+		return FileResult{Data: data}, err
+	}
+	data, err := io.ReadAll(io.LimitReader(rd, threshold+1))
+	if err != nil || int64(len(data)) <= threshold {
+		return FileResult{Data: data}, err
+	}
+	f, err := os.CreateTemp(r.cfg.SpillDir, "sftp-spill-*")
+	if err != nil {
+		return FileResult{}, err
+	}
+	n, err := io.Copy(f, io.MultiReader(bytes.NewReader(data), rd))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return FileResult{}, err
+	}
+	return FileResult{SpillPath: f.Name(), spillSize: n, ContentType: r.contentType(data)}, nil
+}
+
+// unspill removes the temp file of a spilled result once every delivery of
+// it is done.
+func (r *run) unspill(result FileResult) {
+	if result.SpillPath == "" {
+		return
+	}
+	if err := os.Remove(result.SpillPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		r.cfg.logger().Printf("Failed to remove spill file %s: %v\n", result.SpillPath, err)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+func TestSpillThreshold(t *testing.T) {
+	large := bytes.Repeat([]byte("0123456789"), 100_000)
+	files := map[string][]byte{
+		"/remote/large.bin": large,
+		"/remote/small.bin": []byte("small"),
+	}
+	client := newFakeClient(files)
+	jobs := []FileJob{
+		{RemotePath: "/remote/large.bin", ID: "large"},
+		{RemotePath: "/remote/small.bin", ID: "small"},
+	}
+	cfg := DefaultCfg()
+	cfg.SpillThreshold = 1024
+	cfg.SpillDir = t.TempDir()
+
+	var mu sync.Mutex
+	spilled := map[string]string{}
+	processFunc := func(result FileResult) error {
+		rd, err := result.Reader()
+		if err != nil {
+			return err
+		}
+		defer rd.Close()
+		data, err := io.ReadAll(rd)
+		if err != nil {
+			return err
+		}
+		if want := files["/remote/"+result.ID+".bin"]; !bytes.Equal(data, want) {
+			t.Errorf("%s: read %d bytes, want %d", result.ID, len(data), len(want))
+		}
+		mu.Lock()
+		spilled[result.ID] = result.SpillPath
+		mu.Unlock()
+		if result.SpillPath != "" && result.Data != nil {
+			t.Errorf("%s: spilled result still holds its data", result.ID)
+		}
+		return nil
+	}
+	stats, err := cfg.TransferFilesStats(t.Context(), client, jobs, processFunc)
+	if err != nil || stats.Transferred != 2 {
+		t.Fatalf("expected 2 transfers, got %+v, %v", stats, err)
+	}
+	if stats.TotalBytes != int64(len(large)+len("small")) {
+		t.Errorf("expected spilled bytes to count, got %d", stats.TotalBytes)
+	}
+	if spilled["large"] == "" || spilled["small"] != "" {
+		t.Fatalf("expected only the large file to spill, got %v", spilled)
+	}
+	if _, err := os.Stat(spilled["large"]); !os.IsNotExist(err) {
+		t.Errorf("expected the spill file to be removed, got %v", err)
+	}
+	if entries, _ := os.ReadDir(cfg.SpillDir); len(entries) != 0 {
+		t.Errorf("expected SpillDir to be empty, got %v", entries)
+	}
+}
+
+func TestSpillCancelled(t *testing.T) {
+	for _, mode := range []string{"Ordered", "SizeAwareScheduling"} {
+		t.Run(mode, func(t *testing.T) {
+			client := sftptest.NewFakeClient()
+			data := bytes.Repeat([]byte("x"), 2048)
+			jobs := fileJobs(client, 32, sftptest.File{Data: data})
+			// Hold the first file back so the rest pile up
+			client.Add(jobs[0].RemotePath, sftptest.File{Data: data, OpenLatency: 20 * time.Millisecond})
+			cfg := DefaultCfg()
+			cfg.SFTPReaders, cfg.Workers, cfg.BufferSize = 4, 1, 8
+			cfg.SpillThreshold = 1024
+			cfg.SpillDir = t.TempDir()
+			cfg.Ordered = mode == "Ordered"
+			cfg.SizeAwareScheduling = mode == "SizeAwareScheduling"
+
+			ctx, cancel := context.WithCancel(t.Context())
+			defer cancel()
+			processFunc := func(FileResult) error {
+				time.Sleep(10 * time.Millisecond)
+				cancel()
+				return nil
+			}
+			if _, err := cfg.TransferFilesStats(ctx, client, jobs, processFunc); !errors.Is(err, context.Canceled) {
+				t.Fatalf("expected the run to be cancelled, got %v", err)
+			}
+			if entries, _ := os.ReadDir(cfg.SpillDir); len(entries) != 0 {
+				t.Errorf("expected SpillDir to be empty, got %d files", len(entries))
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import "fmt"
+
+// ProcessStage is one step of a Chain. It receives the result the previous
+// stage returned, or the file's own result for the first stage.
+type ProcessStage func(result FileResult) (FileResult, error)
+
+// Inspect turns a ProcessFunc, such as a validator or a sink, into a
+// ProcessStage that passes its result on unchanged.
+func Inspect(processFunc ProcessFunc) ProcessStage {
+	return func(result FileResult) (FileResult, error) {
+		return result, processFunc(result)
+	}
+}
+
+// StageError is the error of a file that failed at stage Index, counted from
+// 0, of a Chain.
+type StageError struct {
+	Index int
+	Err   error
+}
+
+func (e *StageError) Error() string {
+	return fmt.Sprintf("stage %d: %v", e.Index, e.Err)
+}
+
+func (e *StageError) Unwrap() error { return e.Err }
+
+// Chain returns a ProcessFunc that runs stages in order on each result,
+// stopping at the first error, which it returns as a *StageError. The
+// wrapped error still counts: a stage returning ErrSkip skips the file, and
+// one returning ErrRetryProcess reruns the whole chain.
+func Chain(stages ...ProcessStage) ProcessFunc {
+	return func(result FileResult) error {
+		for i, stage := range stages {
+			var err error
+			if result, err = stage(result); err != nil {
+				return &StageError{Index: i, Err: err}
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestChain(t *testing.T) {
+	client := newFakeClient(map[string][]byte{
+		"/remote/good.txt":  []byte("hello"),
+		"/remote/bad.txt":   []byte("hello!"),
+		"/remote/empty.txt": {},
+	})
+	jobs := []FileJob{
+		{RemotePath: "/remote/good.txt", ID: "good"},
+		{RemotePath: "/remote/bad.txt", ID: "bad"},
+		{RemotePath: "/remote/empty.txt", ID: "empty"},
+	}
+
+	upper := func(r FileResult) (FileResult, error) {
+		if len(r.Data) == 0 {
+			return r, errors.New("empty file")
+		}
+		r.Data = bytes.ToUpper(r.Data)
+		return r, nil
+	}
+	var mu sync.Mutex
+	var seen []string
+	validate := func(r FileResult) error {
+		mu.Lock()
+		seen = append(seen, string(r.Data))
+		mu.Unlock()
+		if bytes.Contains(r.Data, []byte("!")) {
+			return errors.New("punctuation")
+		}
+		return nil
+	}
+
+	transferred, errs := DefaultCfg().TransferFilesWithErrors(client, jobs, Chain(upper, Inspect(validate)))
+	if transferred != 1 || len(errs) != 2 {
+		t.Fatalf("expected 1 transfer and 2 failures, got %d, %v", transferred, errs)
+	}
+	stages := map[string]int{}
+	for _, e := range errs {
+		var se *StageError
+		if !errors.As(e, &se) || e.Stage != StageProcess {
+			t.Fatalf("expected a StageError at StageProcess, got %v", e)
+		}
+		stages[e.ID] = se.Index
+	}
+	if stages["empty"] != 0 || stages["bad"] != 1 {
+		t.Errorf("expected empty to fail stage 0 and bad stage 1, got %v", stages)
+	}
+	for _, data := range seen {
+		if data != strings.ToUpper(data) {
+			t.Errorf("stage two saw untransformed data %q", data)
+		}
+	}
+	if len(seen) != 2 {
+		t.Errorf("stage two should only see what stage one passed, got %v", seen)
+	}
+}
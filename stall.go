@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// defaultStallWindow is the StallWindow used when MinThroughputBytesPerSec is
+// set without one.
+const defaultStallWindow = 10 * time.Second
+
+// stallWatch counts the bytes read from a file and closes it if fewer than
+// MinThroughputBytesPerSec arrive over a StallWindow. A nil *stallWatch
+// never stalls.
+type stallWatch struct {
+	io.ReadCloser
+	n       atomic.Int64
+	stalled atomic.Bool
+	done    chan struct{}
+}
+
+func (w *stallWatch) Read(p []byte) (int, error) {
+	n, err := w.ReadCloser.Read(p)
+	w.n.Add(int64(n))
+	return n, err
+}
+
+// Seek seeks the watched file, failing with errors.ErrUnsupported if it
+// can't, so Resume and FileJob.Offset can still skip what they don't need.
+// Skipped bytes don't count toward the throughput.
+func (w *stallWatch) Seek(offset int64, whence int) (int64, error) {
+	s, ok := w.ReadCloser.(io.Seeker)
+	if !ok {
+		return 0, errors.ErrUnsupported
+	}
+	return s.Seek(offset, whence)
+}
+
+// stallWatchAt is a stallWatch of a file that also supports ReadAt, whose
+// bytes count the same way.
+type stallWatchAt struct {
+	*stallWatch
+	ra io.ReaderAt
+}
+
+func (w *stallWatchAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := w.ra.ReadAt(p, off)
+	w.n.Add(int64(n))
+	return n, err
+}
+
+// watchStall wraps f in a stallWatch when MinThroughputBytesPerSec is set.
+// The watch must be stopped once f has been read.
+func (r *run) watchStall(f io.ReadCloser) (io.ReadCloser, *stallWatch) {
+	if r.cfg.MinThroughputBytesPerSec <= 0 {
+		return f, nil
+	}
+	window := r.cfg.StallWindow
+	if window <= 0 {
+		window = defaultStallWindow
+	}
+	floor := int64(float64(r.cfg.MinThroughputBytesPerSec) * window.Seconds())
+	w := &stallWatch{ReadCloser: f, done: make(chan struct{})}
+	go func() {
+		t := time.NewTicker(window)
+		defer t.Stop()
+		var last int64
+		for {
+			select {
+			case <-w.done:
+				return
+			case <-t.C:
+			}
+			n := w.n.Load()
+			if n-last < floor {
+				w.stalled.Store(true)
+				w.ReadCloser.Close()
+				return
+			}
+			last = n
+		}
+	}()
+	if ra, ok := f.(io.ReaderAt); ok {
+		return &stallWatchAt{w, ra}, w
+	}
+	return w, w
+}
+
+// stop ends the watch.
+func (w *stallWatch) stop() {
+	if w != nil {
+		close(w.done)
+	}
+}
+
+// stallErr replaces err with ErrStalled when the watch closed the file.
+func (r *run) stallErr(w *stallWatch, err error) error {
+	if err != nil && w != nil && w.stalled.Load() {
+		return fmt.Errorf("%w (%d bytes/s): %v", ErrStalled, r.cfg.MinThroughputBytesPerSec, err)
+	}
+	return err
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+func TestMinThroughput(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	// 1 byte per 10ms is about 100 bytes/s, far below the floor.
+	client.Add("/remote/slow.bin", sftptest.File{Data: bytes.Repeat([]byte("x"), 1000), ReadLatency: 10 * time.Millisecond, MaxRead: 1})
+	client.AddData("/remote/fast.bin", bytes.Repeat([]byte("x"), 1000))
+	jobs := []FileJob{
+		{RemotePath: "/remote/slow.bin", ID: "slow"},
+		{RemotePath: "/remote/fast.bin", ID: "fast"},
+	}
+
+	cfg := DefaultCfg()
+	cfg.MinThroughputBytesPerSec = 1000
+	cfg.StallWindow = 50 * time.Millisecond
+	start := time.Now()
+	transferred, errs := cfg.TransferFilesWithErrors(client, jobs, func(FileResult) error { return nil })
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("the stalled file should be aborted quickly, took %s", elapsed)
+	}
+	if transferred != 1 {
+		t.Errorf("expected the fast file to transfer, got %d", transferred)
+	}
+	if len(errs) != 1 || errs[0].ID != "slow" || errs[0].Stage != StageRead {
+		t.Fatalf("expected slow to fail its read, got %v", errs)
+	}
+	if !errors.Is(errs[0], ErrStalled) || errs[0].Kind != KindStalledConnection {
+		t.Errorf("expected a stalled connection, got %v (kind %s)", errs[0], errs[0].Kind)
+	}
+}
+
+func TestMinThroughputOffset(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	client.Add("/remote/blob.bin", sftptest.File{Data: data, Seekable: true})
+	jobs := []FileJob{{RemotePath: "/remote/blob.bin", ID: "blob", Offset: 9000}}
+
+	cfg := DefaultCfg()
+	cfg.MinThroughputBytesPerSec = 1000
+	results, errs := cfg.CollectFiles(client, jobs)
+	if len(errs) != 0 || len(results) != 1 || !bytes.Equal(results[0].Data, data[9000:]) {
+		t.Fatalf("expected the last 1000 bytes, got %d results, %v", len(results), errs)
+	}
+	if n := client.Served("/remote/blob.bin"); n != 1000 {
+		t.Errorf("expected the offset to be seeked past, served %d bytes", n)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// TransferStats summarizes a run. TotalBytes counts the data of files that
+// were read successfully. DeadlineExceeded is set when PipelineCfg.Deadline
+// cut the run short. Concurrency is the number of readers the run ended
+// with, which only differs from SFTPReaders in Adaptive mode. In a DryRun
+// the counts and TotalBytes are what the run would have transferred.
+// Deduped counts the jobs that shared another job's read under Dedupe.
+// CircuitBreakerTripped is set when MaxFailures stopped the run.
+// ProcessTimeouts counts the failures, included in Failed, that ran over
+// ProcessTimeout. RemoveFailed and ArchiveFailed count the transferred files
+// that DeleteAfterTransfer couldn't remove or that couldn't be moved into
+// ArchiveDir. LatencyP50, LatencyP95 and LatencyP99 are percentiles of the
+// time transferred files took from the start of their read until they were
+// processed, estimated from a sample of up to 4096 of them.
+type TransferStats struct {
+	Transferred           int32
+	Failed                int32
+	Skipped               int32
+	TotalBytes            int64
+	Elapsed               time.Duration
+	BytesPerSec           float64
+	DeadlineExceeded      bool
+	Concurrency           int
+	DryRun                bool
+	Deduped               int32
+	CircuitBreakerTripped bool
+	ProcessTimeouts       int32
+	RemoveFailed          int32
+	ArchiveFailed         int32
+	LatencyP50            time.Duration
+	LatencyP95            time.Duration
+	LatencyP99            time.Duration
+}
+
+// TransferFilesStats is TransferFilesCtx returning a TransferStats instead of
+// bare counts.
+func (cfg PipelineCfg) TransferFilesStats(ctx context.Context, sftpClient SFTPClient, jobs []FileJob, processFunc ProcessFunc) (TransferStats, error) {
+	return cfg.transfer(ctx, []SFTPClient{sftpClient}, fromSlice(jobs), processFunc, hooks{})
+}
+
+// summary builds the stats of a finished run and logs them.
+func (r *run) summary(ctx context.Context, start time.Time) TransferStats {
+	stats := r.stats(time.Since(start))
+	stats.DeadlineExceeded = deadlineExceeded(ctx)
+	stats.Concurrency = r.concurrency()
+	stats.DryRun = r.cfg.DryRun
+	stats.Deduped = r.dedupe.count()
+	stats.CircuitBreakerTripped = errors.Is(r.failFast.cause(), ErrCircuitBreakerTripped)
+	r.cfg.logger().Printf("Transfer completed in %s. Success: %d, Failed: %d, Skipped: %d\n", stats.Elapsed, stats.Transferred, stats.Failed, stats.Skipped)
+	return stats
+}
+
+func (t *tally) stats(elapsed time.Duration) TransferStats {
+	s := TransferStats{
+		Transferred:     t.transferred.Load(),
+		Failed:          t.failed.Load(),
+		Skipped:         t.skipped.Load(),
+		ProcessTimeouts: t.processTimeouts.Load(),
+		RemoveFailed:    t.removeFailed.Load(),
+		ArchiveFailed:   t.archiveFailed.Load(),
+		TotalBytes:      t.bytes.Load(),
+		Elapsed:         elapsed,
+	}
+	if elapsed > 0 {
+		s.BytesPerSec = float64(s.TotalBytes) / elapsed.Seconds()
+	}
+	s.LatencyP50, s.LatencyP95, s.LatencyP99 = t.latency.percentiles()
+	return s
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Seek seeks the underlying reader, failing with errors.ErrUnsupported if it
+// can't. Only Read counts bytes, so skipped data isn't counted.
+func (c *countingReader) Seek(offset int64, whence int) (int64, error) {
+	s, ok := c.r.(io.Seeker)
+	if !ok {
+		return 0, errors.ErrUnsupported
+	}
+	return s.Seek(offset, whence)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+func TestTransferFilesStats(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	var jobs []FileJob
+	for i := 1; i <= 10; i++ {
+		path := fmt.Sprintf("/remote/file_%d.bin", i)
+		client.AddData(path, bytes.Repeat([]byte("x"), i*100))
+		jobs = append(jobs, FileJob{RemotePath: path, ID: fmt.Sprintf("id_%d", i)})
+	}
+	jobs = append(jobs, FileJob{RemotePath: "/remote/missing.bin", ID: "missing"})
+
+	processFunc := func(result FileResult) error {
+		if result.ID == "id_10" {
+			return errors.New("rejected")
+		}
+		return nil
+	}
+	stats, err := DefaultCfg().TransferFilesStats(context.Background(), client, jobs, processFunc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Transferred != 9 || stats.Failed != 2 {
+		t.Errorf("expected 9 transferred and 2 failed, got %d and %d", stats.Transferred, stats.Failed)
+	}
+	// Every file that was read counts, including one processFunc rejected
+	if stats.TotalBytes != 5500 {
+		t.Errorf("TotalBytes = %d, want 5500", stats.TotalBytes)
+	}
+	if stats.Elapsed <= 0 || stats.BytesPerSec <= 0 {
+		t.Errorf("expected positive timing, got %s and %f B/s", stats.Elapsed, stats.BytesPerSec)
+	}
+}
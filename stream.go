@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// StreamProcessFunc consumes a remote file as it is read. r is only valid
+// until the function returns.
+type StreamProcessFunc func(id string, r io.Reader) error
+
+// streamFunc consumes an open remote file for job.
+type streamFunc func(job FileJob, r io.Reader) error
+
+// prepareFunc readies a job before its file is opened, returning the
+// streamFunc to consume it with, or ErrSkip if the job should be skipped.
+type prepareFunc func(job FileJob) (streamFunc, error)
+
+// TransferFilesStreaming hands each open remote file to processFunc instead of
+// reading it into memory first. Reading and processing happen in the same
+// goroutine, so SFTPReaders is the only parallelism knob: Workers and
+// BufferSize are unused, and a slow processFunc holds its reader (and SFTP
+// request) for as long as it runs.
+func (cfg PipelineCfg) TransferFilesStreaming(sftpClient SFTPClient, jobs []FileJob, processFunc StreamProcessFunc) (transferred int32, failed int32) {
+	stats, _ := cfg.stream(context.Background(), sftpClient, fromSlice(jobs), nil, func(job FileJob, r io.Reader) error {
+		return processFunc(job.ID, r)
+	}, nil)
+	return stats.Transferred, stats.Failed
+}
+
+// stream runs a single-stage pipeline: each reader opens a file and hands it
+// straight to handle, so nothing is buffered in memory between stages. Only
+// the Open is retried since handle may have consumed part of the stream.
+// Ordered has no effect here. If prepare is non-nil it runs first for each
+// job, and the streamFunc it returns takes the place of handle; an error from
+// it fails the job at StageStat.
+func (cfg PipelineCfg) stream(ctx context.Context, client SFTPClient, jobs source[FileJob], prepare prepareFunc, handle streamFunc, onError func(TransferError)) (TransferStats, error) {
+	if err := cfg.preflight([]SFTPClient{client}); err != nil {
+		return TransferStats{}, err
+	}
+	jobs, err := cfg.shuffle(limit(jobs, cfg.Limit))
+	if err == nil {
+		err = cfg.checkGroupByDir(jobs)
+	}
+	if err != nil {
+		return TransferStats{}, err
+	}
+	start := time.Now()
+	ctx, cancel := cfg.deadlineContext(ctx)
+	defer cancel()
+	r := cfg.newRun([]SFTPClient{client}, jobs.total, onError)
+	r.dedupe, _ = cfg.newDedupe(ctx, jobs, false)
+	if r.checkpoint, err = cfg.newCheckpoint(); err != nil {
+		return TransferStats{}, err
+	}
+	defer r.closeCheckpoint()
+	startCtx, stopStarting := r.startContext(ctx)
+	defer stopStarting()
+	stopAdapting := r.adapt(ctx)
+	stopReporting := r.reportProgress(start)
+	stopStatus := r.reportStatus(start)
+	var readWg sync.WaitGroup
+	feed := r.feedReaders(startCtx, &readWg, jobs, nil, func(client SFTPClient, q queued[FileJob]) bool {
+		if startCtx.Err() != nil || !r.gate.acquire(startCtx) {
+			return false
+		}
+		if !r.target.claim() {
+			r.gate.release()
+			return false
+		}
+		r.started(q.job)
+		read := fileRead{index: q.index, job: q.job, start: time.Now(), client: client}
+		fileCtx, span := r.startFileSpan(ctx, q.job)
+		read.size, read.stage, read.err = r.streamJob(fileCtx, client, q, prepare, handle)
+		endSpan(span, read.err)
+		r.gate.release()
+		if read.err == nil || ctx.Err() == nil {
+			r.finish(q.job, read.stage, read.err)
+			if read.err == nil {
+				r.dispose(read)
+			}
+			r.completed(read, read.err)
+		}
+		r.target.release(read.err == nil)
+		return true
+	})
+	readWg.Wait()
+	<-feed.done
+
+	stopAdapting()
+	stopReporting()
+	stopStatus()
+	stats := r.summary(ctx, start)
+
+	return stats, r.runErr(ctx, feed.finished(stats))
+}
+
+// streamJob runs one job of a streaming run and returns the bytes streamed
+// and the stage and error it ended with. Jobs that aren't streamed, such as
+// duplicates and files the prepare hook skips, end with ErrSkip.
+func (r *run) streamJob(ctx context.Context, client SFTPClient, q queued[FileJob], prepare prepareFunc, handle streamFunc) (int64, Stage, error) {
+	if err := r.checkpoint.skip(q.job); err != nil {
+		return 0, StageOpen, err
+	}
+	if err := r.dedupe.duplicate(q); err != nil {
+		return 0, StageOpen, err
+	}
+	if err := r.checkStat(client, q.job); err != nil {
+		return 0, StageStat, err
+	}
+	if prepare != nil {
+		h, err := prepare(q.job)
+		if err != nil {
+			return 0, StageStat, err
+		}
+		handle = h
+	}
+	if r.cfg.DryRun {
+		size, err := r.plan(client, q.job)
+		r.bytes.Add(size)
+		return size, StageStat, err
+	}
+	return r.streamFile(ctx, client, q.job, handle)
+}
+
+// streamFile opens job's file and runs handle on it, closing the file when
+// handle returns, ctx is cancelled or PerFileTimeout expires.
+func (r *run) streamFile(ctx context.Context, client SFTPClient, job FileJob, handle streamFunc) (int64, Stage, error) {
+	fileCtx, cancel := r.fileContext(ctx)
+	defer cancel()
+
+	f, err := r.openWithRetry(fileCtx, client, job.RemotePath)
+	if err != nil {
+		return 0, StageOpen, r.timeoutErr(ctx, fileCtx, err)
+	}
+	stop := context.AfterFunc(fileCtx, func() { f.Close() })
+	_, span := r.tracer.Start(fileCtx, "sftp.process")
+	part, err := section(job, f)
+	if err != nil {
+		stop()
+		f.Close()
+		return 0, StageRead, r.timeoutErr(ctx, fileCtx, err)
+	}
+	counted := &countingReader{r: r.head(part)}
+	var body io.Reader = counted
+	if r.cfg.SniffContentType {
+		body = newSniffedReader(counted)
+	}
+	err = r.protect(describe(job), func() error { return handle(job, body) })
+	if stop() {
+		f.Close()
+	}
+	span.SetAttributes(attrBytes.Int64(counted.n))
+	trace.SpanFromContext(ctx).SetAttributes(attrBytes.Int64(counted.n))
+	endSpan(span, r.timeoutErr(ctx, fileCtx, err))
+	if err == nil {
+		r.bytes.Add(counted.n)
+	}
+	return counted.n, StageProcess, r.timeoutErr(ctx, fileCtx, err)
+}
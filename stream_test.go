@@ -0,0 +1,48 @@
+package main
+
+import (
+	"io"
+	"sync"
+	"testing"
+)
+
+func TestStreamKeepsFileOpenUntilProcessed(t *testing.T) {
+	client := newFakeClient(map[string][]byte{
+		"/remote/a.bin": []byte("alpha"),
+		"/remote/b.bin": []byte("beta"),
+	})
+	jobs := []FileJob{
+		{RemotePath: "/remote/a.bin", ID: "a"},
+		{RemotePath: "/remote/b.bin", ID: "b"},
+		{RemotePath: "/remote/missing.bin", ID: "missing"},
+	}
+
+	var mu sync.Mutex
+	got := map[string]string{}
+	processFunc := func(id string, r io.Reader) error {
+		if client.Closes("/remote/"+id+".bin") != 0 {
+			t.Errorf("%s closed before processing", id)
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		got[id] = string(data)
+		mu.Unlock()
+		return nil
+	}
+
+	transferred, failed := DefaultCfg().TransferFilesStreaming(client, jobs, processFunc)
+	if transferred != 2 || failed != 1 {
+		t.Fatalf("expected 2 transferred and 1 failed, got %d and %d", transferred, failed)
+	}
+	if got["a"] != "alpha" || got["b"] != "beta" {
+		t.Errorf("unexpected streamed content: %v", got)
+	}
+	for _, path := range []string{"/remote/a.bin", "/remote/b.bin"} {
+		if client.Closes(path) != 1 {
+			t.Errorf("%s was not closed", path)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"time"
+)
+
+// TransferFilesToTar reads jobs in parallel and writes every file transferred
+// to w as an entry of one tar archive, named by its ID. Entries are written
+// one at a time by a single worker, as files finish reading, or in input
+// order when Ordered is set. A write error fails the files after it and is
+// returned.
+func (cfg PipelineCfg) TransferFilesToTar(ctx context.Context, sftpClient SFTPClient, jobs []FileJob, w io.Writer) (TransferStats, error) {
+	tw := tar.NewWriter(w)
+	return cfg.archive(ctx, sftpClient, jobs, func(name string, data []byte) error {
+		err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     0o644,
+			Size:     int64(len(data)),
+			ModTime:  time.Now(),
+		})
+		if err == nil {
+			_, err = tw.Write(data)
+		}
+		return err
+	}, tw.Close)
+}
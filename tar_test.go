@@ -0,0 +1,109 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+// readTar returns the entries of a tar archive in order, with their data.
+func readTar(t *testing.T, archive []byte) ([]string, map[string][]byte) {
+	t.Helper()
+	var names []string
+	data := map[string][]byte{}
+	tr := tar.NewReader(bytes.NewReader(archive))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return names, data
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int64(len(b)) != hdr.Size {
+			t.Errorf("%s: header size %d, read %d", hdr.Name, hdr.Size, len(b))
+		}
+		names = append(names, hdr.Name)
+		data[hdr.Name] = b
+	}
+}
+
+func TestTransferFilesToTar(t *testing.T) {
+	files := map[string][]byte{}
+	var jobs []FileJob
+	for i := 0; i < 30; i++ {
+		path := fmt.Sprintf("/remote/file_%d.bin", i)
+		files[path] = bytes.Repeat([]byte{byte('a' + i%26)}, 100*i)
+		jobs = append(jobs, FileJob{RemotePath: path, ID: fmt.Sprintf("dir/file_%d.bin", i)})
+	}
+	client := newFakeClient(files)
+	jobs = append(jobs,
+		FileJob{RemotePath: "/remote/missing.bin", ID: "missing.bin"},
+		FileJob{RemotePath: "/remote/file_0.bin", ID: "../escape.bin"},
+	)
+
+	for _, ordered := range []bool{false, true} {
+		t.Run(fmt.Sprintf("ordered=%v", ordered), func(t *testing.T) {
+			var buf bytes.Buffer
+			cfg := DefaultCfg()
+			cfg.Ordered = ordered
+			// Both are ignored: a timed-out add would overlap the next one,
+			// and the entries would hold gzip data
+			cfg.ProcessTimeout, cfg.CompressResults = time.Nanosecond, true
+			stats, err := cfg.TransferFilesToTar(context.Background(), client, jobs, &buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.Transferred != 30 || stats.Failed != 2 {
+				t.Fatalf("expected 30 transferred and 2 failed, got %+v", stats)
+			}
+
+			names, data := readTar(t, buf.Bytes())
+			if len(names) != 30 {
+				t.Fatalf("expected 30 entries, got %d", len(names))
+			}
+			for i, job := range jobs[:30] {
+				if !bytes.Equal(data[job.ID], files[job.RemotePath]) {
+					t.Errorf("%s: content mismatch", job.ID)
+				}
+				if ordered && names[i] != job.ID {
+					t.Errorf("entry %d is %s, want %s", i, names[i], job.ID)
+				}
+			}
+		})
+	}
+}
+
+// failingWriter fails every write after the first n bytes.
+type failingWriter struct{ n int }
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		return 0, errors.New("disk full")
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func TestTransferFilesToTarWriteError(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	jobs := fileJobs(client, 10, slowFile)
+	stats, err := DefaultCfg().TransferFilesToTar(context.Background(), client, jobs, &failingWriter{n: 2048})
+	if err == nil || err.Error() != "disk full" {
+		t.Fatalf("expected the write error, got %v", err)
+	}
+	if stats.Transferred+stats.Failed != 10 || stats.Failed == 0 {
+		t.Errorf("expected the files after the failure to fail, got %+v", stats)
+	}
+}
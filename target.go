@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// target stops a run once StopAfterSuccesses jobs have succeeded. Each
+// success needs a claim taken before its result is processed, and no more
+// claims are handed out than could still be needed, so the run ends with
+// exactly that many successes. A nil *target never stops a run.
+type target struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	n      int
+	done   int
+	active int
+	stop   context.CancelFunc
+}
+
+// newTarget returns nil unless cfg.StopAfterSuccesses is set.
+func (cfg PipelineCfg) newTarget() *target {
+	if cfg.StopAfterSuccesses <= 0 {
+		return nil
+	}
+	t := &target{n: cfg.StopAfterSuccesses}
+	t.cond = sync.NewCond(&t.mu)
+	return t
+}
+
+// bind sets the function that stops new jobs from starting.
+func (t *target) bind(stop context.CancelFunc) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stop = stop
+}
+
+// claim waits until a job may try to succeed: while the claims out could
+// already reach the target, it waits for one to be released. It returns
+// false once the target has been reached.
+func (t *target) claim() bool {
+	if t == nil {
+		return true
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for t.done < t.n && t.done+t.active >= t.n {
+		t.cond.Wait()
+	}
+	if t.done >= t.n {
+		return false
+	}
+	t.active++
+	return true
+}
+
+// release returns a claim, counting a success if ok, and stops the run once
+// the target is reached.
+func (t *target) release(ok bool) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.active--
+	if ok {
+		t.done++
+	}
+	if t.done >= t.n && t.stop != nil {
+		t.stop()
+	}
+	t.cond.Broadcast()
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+func TestStopAfterSuccesses(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	jobs := fileJobs(client, 100, dataFile)
+	// Every third file is missing and fails to open
+	for i := 0; i < len(jobs); i += 3 {
+		client.Delete(jobs[i].RemotePath)
+	}
+	cfg := PipelineCfg{SFTPReaders: 8, Workers: 4, BufferSize: 4, StopAfterSuccesses: 5}
+
+	var calls, good atomic.Int32
+	stats, err := cfg.TransferFilesStats(context.Background(), client, jobs, func(r FileResult) error {
+		// Processing fails every other file it sees
+		if calls.Add(1)%2 == 0 {
+			return errors.New("invalid")
+		}
+		good.Add(1)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Transferred != 5 || good.Load() != 5 {
+		t.Errorf("expected exactly 5 successes, got %+v with %d good results", stats, good.Load())
+	}
+	if stats.Failed == 0 || int(stats.Transferred+stats.Failed) == len(jobs) {
+		t.Errorf("expected failures not to count towards the target and the run to stop early, got %+v", stats)
+	}
+
+	var streamed atomic.Int32
+	transferred, _ := cfg.TransferFilesStreaming(client, jobs, func(string, io.Reader) error {
+		streamed.Add(1)
+		return nil
+	})
+	if transferred != 5 || streamed.Load() != 5 {
+		t.Errorf("streaming: expected exactly 5 successes, got %d of %d streamed", transferred, streamed.Load())
+	}
+}
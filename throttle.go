@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket shared by every reader of a run. Callers take
+// tokens after the fact and may push the bucket into debt, which later callers
+// wait out, so the aggregate rate holds however reads are sized.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns nil for a non-positive rate; a nil *rateLimiter
+// never blocks.
+func newRateLimiter(perSec int64) *rateLimiter {
+	if perSec <= 0 {
+		return nil
+	}
+	return &rateLimiter{
+		rate:   float64(perSec),
+		burst:  float64(perSec),
+		tokens: float64(perSec),
+		last:   time.Now(),
+	}
+}
+
+// take spends n tokens and returns how long the caller must wait for the
+// bucket to recover.
+func (l *rateLimiter) take(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// wait takes n tokens, blocking until they are available or ctx is done.
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+	if !sleepCtx(ctx, l.take(n)) {
+		return ctx.Err()
+	}
+	return nil
+}
+
+// wrap returns f with reads throttled by l.
+func (l *rateLimiter) wrap(ctx context.Context, f io.ReadCloser) io.ReadCloser {
+	if l == nil {
+		return f
+	}
+	lr := &limitedReader{ReadCloser: f, ctx: ctx, limiter: l}
+	if ra, ok := f.(io.ReaderAt); ok {
+		return &limitedReaderAt{lr, ra}
+	}
+	return lr
+}
+
+// limitedReaderAt is a limitedReader of a file that also supports ReadAt,
+// which is throttled the same way.
+type limitedReaderAt struct {
+	*limitedReader
+	ra io.ReaderAt
+}
+
+func (r *limitedReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.ra.ReadAt(p, off)
+	if werr := r.limiter.wait(r.ctx, n); werr != nil && err == nil {
+		err = werr
+	}
+	return n, err
+}
+
+type limitedReader struct {
+	io.ReadCloser
+	ctx     context.Context
+	limiter *rateLimiter
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if werr := r.limiter.wait(r.ctx, n); werr != nil && err == nil {
+		err = werr
+	}
+	return n, err
+}
+
+// Seek seeks the underlying file, failing with errors.ErrUnsupported if it
+// can't, so Resume and FileJob.Offset can still skip what they don't need.
+// Only the bytes read are throttled.
+func (r *limitedReader) Seek(offset int64, whence int) (int64, error) {
+	s, ok := r.ReadCloser.(io.Seeker)
+	if !ok {
+		return 0, errors.ErrUnsupported
+	}
+	return s.Seek(offset, whence)
+}
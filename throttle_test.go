@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+func TestMaxBytesPerSecIsGlobal(t *testing.T) {
+	const (
+		numFiles = 20
+		fileSize = 10 * 1024
+		limit    = 100 * 1024
+	)
+	client := sftptest.NewFakeClient()
+	jobs := fileJobs(client, numFiles, sftptest.File{Data: bytes.Repeat([]byte("x"), fileSize)})
+
+	// 200KB at 100KB/s with a one second burst takes at least a second, no
+	// matter how many readers share the budget
+	cfg := DefaultCfg()
+	cfg.MaxBytesPerSec = limit
+	start := time.Now()
+	transferred, failed := cfg.TransferFiles(client, jobs, func(FileResult) error { return nil })
+	elapsed := time.Since(start)
+
+	if transferred != numFiles || failed != 0 {
+		t.Fatalf("expected %d transfers, got %d (failed %d)", numFiles, transferred, failed)
+	}
+	total := numFiles * fileSize
+	if want := time.Duration(float64(total-limit) / limit * float64(time.Second)); elapsed < want {
+		t.Errorf("transfer of %d bytes took %s, expected at least %s", total, elapsed, want)
+	}
+}
+
+func TestRateLimiterWithoutLimit(t *testing.T) {
+	l := newRateLimiter(0)
+	if err := l.wait(context.Background(), 1<<30); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMaxOpensPerSec(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	jobs := fileJobs(client, 30, slowFile)
+	// Empty files that read at once, so the opens set the pace
+	for _, job := range jobs {
+		client.AddData(job.RemotePath, nil)
+	}
+
+	// 30 opens at 10 a second with a one second burst take at least two
+	// seconds, with bandwidth limited too
+	cfg := DefaultCfg()
+	cfg.MaxOpensPerSec = 10
+	cfg.MaxBytesPerSec = 1 << 20
+	start := time.Now()
+	transferred, _ := cfg.TransferFiles(client, jobs, func(FileResult) error { return nil })
+	elapsed := time.Since(start)
+
+	if transferred != 30 {
+		t.Fatalf("expected 30 transfers, got %d", transferred)
+	}
+	if opens := opened(client, jobs); opens != 30 {
+		t.Errorf("expected 30 opens, got %d", opens)
+	}
+	if want := 1900 * time.Millisecond; elapsed < want {
+		t.Errorf("30 opens took %s, expected at least %s", elapsed, want)
+	}
+	if elapsed > 4*time.Second {
+		t.Errorf("30 opens took %s, far longer than the limit requires", elapsed)
+	}
+}
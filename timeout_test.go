@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+func TestPerFileTimeoutFreesReader(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	client.Add("/remote/hang.bin", hangingFile)
+	jobs := append([]FileJob{{RemotePath: "/remote/hang.bin", ID: "hang"}}, fileJobs(client, 50, dataFile)...)
+
+	before := runtime.NumGoroutine()
+	// A single reader: if the hung file kept it, nothing else would finish
+	cfg := PipelineCfg{SFTPReaders: 1, Workers: 2, BufferSize: 2, PerFileTimeout: 50 * time.Millisecond}
+	transferred, errs := cfg.TransferFilesWithErrors(client, jobs, func(FileResult) error { return nil })
+
+	if transferred != 50 {
+		t.Errorf("expected 50 transfers, got %d", transferred)
+	}
+	if len(errs) != 1 || errs[0].ID != "hang" || !errors.Is(errs[0], ErrFileTimeout) {
+		t.Fatalf("expected hang to fail with ErrFileTimeout, got %v", errs)
+	}
+
+	// Timers and AfterFuncs for files that finished quickly must not linger
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("goroutines leaked: %d before, %d after", before, after)
+	}
+}
+
+// blockingOpenClient's Open blocks until release is closed.
+type blockingOpenClient struct {
+	*sftptest.FakeClient
+	release chan struct{}
+}
+
+func (c *blockingOpenClient) Open(path string) (io.ReadCloser, error) {
+	<-c.release
+	return c.FakeClient.Open(path)
+}
+
+func TestPerFileTimeoutAbandonsHungOpen(t *testing.T) {
+	client := &blockingOpenClient{
+		FakeClient: newFakeClient(map[string][]byte{"/remote/a.bin": []byte("a")}),
+		release:    make(chan struct{}),
+	}
+	defer close(client.release)
+
+	cfg := PipelineCfg{SFTPReaders: 1, Workers: 1, BufferSize: 1, PerFileTimeout: 20 * time.Millisecond}
+	transferred, errs := cfg.TransferFilesWithErrors(client, []FileJob{{RemotePath: "/remote/a.bin", ID: "a"}}, func(FileResult) error { return nil })
+	if transferred != 0 || len(errs) != 1 || errs[0].Stage != StageOpen || !errors.Is(errs[0], ErrFileTimeout) {
+		t.Fatalf("expected an open timeout, got transferred=%d errs=%v", transferred, errs)
+	}
+}
+
+func TestProcessTimeout(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	jobs := fileJobs(client, 20, dataFile)
+
+	release := make(chan struct{})
+	defer close(release)
+	// A single worker: if the stuck call kept it, nothing else would finish
+	cfg := PipelineCfg{SFTPReaders: 2, Workers: 1, BufferSize: 2, ProcessTimeout: 50 * time.Millisecond}
+	var list errorList
+	stats, err := cfg.transfer(context.Background(), []SFTPClient{client}, fromSlice(jobs), func(result FileResult) error {
+		if result.ID == "id_3" {
+			<-release
+		}
+		return nil
+	}, hooks{onError: list.add})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Transferred != 19 || stats.Failed != 1 || stats.ProcessTimeouts != 1 {
+		t.Fatalf("expected id_3 alone to time out, got %+v", stats)
+	}
+	if len(list.errs) != 1 || list.errs[0].ID != "id_3" || list.errs[0].Kind != KindProcessTimeout || !errors.Is(list.errs[0], ErrProcessTimeout) {
+		t.Errorf("expected a process timeout for id_3, got %v", list.errs)
+	}
+}
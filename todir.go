@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// TransferFilesToDir streams each remote file into filepath.Join(destDir,
+// job.ID), under PreservePaths into destDir mirroring job.RemotePath, or
+// under NameFunc to the name it gives, without holding it in memory. Data is
+// written to a ".tmp" file that is renamed into place on success and removed
+// on failure. skipped counts jobs left alone by SkipExisting. Under Resume a
+// failed download is picked up where it stopped on the next call. destDir
+// and any subdirectories a file's name needs are created.
+func (cfg PipelineCfg) TransferFilesToDir(sftpClient SFTPClient, jobs []FileJob, destDir string) (transferred int32, failed int32, skipped int32) {
+	// Each destination is named once, and checked before its file is
+	// opened
+	prepare := func(job FileJob) (streamFunc, error) {
+		dest, err := cfg.localPath(destDir, job)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.SkipExisting {
+			exists, err := existsWithSameSize(sftpClient, job.RemotePath, dest)
+			if err != nil {
+				return nil, err
+			}
+			if exists {
+				return nil, ErrSkip
+			}
+		}
+		return func(job FileJob, r io.Reader) error {
+			// A name with several components, such as a JobsFromDir ID,
+			// gets its subdirectories
+			if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+				return err
+			}
+			attrs := func(path string) error {
+				return cfg.preserveAttrs(sftpClient, job.RemotePath, path)
+			}
+			if cfg.Resume {
+				return resumeFile(dest, r, cfg.Fsync, attrs)
+			}
+			return writeFile(dest, r, cfg.Fsync, attrs)
+		}, nil
+	}
+	stats, _ := cfg.stream(context.Background(), sftpClient, fromSlice(jobs), prepare, nil, nil)
+	return stats.Transferred, stats.Failed, stats.Skipped
+}
+
+// localPath is where job is written under destDir: its ID, under
+// PreservePaths its RemotePath, or the name NameFunc gives it, joined by
+// SafeJoin.
+func (cfg PipelineCfg) localPath(destDir string, job FileJob) (string, error) {
+	switch {
+	case cfg.NameFunc != nil:
+		return SafeJoin(destDir, cfg.NameFunc(job))
+	case cfg.PreservePaths:
+		return SafeJoin(destDir, strings.TrimLeft(job.RemotePath, "/"))
+	}
+	return SafeJoin(destDir, job.ID)
+}
+
+// existsWithSameSize reports whether local already holds a file the size of
+// remotePath. Sizes that differ mean the local copy is stale or partial.
+func existsWithSameSize(client SFTPClient, remotePath, local string) (bool, error) {
+	localInfo, err := os.Stat(local)
+	if err != nil {
+		return false, nil
+	}
+	remoteInfo, err := statRemote(client, remotePath)
+	if err != nil {
+		return false, err
+	}
+	return localInfo.Mode().IsRegular() && localInfo.Size() == remoteInfo.Size(), nil
+}
+
+// writeFile copies r to dest via a temporary file so dest only ever holds a
+// complete download, syncing it before the rename, and its directory after,
+// under fsync. attrs, if non-nil, is applied to the temporary file once it
+// is written.
+func writeFile(dest string, r io.Reader, fsync bool, attrs func(string) error) (err error) {
+	tmp := dest + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(tmp)
+		}
+	}()
+
+	if _, err = io.Copy(f, r); err == nil && attrs != nil {
+		err = attrs(tmp)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if err = closeFile(f, fsync); err != nil {
+		return err
+	}
+	return renameFile(tmp, dest, fsync)
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MYK12397/sftp-go/sftptest"
+)
+
+func TestTransferFilesToDir(t *testing.T) {
+	dest := t.TempDir()
+	files := map[string][]byte{
+		"/remote/a.bin": bytes.Repeat([]byte("a"), 64*1024),
+		"/remote/b.bin": []byte("b"),
+	}
+	client := newFakeClient(files)
+	client.Add("/remote/broken.bin", sftptest.File{Data: []byte("partial"), ReadErr: errors.New("connection reset"), FailAfter: 7})
+	jobs := []FileJob{
+		{RemotePath: "/remote/a.bin", ID: "a"},
+		{RemotePath: "/remote/b.bin", ID: "b"},
+		{RemotePath: "/remote/broken.bin", ID: "broken"},
+		{RemotePath: "/remote/missing.bin", ID: "missing"},
+	}
+
+	transferred, failed, _ := DefaultCfg().TransferFilesToDir(client, jobs, dest)
+	if transferred != 2 || failed != 2 {
+		t.Fatalf("expected 2 transferred and 2 failed, got %d and %d", transferred, failed)
+	}
+
+	for _, id := range []string{"a", "b"} {
+		got, err := os.ReadFile(filepath.Join(dest, id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := files["/remote/"+id+".bin"]; !bytes.Equal(got, want) {
+			t.Errorf("%s: content mismatch", id)
+		}
+	}
+
+	entries, err := os.ReadDir(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Errorf("expected only the two completed files, found %v", names)
+	}
+}
+
+func TestTransferFilesToDirSkipExisting(t *testing.T) {
+	dest := t.TempDir()
+	client := newFakeClient(map[string][]byte{
+		"/remote/same.bin":  []byte("remote"),
+		"/remote/stale.bin": []byte("remote"),
+		"/remote/new.bin":   []byte("remote"),
+	})
+	// same.bin matches the remote size and must be left untouched; stale.bin
+	// differs and must be replaced
+	if err := os.WriteFile(filepath.Join(dest, "same"), []byte("local!"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dest, "stale"), []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	jobs := []FileJob{
+		{RemotePath: "/remote/same.bin", ID: "same"},
+		{RemotePath: "/remote/stale.bin", ID: "stale"},
+		{RemotePath: "/remote/new.bin", ID: "new"},
+	}
+
+	cfg := DefaultCfg()
+	cfg.SkipExisting = true
+	transferred, failed, skipped := cfg.TransferFilesToDir(client, jobs, dest)
+	if transferred != 2 || failed != 0 || skipped != 1 {
+		t.Fatalf("expected 2 transferred, 0 failed, 1 skipped; got %d, %d, %d", transferred, failed, skipped)
+	}
+	for id, want := range map[string]string{"same": "local!", "stale": "remote", "new": "remote"} {
+		got, err := os.ReadFile(filepath.Join(dest, id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s = %q, want %q", id, got, want)
+		}
+	}
+}
+
+func TestTransferFilesToDirPreservePaths(t *testing.T) {
+	root := t.TempDir()
+	dest := filepath.Join(root, "dest")
+	files := map[string][]byte{
+		"/exports/2024/01/a.csv": []byte("a"),
+		"/exports/2024/02/b.csv": []byte("b"),
+		"/top.csv":               []byte("top"),
+		"../escape.csv":          []byte("evil"),
+		"/exports/../../x.csv":   []byte("evil"),
+	}
+	client := newFakeClient(files)
+	jobs := []FileJob{
+		{RemotePath: "/exports/2024/01/a.csv", ID: "a"},
+		{RemotePath: "/exports/2024/02/b.csv", ID: "b"},
+		{RemotePath: "/top.csv", ID: "top"},
+		{RemotePath: "../escape.csv", ID: "escape"},
+		{RemotePath: "/exports/../../x.csv", ID: "x"},
+	}
+
+	cfg := DefaultCfg()
+	cfg.PreservePaths = true
+	transferred, failed, _ := cfg.TransferFilesToDir(client, jobs, dest)
+	if transferred != 3 || failed != 2 {
+		t.Fatalf("expected 3 transferred and 2 failed, got %d and %d", transferred, failed)
+	}
+	for remote, local := range map[string]string{
+		"/exports/2024/01/a.csv": "exports/2024/01/a.csv",
+		"/exports/2024/02/b.csv": "exports/2024/02/b.csv",
+		"/top.csv":               "top.csv",
+	} {
+		got, err := os.ReadFile(filepath.Join(dest, filepath.FromSlash(local)))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if !bytes.Equal(got, files[remote]) {
+			t.Errorf("%s: content mismatch", local)
+		}
+	}
+	for _, name := range []string{"escape.csv", "x.csv"} {
+		if _, err := os.Stat(filepath.Join(root, name)); err == nil {
+			t.Errorf("%s was written outside the destination", name)
+		}
+	}
+	if _, err := cfg.localPath(dest, jobs[3]); !errors.Is(err, ErrUnsafePath) {
+		t.Errorf("expected ErrUnsafePath, got %v", err)
+	}
+}
+
+func TestTransferFilesToDirUnsafeID(t *testing.T) {
+	root := t.TempDir()
+	dest := filepath.Join(root, "dest")
+	client := newFakeClient(map[string][]byte{"/remote/a.bin": []byte("evil")})
+	jobs := []FileJob{
+		{RemotePath: "/remote/a.bin", ID: "../a.bin"},
+		{RemotePath: "/remote/a.bin", ID: filepath.Join(root, "abs.bin")},
+		{RemotePath: "/remote/a.bin", ID: `..\win.bin`},
+	}
+
+	transferred, failed, _ := DefaultCfg().TransferFilesToDir(client, jobs, dest)
+	if transferred != 0 || failed != 3 {
+		t.Fatalf("expected all 3 to fail, got %d transferred and %d failed", transferred, failed)
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		t.Errorf("unexpected %s written outside the destination", e.Name())
+	}
+}
+
+func TestTransferFilesToDirNameFunc(t *testing.T) {
+	dest := t.TempDir()
+	files := map[string][]byte{
+		"/remote/in/a.csv": []byte("a"),
+		"/remote/in/b.csv": []byte("b"),
+	}
+	client := newFakeClient(files)
+	jobs := []FileJob{
+		{RemotePath: "/remote/in/a.csv", ID: "a"},
+		{RemotePath: "/remote/in/b.csv", ID: "b"},
+		{RemotePath: "/remote/in/a.csv", ID: "escape"},
+	}
+	stamp := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC).Format("20060102T150405")
+
+	cfg := DefaultCfg()
+	cfg.SkipExisting = true
+	var mu sync.Mutex
+	named := map[string]int{}
+	cfg.NameFunc = func(job FileJob) string {
+		mu.Lock()
+		named[job.ID]++
+		mu.Unlock()
+		if job.ID == "escape" {
+			return "../escape.csv"
+		}
+		return stamp + "/" + stamp + "_" + path.Base(job.RemotePath)
+	}
+	transferred, failed, _ := cfg.TransferFilesToDir(client, jobs, dest)
+	if transferred != 2 || failed != 1 {
+		t.Fatalf("expected 2 transferred and the escaping name to fail, got %d and %d", transferred, failed)
+	}
+	for _, job := range jobs {
+		if named[job.ID] != 1 {
+			t.Errorf("expected %s to be named once, got %d", job.ID, named[job.ID])
+		}
+	}
+	for _, name := range []string{"a.csv", "b.csv"} {
+		got, err := os.ReadFile(filepath.Join(dest, stamp, stamp+"_"+name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := files["/remote/in/"+name]; !bytes.Equal(got, want) {
+			t.Errorf("%s: content mismatch", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dest), "escape.csv")); err == nil {
+		t.Error("escape.csv was written outside the destination")
+	}
+}
+
+func TestTransferFilesToDirFsync(t *testing.T) {
+	var mu sync.Mutex
+	var synced []string
+	orig := syncFile
+	syncFile = func(f *os.File) error {
+		mu.Lock()
+		// directories, synced after each rename, are recorded as "/"
+		if info, err := f.Stat(); err == nil && info.IsDir() {
+			synced = append(synced, "/")
+		} else {
+			synced = append(synced, filepath.Base(f.Name()))
+		}
+		mu.Unlock()
+		return orig(f)
+	}
+	t.Cleanup(func() { syncFile = orig })
+
+	client := newFakeClient(map[string][]byte{
+		"/remote/a.bin": []byte("a"),
+		"/remote/b.bin": []byte("b"),
+	})
+	jobs := []FileJob{{RemotePath: "/remote/a.bin", ID: "a"}, {RemotePath: "/remote/b.bin", ID: "b"}}
+	cfg := DefaultCfg()
+	if transferred, _, _ := cfg.TransferFilesToDir(client, jobs, t.TempDir()); transferred != 2 || len(synced) != 0 {
+		t.Fatalf("expected 2 transfers without syncs, got %d, %v", transferred, synced)
+	}
+
+	cfg.Fsync = true
+	if transferred, _, _ := cfg.TransferFilesToDir(client, jobs, t.TempDir()); transferred != 2 {
+		t.Fatalf("expected 2 transfers, got %d", transferred)
+	}
+	slices.Sort(synced)
+	if !slices.Equal(synced, []string{"/", "/", "a.tmp", "b.tmp"}) {
+		t.Errorf("expected both temp files synced before the rename and the directory after, got %v", synced)
+	}
+
+	synced = nil
+	cfg.Resume = true
+	if transferred, _, _ := cfg.TransferFilesToDir(client, jobs[:1], t.TempDir()); transferred != 1 || !slices.Equal(synced, []string{"a.part", "/"}) {
+		t.Errorf("expected the part file and its directory synced, got %d, %v", transferred, synced)
+	}
+}
+
+func TestTransferFilesToDirPreserveAttrs(t *testing.T) {
+	mtime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	client := sftptest.NewFakeClient()
+	client.Add("/remote/run.sh", sftptest.File{Data: []byte("#!/bin/sh\n"), ModTime: mtime, Mode: 0o751})
+	jobs := []FileJob{{RemotePath: "/remote/run.sh", ID: "run.sh"}}
+	cfg := DefaultCfg()
+	cfg.PreserveAttrs = true
+	dir := t.TempDir()
+	if transferred, failed, _ := cfg.TransferFilesToDir(client, jobs, dir); transferred != 1 {
+		t.Fatalf("expected 1 transfer, got %d, %d failed", transferred, failed)
+	}
+	info, err := os.Stat(filepath.Join(dir, "run.sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o751 {
+		t.Errorf("expected mode 0751, got %o", info.Mode().Perm())
+	}
+	if !info.ModTime().Equal(mtime) {
+		t.Errorf("expected mtime %v, got %v", mtime, info.ModTime())
+	}
+}
+
+func TestTransferFilesToDirPreserveAttrsFails(t *testing.T) {
+	orig := chtimes
+	chtimes = func(string, time.Time, time.Time) error { return errors.New("read-only filesystem") }
+	t.Cleanup(func() { chtimes = orig })
+
+	client := sftptest.NewFakeClient()
+	client.Add("/remote/a.bin", sftptest.File{Data: []byte("a"), ModTime: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)})
+	jobs := []FileJob{{RemotePath: "/remote/a.bin", ID: "a"}}
+	cfg := DefaultCfg()
+	cfg.PreserveAttrs = true
+	dir := t.TempDir()
+	if transferred, failed, _ := cfg.TransferFilesToDir(client, jobs, dir); transferred != 0 || failed != 1 {
+		t.Fatalf("expected the file to fail, got %d transferred, %d failed", transferred, failed)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("expected nothing left behind for a failed file, got %v", entries)
+	}
+
+	cfg.Resume = true
+	if _, failed, _ := cfg.TransferFilesToDir(client, jobs, dir); failed != 1 {
+		t.Fatalf("expected the file to fail under Resume, got %d failed", failed)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected a not renamed into place, got %v", err)
+	}
+}
+
+func TestTransferFilesToDirPreserveAttrsStatFails(t *testing.T) {
+	client := sftptest.NewFakeClient()
+	client.Add("/remote/a.bin", sftptest.File{Data: []byte("a"), StatErr: errors.New("stat unsupported")})
+	var logs bytes.Buffer
+	cfg := DefaultCfg()
+	cfg.PreserveAttrs = true
+	cfg.Logger = log.New(&logs, "", 0)
+	dir := t.TempDir()
+	if transferred, _, _ := cfg.TransferFilesToDir(client, []FileJob{{RemotePath: "/remote/a.bin", ID: "a"}}, dir); transferred != 1 {
+		t.Fatalf("expected the file written with default attributes, got %d transfers", transferred)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "a")); err != nil || string(data) != "a" {
+		t.Errorf("expected a written, got %q, %v", data, err)
+	}
+	if !strings.Contains(logs.String(), "Keeping default attributes") {
+		t.Errorf("expected a warning, got %q", logs.String())
+	}
+}
+
+func TestTransferFilesToDirNestedID(t *testing.T) {
+	dest := t.TempDir()
+	client := newFakeClient(map[string][]byte{"/remote/sub/a.bin": []byte("a")})
+	jobs := []FileJob{{RemotePath: "/remote/sub/a.bin", ID: "sub/deeper/a.bin"}}
+	if transferred, failed, _ := DefaultCfg().TransferFilesToDir(client, jobs, dest); transferred != 1 {
+		t.Fatalf("expected 1 transferred, got %d and %d failed", transferred, failed)
+	}
+	if got, err := os.ReadFile(filepath.Join(dest, "sub", "deeper", "a.bin")); err != nil || string(got) != "a" {
+		t.Errorf("expected the file under its ID's subdirectories, got %q, %v", got, err)
+	}
+}
+
+func TestTransferFilesToDirCreatesDestDir(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "new", "dest")
+	client := newFakeClient(map[string][]byte{"/remote/a.bin": []byte("a")})
+	jobs := []FileJob{{RemotePath: "/remote/a.bin", ID: "a.bin"}}
+	if transferred, failed, _ := DefaultCfg().TransferFilesToDir(client, jobs, dest); transferred != 1 {
+		t.Fatalf("expected 1 transferred, got %d and %d failed", transferred, failed)
+	}
+	if got, err := os.ReadFile(filepath.Join(dest, "a.bin")); err != nil || string(got) != "a" {
+		t.Errorf("expected the file in the new destDir, got %q, %v", got, err)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName names the tracer used when PipelineCfg.Tracer is nil.
+const tracerName = "github.com/MYK12397/sftp-go"
+
+// Span attribute keys
+const (
+	attrID         = attribute.Key("sftp.id")
+	attrRemotePath = attribute.Key("sftp.remote_path")
+	attrBytes      = attribute.Key("sftp.bytes")
+	attrSkipped    = attribute.Key("sftp.skipped")
+	attrFiles      = attribute.Key("sftp.files")
+)
+
+func (cfg PipelineCfg) tracer() trace.Tracer {
+	if cfg.Tracer != nil {
+		return cfg.Tracer
+	}
+	return otel.Tracer(tracerName)
+}
+
+// startFileSpan starts the span covering job, as a child of any span in ctx.
+// The open, read and process steps get child spans of their own.
+func (r *run) startFileSpan(ctx context.Context, job FileJob) (context.Context, trace.Span) {
+	return r.tracer.Start(ctx, "sftp.file", trace.WithAttributes(
+		attrID.String(job.ID),
+		attrRemotePath.String(job.RemotePath),
+	))
+}
+
+// endSpan marks span as failed with err, or as skipped for ErrSkip, and ends
+// it.
+func endSpan(span trace.Span, err error) {
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrSkip):
+		span.SetAttributes(attrSkipped.Bool(true))
+	default:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// noSpan stands in for the span of a job that doesn't have one.
+var noSpan = trace.SpanFromContext(context.Background())
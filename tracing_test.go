@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func spanAttr(span sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	client := newFakeClient(map[string][]byte{
+		"/remote/a.bin": []byte("alpha"),
+		"/remote/b.bin": []byte("beta"),
+	})
+	jobs := []FileJob{
+		{RemotePath: "/remote/a.bin", ID: "a"},
+		{RemotePath: "/remote/b.bin", ID: "b"},
+		{RemotePath: "/remote/missing.bin", ID: "missing"},
+	}
+
+	cfg := DefaultCfg()
+	cfg.Tracer = provider.Tracer("test")
+	ctx, parent := cfg.Tracer.Start(context.Background(), "batch")
+	if _, _, err := cfg.TransferFilesCtx(ctx, client, jobs, func(FileResult) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	parent.End()
+
+	files := map[string]sdktrace.ReadOnlySpan{}
+	children := map[string][]string{}
+	for _, span := range recorder.Ended() {
+		switch span.Name() {
+		case "sftp.file":
+			id := spanAttr(span, attrID).AsString()
+			if _, dup := files[id]; dup {
+				t.Errorf("more than one span for %s", id)
+			}
+			files[id] = span
+			if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+				t.Errorf("%s: span isn't a child of the batch span", id)
+			}
+		default:
+			children[span.Parent().SpanID().String()] = append(children[span.Parent().SpanID().String()], span.Name())
+		}
+	}
+	if len(files) != len(jobs) {
+		t.Fatalf("expected a span per job, got %d", len(files))
+	}
+
+	want := map[string]struct {
+		bytes int64
+		code  codes.Code
+		steps []string
+	}{
+		"a":       {5, codes.Unset, []string{"sftp.open", "sftp.read", "sftp.process"}},
+		"b":       {4, codes.Unset, []string{"sftp.open", "sftp.read", "sftp.process"}},
+		"missing": {0, codes.Error, []string{"sftp.open"}},
+	}
+	for id, w := range want {
+		span := files[id]
+		if got := spanAttr(span, attrBytes).AsInt64(); got != w.bytes {
+			t.Errorf("%s: bytes = %d, want %d", id, got, w.bytes)
+		}
+		if got := spanAttr(span, attrRemotePath).AsString(); got != "/remote/"+id+".bin" {
+			t.Errorf("%s: remote path = %q", id, got)
+		}
+		if span.Status().Code != w.code {
+			t.Errorf("%s: status = %v, want %v", id, span.Status().Code, w.code)
+		}
+		got := children[span.SpanContext().SpanID().String()]
+		if len(got) != len(w.steps) {
+			t.Errorf("%s: child spans %v, want %v", id, got, w.steps)
+			continue
+		}
+		for i := range got {
+			if got[i] != w.steps[i] {
+				t.Errorf("%s: child spans %v, want %v", id, got, w.steps)
+				break
+			}
+		}
+	}
+}
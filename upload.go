@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+type UploadJob struct {
+	LocalPath  string
+	RemotePath string
+}
+
+// uploader is the subset of *sftp.Client PutFiles writes through.
+type uploader interface {
+	Create(path string) (io.WriteCloser, error)
+	MkdirAll(path string) error
+	Remove(path string) error
+}
+
+// PutFiles uploads each LocalPath to RemotePath using SFTPReaders goroutines,
+// creating missing remote directories. A failed upload removes whatever it
+// created remotely rather than leaving a truncated file behind.
+func (cfg PipelineCfg) PutFiles(sftpClient *sftp.Client, jobs []UploadJob) (uploaded int32, failed int32) {
+	return cfg.putFiles(context.Background(), sftpAdapter{sftpClient}, jobs)
+}
+
+func (cfg PipelineCfg) putFiles(ctx context.Context, client uploader, jobs []UploadJob) (uploaded int32, failed int32) {
+	start := time.Now()
+	feed := feedJobs(ctx, fromSlice(jobs), cfg.SFTPReaders, nil)
+
+	// Directories already created, so each is only made once per run
+	var dirs sync.Map
+
+	var uploadWg sync.WaitGroup
+	for i := 0; i < cfg.SFTPReaders; i++ {
+		uploadWg.Go(func() {
+			for q := range feed.jobs {
+				if err := uploadFile(client, q.job, &dirs); err != nil {
+					atomic.AddInt32(&failed, 1)
+				} else {
+					atomic.AddInt32(&uploaded, 1)
+				}
+			}
+		})
+	}
+	uploadWg.Wait()
+	<-feed.done
+
+	cfg.logger().Printf("Upload completed in %s. Success: %d, Failed: %d\n", time.Since(start), uploaded, failed)
+
+	return uploaded, failed
+}
+
+func uploadFile(client uploader, job UploadJob, dirs *sync.Map) (err error) {
+	local, err := os.Open(job.LocalPath)
+	if err != nil {
+		return err
+	}
+	defer local.Close()
+
+	dir := path.Dir(job.RemotePath)
+	if _, ok := dirs.Load(dir); !ok {
+		if err := client.MkdirAll(dir); err != nil {
+			return err
+		}
+		dirs.Store(dir, struct{}{})
+	}
+
+	remote, err := client.Create(job.RemotePath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			client.Remove(job.RemotePath)
+		}
+	}()
+
+	if _, err = io.Copy(remote, local); err != nil {
+		remote.Close()
+		return err
+	}
+	return remote.Close()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// mockUploader keeps uploaded files in memory. Writes to paths in failWrites
+// fail.
+type mockUploader struct {
+	mu         sync.Mutex
+	files      map[string][]byte
+	dirs       map[string]bool
+	failWrites map[string]bool
+}
+
+type mockRemoteFile struct {
+	buf  bytes.Buffer
+	path string
+	fail bool
+	u    *mockUploader
+}
+
+func (f *mockRemoteFile) Write(p []byte) (int, error) {
+	if f.fail {
+		return 0, errors.New("disk quota exceeded")
+	}
+	return f.buf.Write(p)
+}
+
+func (f *mockRemoteFile) Close() error {
+	f.u.mu.Lock()
+	defer f.u.mu.Unlock()
+	if _, ok := f.u.files[f.path]; ok {
+		f.u.files[f.path] = f.buf.Bytes()
+	}
+	return nil
+}
+
+func (u *mockUploader) Create(path string) (io.WriteCloser, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.files[path] = nil
+	return &mockRemoteFile{path: path, fail: u.failWrites[path], u: u}, nil
+}
+
+func (u *mockUploader) MkdirAll(path string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.dirs[path] = true
+	return nil
+}
+
+func (u *mockUploader) Remove(path string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.files, path)
+	return nil
+}
+
+func TestPutFiles(t *testing.T) {
+	src := t.TempDir()
+	for name, data := range map[string]string{"a.txt": "alpha", "b.txt": "beta", "c.txt": "gamma"} {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	client := &mockUploader{
+		files:      map[string][]byte{},
+		dirs:       map[string]bool{},
+		failWrites: map[string]bool{"/upload/full/c.txt": true},
+	}
+	jobs := []UploadJob{
+		{LocalPath: filepath.Join(src, "a.txt"), RemotePath: "/upload/x/a.txt"},
+		{LocalPath: filepath.Join(src, "b.txt"), RemotePath: "/upload/y/z/b.txt"},
+		{LocalPath: filepath.Join(src, "c.txt"), RemotePath: "/upload/full/c.txt"},
+		{LocalPath: filepath.Join(src, "missing.txt"), RemotePath: "/upload/x/missing.txt"},
+	}
+
+	uploaded, failed := DefaultCfg().putFiles(context.Background(), client, jobs)
+	if uploaded != 2 || failed != 2 {
+		t.Fatalf("expected 2 uploaded and 2 failed, got %d and %d", uploaded, failed)
+	}
+	if string(client.files["/upload/x/a.txt"]) != "alpha" || string(client.files["/upload/y/z/b.txt"]) != "beta" {
+		t.Errorf("unexpected remote content: %q", client.files)
+	}
+	if _, ok := client.files["/upload/full/c.txt"]; ok {
+		t.Error("failed upload left a remote file behind")
+	}
+	if _, ok := client.files["/upload/x/missing.txt"]; ok {
+		t.Error("missing local file created a remote file")
+	}
+	if !client.dirs["/upload/y/z"] {
+		t.Error("remote directory was not created")
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// DirReader lists a remote directory. *sftp.Client satisfies it.
+type DirReader interface {
+	ReadDir(path string) ([]os.FileInfo, error)
+}
+
+// LinkReader resolves symlinks for a walk under FollowSymlinks. Lstat
+// describes a path without following a final symlink. *sftp.Client
+// satisfies it.
+type LinkReader interface {
+	ReadLink(path string) (string, error)
+	Lstat(path string) (os.FileInfo, error)
+}
+
+// ErrSymlinkLoop is wrapped by the error of a walk under FollowSymlinks that
+// met a symlink resolving to itself or to a directory it is inside.
+var ErrSymlinkLoop = errors.New("symlink loop")
+
+// ErrMaxFiles is returned, along with the jobs found so far, by a walk that
+// found more than WalkOptions.MaxFiles files.
+var ErrMaxFiles = errors.New("walk found more than MaxFiles files")
+
+// maxLinkHops bounds the symlinks followed to resolve one path.
+const maxLinkHops = 40
+
+// WalkOptions controls which files a directory walk turns into jobs.
+type WalkOptions struct {
+	// Include, if non-empty, keeps only files whose base name matches at
+	// least one pattern. Patterns use path.Match syntax.
+	Include []string
+	// Exclude drops files whose base name matches any pattern, even if they
+	// also match Include.
+	Exclude []string
+	// FollowSymlinks resolves symlinks, which the client must then resolve
+	// as a LinkReader: links to files yield jobs for the link's path and
+	// links to directories are walked as if they were the directory. Links
+	// that loop fail the walk with ErrSymlinkLoop, and dangling links are
+	// skipped. By default symlinks are skipped.
+	FollowSymlinks bool
+	// MaxDepth, when positive, bounds how deep the walk goes: 1 takes only
+	// the files directly in root, 2 those in its subdirectories too, and so
+	// on.
+	MaxDepth int
+	// MaxFiles, when positive, stops the walk once it has that many jobs. If
+	// there were more files, the jobs are returned with ErrMaxFiles.
+	MaxFiles int
+}
+
+// JobsFromDir returns a job for every regular file under root, recursing into
+// subdirectories. Each job's ID is its path relative to root. Symlinks and
+// other special files are skipped; see WalkOptions.FollowSymlinks. An
+// unreadable directory, for example one denied by permissions, aborts the
+// walk with an error naming it.
+func JobsFromDir(client DirReader, root string) ([]FileJob, error) {
+	return WalkOptions{}.JobsFromDir(client, root)
+}
+
+// JobsFromDir is the package-level JobsFromDir restricted by opts.
+func (opts WalkOptions) JobsFromDir(client DirReader, root string) ([]FileJob, error) {
+	return opts.walk(client, root, nil)
+}
+
+// walk runs a JobsFromDir walk, keeping only the files keep accepts if it
+// is non-nil.
+func (opts WalkOptions) walk(client DirReader, root string, keep func(job FileJob, info os.FileInfo) (bool, error)) ([]FileJob, error) {
+	for _, pattern := range slices.Concat(opts.Include, opts.Exclude) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("pattern %q: %w", pattern, err)
+		}
+	}
+	w := walker{opts: opts, client: client, keep: keep}
+	if opts.FollowSymlinks {
+		links, ok := client.(LinkReader)
+		if !ok {
+			return nil, fmt.Errorf("FollowSymlinks: %T can't read links: %w", client, errors.ErrUnsupported)
+		}
+		w.links = links
+	}
+	var jobs []FileJob
+	err := w.walkDir(root, "", []string{path.Clean(root)}, &jobs)
+	switch {
+	case errors.Is(err, ErrMaxFiles):
+		return jobs, err
+	case err != nil:
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// walker is the state of one JobsFromDir walk.
+type walker struct {
+	opts   WalkOptions
+	client DirReader
+	// links is set under FollowSymlinks.
+	links LinkReader
+	// keep, if set, decides which files become jobs.
+	keep func(job FileJob, info os.FileInfo) (bool, error)
+}
+
+// walkDir adds the jobs under dir, whose ID prefix is rel. real holds the
+// resolved paths of dir and the directories above it in the walk, so a link
+// back to any of them is known to loop. dir is listed by its resolved path.
+func (w walker) walkDir(dir, rel string, real []string, jobs *[]FileJob) error {
+	opts, client := w.opts, w.client
+	entries, err := client.ReadDir(real[len(real)-1])
+	if err != nil {
+		return fmt.Errorf("read dir %s: %w", dir, err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	for _, entry := range entries {
+		remotePath, id := path.Join(dir, entry.Name()), path.Join(rel, entry.Name())
+		info, target := entry, path.Join(real[len(real)-1], entry.Name())
+		if entry.Mode()&fs.ModeSymlink != 0 && w.links != nil {
+			var err error
+			if target, info, err = w.resolve(target); errors.Is(err, fs.ErrNotExist) {
+				continue
+			} else if err != nil {
+				return err
+			}
+		}
+		switch {
+		case info.IsDir():
+			if opts.MaxDepth > 0 && len(real) >= opts.MaxDepth {
+				continue
+			}
+			if slices.ContainsFunc(real, func(p string) bool { return within(p, target) }) {
+				return fmt.Errorf("%s: %w", remotePath, ErrSymlinkLoop)
+			}
+			if err := w.walkDir(remotePath, id, append(real, target), jobs); err != nil {
+				return err
+			}
+		case info.Mode().IsRegular() && opts.match(entry.Name()):
+			job := FileJob{RemotePath: remotePath, ID: id}
+			if w.keep != nil {
+				if ok, err := w.keep(job, info); err != nil {
+					return err
+				} else if !ok {
+					continue
+				}
+			}
+			if opts.MaxFiles > 0 && len(*jobs) == opts.MaxFiles {
+				return ErrMaxFiles
+			}
+			*jobs = append(*jobs, job)
+		}
+	}
+	return nil
+}
+
+// resolve follows the symlink at p to what it finally points to, returning
+// that path and its info.
+func (w walker) resolve(p string) (string, os.FileInfo, error) {
+	for range maxLinkHops {
+		target, err := w.links.ReadLink(p)
+		if err != nil {
+			return "", nil, fmt.Errorf("read link %s: %w", p, err)
+		}
+		if !path.IsAbs(target) {
+			target = path.Join(path.Dir(p), target)
+		}
+		p = path.Clean(target)
+		info, err := w.links.Lstat(p)
+		if err != nil {
+			return "", nil, fmt.Errorf("lstat %s: %w", p, err)
+		}
+		if info.Mode()&fs.ModeSymlink == 0 {
+			return p, info, nil
+		}
+	}
+	return "", nil, fmt.Errorf("%s: %w", p, ErrSymlinkLoop)
+}
+
+// within reports whether p is dir or inside it.
+func within(p, dir string) bool {
+	return p == dir || strings.HasPrefix(p, strings.TrimSuffix(dir, "/")+"/")
+}
+
+// match reports whether a file named name passes the Include and Exclude
+// patterns. Patterns are validated up front, so match errors can't occur.
+func (opts WalkOptions) match(name string) bool {
+	for _, pattern := range opts.Exclude {
+		if ok, _ := path.Match(pattern, name); ok {
+			return false
+		}
+	}
+	if len(opts.Include) == 0 {
+		return true
+	}
+	for _, pattern := range opts.Include {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// mapFSClient serves a remote tree from an fstest.MapFS, with "/" as the
+// root. Directories in denied fail to list.
+type mapFSClient struct {
+	fsys   fstest.MapFS
+	denied map[string]bool
+}
+
+func (c *mapFSClient) name(p string) string {
+	if p = strings.Trim(p, "/"); p == "" {
+		return "."
+	}
+	return p
+}
+
+func (c *mapFSClient) ReadDir(p string) ([]os.FileInfo, error) {
+	if c.denied[p] {
+		return nil, fs.ErrPermission
+	}
+	entries, err := fs.ReadDir(c.fsys, c.name(p))
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func testTree() fstest.MapFS {
+	return fstest.MapFS{
+		"data/a.csv":           {Data: []byte("a")},
+		"data/logs/b.log":      {Data: []byte("b")},
+		"data/logs/old/c.csv":  {Data: []byte("c")},
+		"data/link.csv":        {Data: []byte("a.csv"), Mode: fs.ModeSymlink},
+		"data/empty/.keep":     {Data: nil},
+		"data/nested/deep/d.x": {Data: []byte("d")},
+		"other/e.csv":          {Data: []byte("e")},
+	}
+}
+
+func TestJobsFromDir(t *testing.T) {
+	client := &mapFSClient{fsys: testTree()}
+	jobs, err := JobsFromDir(client, "/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FileJob{
+		{RemotePath: "/data/a.csv", ID: "a.csv"},
+		{RemotePath: "/data/empty/.keep", ID: "empty/.keep"},
+		{RemotePath: "/data/logs/b.log", ID: "logs/b.log"},
+		{RemotePath: "/data/logs/old/c.csv", ID: "logs/old/c.csv"},
+		{RemotePath: "/data/nested/deep/d.x", ID: "nested/deep/d.x"},
+	}
+	if len(jobs) != len(want) {
+		t.Fatalf("got %v, want %v", jobs, want)
+	}
+	for i := range want {
+		if !reflect.DeepEqual(jobs[i], want[i]) {
+			t.Errorf("jobs[%d] = %+v, want %+v", i, jobs[i], want[i])
+		}
+	}
+}
+
+func TestJobsFromDirPermissionError(t *testing.T) {
+	client := &mapFSClient{fsys: testTree(), denied: map[string]bool{"/data/logs": true}}
+	_, err := JobsFromDir(client, "/data")
+	if !errors.Is(err, fs.ErrPermission) || !strings.Contains(err.Error(), "/data/logs") {
+		t.Fatalf("expected a permission error for /data/logs, got %v", err)
+	}
+}
+
+func TestWalkOptionsFilters(t *testing.T) {
+	client := &mapFSClient{fsys: fstest.MapFS{
+		"in/report.csv":     {Data: []byte("1")},
+		"in/report.csv.tmp": {Data: []byte("2")},
+		"in/summary.CSV":    {Data: []byte("3")},
+		"in/app.log":        {Data: []byte("4")},
+		"in/sub/more.csv":   {Data: []byte("5")},
+		"in/sub/skip.csv":   {Data: []byte("6")},
+		"in/sub/notes.txt":  {Data: []byte("7")},
+	}}
+
+	opts := WalkOptions{Include: []string{"*.csv", "*.txt"}, Exclude: []string{"skip*", "*.txt"}}
+	jobs, err := opts.JobsFromDir(client, "/in")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, job := range jobs {
+		ids = append(ids, job.ID)
+	}
+	if got, want := strings.Join(ids, ","), "report.csv,sub/more.csv"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	if _, err := (WalkOptions{Include: []string{"["}}).JobsFromDir(client, "/in"); !errors.Is(err, path.ErrBadPattern) {
+		t.Errorf("expected ErrBadPattern, got %v", err)
+	}
+}
+
+// linkFSClient is a mapFSClient that resolves symlinks.
+type linkFSClient struct{ mapFSClient }
+
+func (c *linkFSClient) ReadLink(p string) (string, error) { return c.fsys.ReadLink(c.name(p)) }
+
+func (c *linkFSClient) Lstat(p string) (os.FileInfo, error) { return c.fsys.Lstat(c.name(p)) }
+
+func TestJobsFromDirFollowSymlinks(t *testing.T) {
+	tree := testTree()
+	tree["data/dangling"] = &fstest.MapFile{Data: []byte("missing"), Mode: fs.ModeSymlink}
+	tree["data/chain.csv"] = &fstest.MapFile{Data: []byte("link.csv"), Mode: fs.ModeSymlink}
+	tree["data/more"] = &fstest.MapFile{Data: []byte("/other"), Mode: fs.ModeSymlink}
+	client := &linkFSClient{mapFSClient{fsys: tree}}
+
+	opts := WalkOptions{FollowSymlinks: true, Include: []string{"*.csv"}}
+	jobs, err := opts.JobsFromDir(client, "/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, job := range jobs {
+		ids = append(ids, job.RemotePath)
+	}
+	want := "/data/a.csv,/data/chain.csv,/data/link.csv,/data/logs/old/c.csv,/data/more/e.csv"
+	if got := strings.Join(ids, ","); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	// Without FollowSymlinks the links are skipped as before
+	if jobs, err := JobsFromDir(client, "/data"); err != nil || len(jobs) != 5 {
+		t.Errorf("expected links to be skipped by default, got %v, %v", jobs, err)
+	}
+}
+
+func TestJobsFromDirSymlinkLoop(t *testing.T) {
+	for name, tree := range map[string]fstest.MapFS{
+		"ancestor": {
+			"data/a.csv":    {Data: []byte("a")},
+			"data/sub/up":   {Data: []byte("../.."), Mode: fs.ModeSymlink},
+			"data/sub/b.cs": {Data: []byte("b")},
+		},
+		"mutual": {
+			"data/a/to-b":  {Data: []byte("/data/b"), Mode: fs.ModeSymlink},
+			"data/b/to-a":  {Data: []byte("/data/a"), Mode: fs.ModeSymlink},
+			"data/b/f.csv": {Data: []byte("f")},
+		},
+		"chain": {
+			"data/x": {Data: []byte("y"), Mode: fs.ModeSymlink},
+			"data/y": {Data: []byte("x"), Mode: fs.ModeSymlink},
+		},
+	} {
+		client := &linkFSClient{mapFSClient{fsys: tree}}
+		_, err := WalkOptions{FollowSymlinks: true}.JobsFromDir(client, "/data")
+		if !errors.Is(err, ErrSymlinkLoop) {
+			t.Errorf("%s: expected ErrSymlinkLoop, got %v", name, err)
+		}
+	}
+}
+
+func TestFollowSymlinksNeedsLinkReader(t *testing.T) {
+	client := &mapFSClient{fsys: testTree()}
+	if _, err := (WalkOptions{FollowSymlinks: true}).JobsFromDir(client, "/data"); !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("expected ErrUnsupported, got %v", err)
+	}
+}
+
+func TestWalkOptionsLimits(t *testing.T) {
+	tree := fstest.MapFS{}
+	dir := "deep"
+	for i := 0; i < 10; i++ {
+		tree[dir+"/f.txt"] = &fstest.MapFile{Data: []byte("x")}
+		tree[dir+"/g.txt"] = &fstest.MapFile{Data: []byte("x")}
+		dir += "/sub"
+	}
+	client := &mapFSClient{fsys: tree}
+
+	jobs, err := WalkOptions{MaxDepth: 3}.JobsFromDir(client, "/deep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 6 || jobs[5].ID != "sub/sub/g.txt" {
+		t.Errorf("expected the files of the top three levels, got %v", jobs)
+	}
+
+	jobs, err = WalkOptions{MaxFiles: 5}.JobsFromDir(client, "/deep")
+	if !errors.Is(err, ErrMaxFiles) || len(jobs) != 5 || jobs[0].ID != "f.txt" {
+		t.Errorf("expected the first 5 files and ErrMaxFiles, got %v, %v", jobs, err)
+	}
+
+	// Exactly MaxFiles files is not over the limit
+	jobs, err = WalkOptions{MaxDepth: 2, MaxFiles: 4}.JobsFromDir(client, "/deep")
+	if err != nil || len(jobs) != 4 {
+		t.Errorf("expected 4 files and no error, got %v, %v", jobs, err)
+	}
+}
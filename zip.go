@@ -0,0 +1,34 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"io"
+	"time"
+)
+
+// TransferFilesToZip is TransferFilesToTar for a zip archive. Each entry is
+// compressed with the method ZipMethod picks for it.
+func (cfg PipelineCfg) TransferFilesToZip(ctx context.Context, sftpClient SFTPClient, jobs []FileJob, w io.Writer) (TransferStats, error) {
+	zw := zip.NewWriter(w)
+	return cfg.archive(ctx, sftpClient, jobs, func(name string, data []byte) error {
+		f, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     name,
+			Method:   cfg.zipMethod(name),
+			Modified: time.Now(),
+		})
+		if err == nil {
+			_, err = f.Write(data)
+		}
+		return err
+	}, zw.Close)
+}
+
+// zipMethod is the compression method for an entry: ZipMethod's choice, or
+// zip.Deflate.
+func (cfg PipelineCfg) zipMethod(name string) uint16 {
+	if cfg.ZipMethod == nil {
+		return zip.Deflate
+	}
+	return cfg.ZipMethod(name)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"testing"
+)
+
+func TestTransferFilesToZip(t *testing.T) {
+	files := map[string][]byte{}
+	var jobs []FileJob
+	for i := 0; i < 30; i++ {
+		ext := ".csv"
+		if i%3 == 0 {
+			ext = ".jpg"
+		}
+		path := fmt.Sprintf("/remote/file_%d%s", i, ext)
+		files[path] = bytes.Repeat([]byte(fmt.Sprintf("row %d\n", i)), 50*i)
+		jobs = append(jobs, FileJob{RemotePath: path, ID: "export" + path})
+	}
+	client := newFakeClient(files)
+	jobs = append(jobs, FileJob{RemotePath: "/remote/missing.csv", ID: "missing.csv"})
+
+	var buf bytes.Buffer
+	cfg := DefaultCfg()
+	cfg.ZipMethod = func(name string) uint16 {
+		if path.Ext(name) == ".jpg" {
+			return zip.Store
+		}
+		return zip.Deflate
+	}
+	stats, err := cfg.TransferFilesToZip(context.Background(), client, jobs, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Transferred != 30 || stats.Failed != 1 {
+		t.Fatalf("expected 30 transferred and 1 failed, got %+v", stats)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zr.File) != 30 {
+		t.Fatalf("expected 30 entries, got %d", len(zr.File))
+	}
+	for _, f := range zr.File {
+		want, ok := files[f.Name[len("export"):]]
+		if !ok {
+			t.Errorf("unexpected entry %s", f.Name)
+			continue
+		}
+		if wantMethod := cfg.ZipMethod(f.Name); f.Method != wantMethod {
+			t.Errorf("%s: method %d, want %d", f.Name, f.Method, wantMethod)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: content mismatch", f.Name)
+		}
+	}
+}